@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/chainreactors/logs"
 	"github.com/chainreactors/neutron/common"
 	_ "github.com/chainreactors/neutron/convert"
+	"github.com/chainreactors/neutron/operators"
 	"github.com/chainreactors/neutron/protocols"
 	"github.com/chainreactors/neutron/templates"
 	"github.com/davecgh/go-spew/spew"
@@ -23,6 +25,9 @@ func main() {
 	timeoutFlag := flag.Int("timeout", 5, "Request timeout in seconds")
 	proxyAddr := flag.String("proxy", "", "Proxy address (e.g., http://127.0.0.1:8080)")
 	debug := flag.Bool("debug", false, "Enable debug mode")
+	explain := flag.Bool("explain", false, "Explain how every matcher evaluated each response")
+	vars := varsFlag{}
+	flag.Var(vars, "var", "Override a template variable or constant, key=value (repeatable)")
 	flag.Parse()
 
 	targetPath := *pathFlag
@@ -36,7 +41,7 @@ func main() {
 	}
 
 	if targetPath == "" || targetURL == "" {
-		fmt.Println("Usage: shot -path <template> -target <url> [-json] [-timeout N] [-proxy <addr>]")
+		fmt.Println("Usage: shot -path <template> -target <url> [-json] [-timeout N] [-proxy <addr>] [-explain] [-var key=value]")
 		fmt.Println("       shot <path_or_file> <target_url>")
 		os.Exit(1)
 	}
@@ -54,6 +59,16 @@ func main() {
 	if *proxyAddr != "" {
 		execOpts.Options.ProxyURL = *proxyAddr
 	}
+	if len(vars) > 0 {
+		execOpts.Options.Vars = vars
+	}
+
+	// payload files resolve against the template directory, then the root
+	root := targetPath
+	if info, err := os.Stat(targetPath); err == nil && !info.IsDir() {
+		root = filepath.Dir(targetPath)
+	}
+	execOpts.Catalog = protocols.DirCatalog(root)
 
 	var yamlFiles []string
 	err := filepath.Walk(targetPath, func(path string, info os.FileInfo, err error) error {
@@ -74,6 +89,7 @@ func main() {
 	extractedCount := 0
 	positiveCount := 0
 	totalCount := len(yamlFiles)
+	explanations := make(map[string][]*operators.Explanation)
 
 	for _, yamlFile := range yamlFiles {
 		content, err := os.ReadFile(yamlFile)
@@ -92,6 +108,9 @@ func main() {
 			continue
 		}
 
+		if rel, err := filepath.Rel(root, yamlFile); err == nil {
+			execOpts.TemplatePath = filepath.ToSlash(rel)
+		}
 		err = t.Compile(execOpts)
 		if err != nil {
 			if !*jsonFlag {
@@ -104,7 +123,24 @@ func main() {
 			fmt.Printf("Load success for %s\n", yamlFile)
 		}
 		start := time.Now()
-		res, err := t.Execute(targetURL, nil)
+		var res *operators.Result
+		if *explain {
+			var events []*protocols.ResultEvent
+			res, events, err = t.ExecuteWithExplanation(targetURL, nil)
+			for _, event := range events {
+				explanation, ok := event.Metadata[protocols.ExplainKey].(*operators.Explanation)
+				if !ok {
+					continue
+				}
+				if *jsonFlag {
+					explanations[yamlFile] = append(explanations[yamlFile], explanation)
+				} else {
+					fmt.Printf("Explain %s %s:\n%s", event.Type, event.Matched, explanation)
+				}
+			}
+		} else {
+			res, err = t.Execute(targetURL, nil)
+		}
 		if err == nil && res != nil && res.Matched {
 			matchedCount++
 			positiveCount++
@@ -129,13 +165,37 @@ func main() {
 	}
 
 	if *jsonFlag {
-		out, _ := json.Marshal(map[string]interface{}{
+		summary := map[string]interface{}{
 			"matched_count":   matchedCount,
 			"extracted_count": extractedCount,
 			"positive_count":  positiveCount,
 			"total":           totalCount,
 			"target":          targetURL,
-		})
+		}
+		if *explain {
+			summary["explanations"] = explanations
+		}
+		out, _ := json.Marshal(summary)
 		fmt.Println(string(out))
 	}
 }
+
+// varsFlag collects the -var key=value flags.
+type varsFlag map[string]interface{}
+
+func (v varsFlag) String() string {
+	pairs := make([]string, 0, len(v))
+	for key, value := range v {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v varsFlag) Set(value string) error {
+	index := strings.Index(value, "=")
+	if index <= 0 {
+		return fmt.Errorf("invalid var %q, expected key=value", value)
+	}
+	v[value[:index]] = value[index+1:]
+	return nil
+}
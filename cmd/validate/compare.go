@@ -11,6 +11,7 @@ import (
 
 	"github.com/Knetic/govaluate"
 	"github.com/chainreactors/neutron/common"
+	"github.com/chainreactors/neutron/operators"
 	"github.com/chainreactors/neutron/protocols/http"
 	"github.com/chainreactors/neutron/templates"
 	"gopkg.in/yaml.v3"
@@ -515,6 +516,10 @@ func evalNuclei(req *http.Request, m mockResponse) (bool, error) {
 	if condition == "" {
 		condition = "or"
 	}
+	if req.CompiledOperators.GetMatchersCondition() == operators.ExpressionCondition {
+		result, _ := req.CompiledOperators.Execute(data, req.Match, req.Extract)
+		return result != nil && result.Matched, nil
+	}
 
 	var anyMatched, allMatched = false, true
 	for _, matcher := range req.CompiledOperators.Matchers {
@@ -4,11 +4,14 @@
 // Usage:
 //
 //	validate <path_or_file>                                     # compile check
+//	validate -graph [-format dot|mermaid] [-o file] <path>      # chain graph
 //	validate compare --xray <xray.yml> --nuclei <nuclei.yaml>   # semantic comparison
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -18,10 +21,15 @@ import (
 	"github.com/chainreactors/neutron/templates"
 )
 
+func usage() {
+	fmt.Println("Usage: validate <path_or_file>")
+	fmt.Println("       validate -graph [-format dot|mermaid] [-o file] <path_or_file>")
+	fmt.Println("       validate compare --xray <xray.yml> --nuclei <nuclei.yaml> [--json] [-v]")
+}
+
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: validate <path_or_file>")
-		fmt.Println("       validate compare --xray <xray.yml> --nuclei <nuclei.yaml> [--json] [-v]")
+		usage()
 		os.Exit(1)
 	}
 
@@ -30,8 +38,34 @@ func main() {
 		return
 	}
 
-	target := os.Args[1]
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	graph := fs.Bool("graph", false, "write the chain graph of the templates instead of compiling them")
+	format := fs.String("format", "dot", "graph format: dot or mermaid")
+	output := fs.String("o", "", "graph output file (default stdout)")
+	fs.Usage = func() {
+		usage()
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	target := fs.Arg(0)
+	if *graph {
+		if err := runGraph(target, *format, *output); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	opts := &protocols.ExecuterOptions{Options: &protocols.Options{Timeout: 5}}
+	root := target
+	if info, err := os.Stat(target); err == nil && !info.IsDir() {
+		root = filepath.Dir(target)
+	}
+	opts.Catalog = protocols.DirCatalog(root)
 	err := filepath.Walk(target, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -44,6 +78,18 @@ func main() {
 			return err
 		}
 
+		if rel, err := filepath.Rel(root, path); err == nil {
+			opts.TemplatePath = filepath.ToSlash(rel)
+		}
+		if w, err := templates.LoadWorkflow(content); err == nil {
+			if _, err := w.LoadTemplates(opts); err != nil {
+				fmt.Printf("FAIL %s - workflow failed: %s\n", path, err.Error())
+				return nil
+			}
+			fmt.Printf("OK   %s\n", path)
+			return nil
+		}
+
 		t, err := templates.Load(content)
 		if err != nil {
 			fmt.Printf("FAIL %s - load failed: %s\n", path, err.Error())
@@ -57,6 +103,9 @@ func main() {
 		}
 
 		fmt.Printf("OK   %s\n", path)
+		for _, warning := range t.Warnings {
+			fmt.Printf("WARN %s - %s\n", path, warning)
+		}
 		return nil
 	})
 
@@ -64,3 +113,122 @@ func main() {
 		fmt.Println("Error:", err)
 	}
 }
+
+// runGraph loads the templates and workflows under target and writes the
+// chain graph they build. Templates are keyed by ID, the templates of a
+// workflow included, and each finger a template declares is a "finger:<name>"
+// node chained to it.
+func runGraph(target, format, output string) error {
+	var write func(e *templates.ChainExecutor, w io.Writer) error
+	switch format {
+	case "dot":
+		write = (*templates.ChainExecutor).WriteDOT
+	case "mermaid":
+		write = (*templates.ChainExecutor).WriteMermaid
+	default:
+		return fmt.Errorf("unknown graph format %s", format)
+	}
+
+	root := target
+	if info, err := os.Stat(target); err == nil && !info.IsDir() {
+		root = filepath.Dir(target)
+	}
+	opts := &protocols.ExecuterOptions{Catalog: protocols.DirCatalog(root)}
+	e := templates.NewChainExecutor(templates.ChainConfig{})
+	// ids maps the catalog path of the templates to their ID, the workflows
+	// being registered once every template is
+	ids := make(map[string]string)
+	workflows := make(map[string]*templates.Workflow)
+	var workflowPaths []string
+	err := filepath.Walk(target, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml" {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if w, err := templates.LoadWorkflow(content); err == nil {
+			workflows[rel] = w
+			workflowPaths = append(workflowPaths, rel)
+			return nil
+		}
+		t, err := templates.Load(content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "FAIL %s - load failed: %s\n", path, err.Error())
+			return nil
+		}
+		ids[rel] = t.Id
+		if err := e.Add(t.Id, t.Chains); err != nil {
+			fmt.Fprintf(os.Stderr, "WARN %s - %s\n", path, err.Error())
+		}
+		for _, finger := range t.Fingers {
+			e.AddEdges("finger:"+finger, templates.ChainEdge{Target: t.Id})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range workflowPaths {
+		w := workflows[path]
+		opts.TemplatePath = path
+		// templates missing from target keep their path
+		missing := make(map[string]bool)
+		w.Walk(func(t *templates.WorkflowTemplate) {
+			if id := templateID(opts, ids, t.Template); id != "" {
+				t.Template = id
+			} else if !missing[t.Template] {
+				missing[t.Template] = true
+				fmt.Fprintf(os.Stderr, "WARN %s - %s: template not found\n", filepath.Join(root, path), t.Template)
+			}
+		})
+		if err := w.Chain(e); err != nil {
+			fmt.Fprintf(os.Stderr, "WARN %s - %s\n", filepath.Join(root, path), err.Error())
+		}
+	}
+
+	out := os.Stdout
+	if output != "" {
+		if out, err = os.Create(output); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	return write(e, out)
+}
+
+// templateID returns the ID of the template a workflow names, loading it from
+// the catalog when it is outside target, or "" when it cannot be loaded.
+func templateID(opts *protocols.ExecuterOptions, ids map[string]string, path string) string {
+	name, ok := opts.ResolvePath(path)
+	if !ok {
+		return ""
+	}
+	if id, ok := ids[name]; ok {
+		return id
+	}
+	ids[name] = ""
+	file, err := opts.Catalog.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return ""
+	}
+	if t, err := templates.Load(content); err == nil {
+		ids[name] = t.Id
+	}
+	return ids[name]
+}
@@ -35,7 +35,7 @@ func GetFunctionNames() []string {
 
 // Eval compiles the given expression and evaluate it with the given values preserving the return type
 func Eval(expression string, values map[string]interface{}) (interface{}, error) {
-	compiled, err := govaluate.NewEvaluableExpressionWithFunctions(expression, GetHelperFunctions())
+	compiled, err := dsl.CompileExpression(expression)
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +76,7 @@ func evaluate(data string, base map[string]interface{}) (string, error) {
 		// replace variable placeholders with base values
 		expression = Replace(expression, base)
 		// turns expressions (either helper functions+base values or base values)
-		compiled, err := govaluate.NewEvaluableExpressionWithFunctions(expression, GetHelperFunctions())
+		compiled, err := dsl.CompileExpression(expression)
 		if err != nil {
 			continue
 		}
@@ -151,22 +151,17 @@ func FindExpressions(data, OpenMarker, CloseMarker string, base map[string]inter
 }
 
 func isExpression(data string, base map[string]interface{}) bool {
-	if _, err := govaluate.NewEvaluableExpression(data); err == nil {
-		if StringsContains(getFunctionsNames(base), data) {
-			return true
-		} else if StringsContains(GetFunctionNames(), data) {
-			return true
-		}
+	compiled, err := dsl.CompileExpression(data)
+	if err != nil {
 		return false
 	}
-	_, err := govaluate.NewEvaluableExpressionWithFunctions(data, GetHelperFunctions())
-	return err == nil
-}
-
-func getFunctionsNames(m map[string]interface{}) []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
+	// without helper functions only a bare variable (or function name) is
+	// an expression, literals like {{2+2}} are not
+	if len(compiled.Functions()) == 0 {
+		if _, ok := base[data]; ok {
+			return true
+		}
+		return StringsContains(GetFunctionNames(), data)
 	}
-	return keys
+	return true
 }
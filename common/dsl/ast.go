@@ -15,6 +15,8 @@ const (
 	NodeBinaryOp                 // left && right, left == right
 	NodeUnaryOp                  // !expr
 	NodeCall                     // contains(body, "test")
+	NodeTernary                  // cond ? then : else
+	NodeList                     // (1, 2, 3)
 )
 
 type Node struct {
@@ -44,6 +46,17 @@ func (n *Node) String() string {
 			args[i] = c.String()
 		}
 		return fmt.Sprintf("%s(%s)", n.FuncName, strings.Join(args, ", "))
+	case NodeTernary:
+		if len(n.Children) < 3 {
+			return fmt.Sprintf("(%s ? %s)", n.Children[0], n.Children[1])
+		}
+		return fmt.Sprintf("(%s ? %s : %s)", n.Children[0], n.Children[1], n.Children[2])
+	case NodeList:
+		items := make([]string, len(n.Children))
+		for i, c := range n.Children {
+			items[i] = c.String()
+		}
+		return fmt.Sprintf("(%s)", strings.Join(items, ", "))
 	}
 	return "?"
 }
@@ -59,13 +72,13 @@ func quoteStringLiteral(s string) string {
 // hex_decode(...) instead of a plain quoted literal. Any control byte (incl.
 // \t \n \r), invalid UTF-8, or a date-like literal must take this path.
 //
-// This looks stricter than nuclei's own DSL emission, but it is forced by the
-// evaluation engine: govaluate (nuclei's DSL evaluator) only honours \" as an
-// escape; for \n, \t, \r and every other \x it silently drops the backslash and
-// keeps the following character. So a literal written as "a\nb" evaluates to the
+// neutron's engine decodes \n, \t, \r, \0 and \xNN in literals, but the
+// emitted DSL must also run on nuclei, whose govaluate evaluator only honours
+// \" as an escape: for \n, \t, \r and every other \x it silently drops the
+// backslash and keeps the following character. There "a\nb" evaluates to the
 // three runes a,n,b — it would match the letters "anb", never a real newline.
-// hex_decode (a standard nuclei DSL function) is therefore the only way to make
-// such bytes match correctly, and the emitted template stays nuclei-portable.
+// hex_decode (a standard nuclei DSL function) means the same bytes in both
+// engines, so the emitted template stays nuclei-portable.
 //
 // Date-like literals ("2006-01-02 03:04:05") are even nastier: govaluate does
 // NOT error — it silently returns the wrong boolean. contains(body,
@@ -117,6 +130,13 @@ func UnaryOp(op string, operand *Node) *Node {
 func Call(name string, args ...*Node) *Node {
 	return &Node{Type: NodeCall, FuncName: name, Children: args}
 }
+func Ternary(cond, then, otherwise *Node) *Node {
+	if otherwise == nil {
+		return &Node{Type: NodeTernary, Children: []*Node{cond, then}}
+	}
+	return &Node{Type: NodeTernary, Children: []*Node{cond, then, otherwise}}
+}
+func List(items ...*Node) *Node { return &Node{Type: NodeList, Children: items} }
 
 // SuffixVariables deep-clones the AST and appends suffix to all Variable node names.
 func SuffixVariables(n *Node, suffix string) *Node {
@@ -147,4 +167,6 @@ var (
 	binaryOp = BinaryOp
 	unaryOp  = UnaryOp
 	call     = Call
+	ternary  = Ternary
+	list     = List
 )
@@ -0,0 +1,134 @@
+package dsl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Arity is the number of arguments a helper function accepts, Max is -1 for
+// variadic functions.
+type Arity struct {
+	Min int
+	Max int
+}
+
+// Accepts reports whether the function can be called with n arguments.
+func (a Arity) Accepts(n int) bool {
+	return n >= a.Min && (a.Max < 0 || n <= a.Max)
+}
+
+func (a Arity) String() string {
+	switch {
+	case a.Max < 0:
+		return "at least " + strconv.Itoa(a.Min)
+	case a.Min == a.Max:
+		return strconv.Itoa(a.Min)
+	default:
+		return fmt.Sprintf("%d to %d", a.Min, a.Max)
+	}
+}
+
+// arity derives the accepted number of arguments from the positional args or
+// the signatures of the function. Parameters named optionalXxx are optional
+// and "..." makes the function variadic; the arity of a function with several
+// signatures accepts any of them.
+func (d dslFunction) arity() (Arity, bool) {
+	if d.NumberOfArgs > 0 {
+		return Arity{Min: d.NumberOfArgs, Max: d.NumberOfArgs}, true
+	}
+	if len(d.Signatures) == 0 {
+		return Arity{}, false
+	}
+
+	var arity Arity
+	for i, signature := range d.Signatures {
+		start, end := strings.Index(signature, "("), strings.Index(signature, ")")
+		if start < 0 || end < start {
+			return Arity{}, false
+		}
+		var current Arity
+		for _, param := range strings.Split(signature[start+1:end], ",") {
+			param = strings.TrimSpace(param)
+			switch {
+			case param == "":
+			case strings.Contains(param, "..."):
+				current.Max = -1
+			case strings.HasPrefix(param, "optional"):
+				if current.Max >= 0 {
+					current.Max++
+				}
+			default:
+				current.Min++
+				if current.Max >= 0 {
+					current.Max++
+				}
+			}
+		}
+		if i == 0 {
+			arity = current
+			continue
+		}
+		if current.Min < arity.Min {
+			arity.Min = current.Min
+		}
+		if arity.Max >= 0 && (current.Max < 0 || current.Max > arity.Max) {
+			arity.Max = current.Max
+		}
+	}
+	return arity, true
+}
+
+// FunctionArity returns the arity of a registered helper function, also
+// looked up by its name without underscores. ok is false when the function is
+// unknown or declares no signature.
+func FunctionArity(name string) (Arity, bool) {
+	ensureDefaultFunctions()
+	for _, f := range functions {
+		if f.Name == name || strings.Replace(f.Name, "_", "", -1) == name {
+			return f.arity()
+		}
+	}
+	return Arity{}, false
+}
+
+// Check statically checks expression: its syntax, that every helper function
+// exists and is called with an accepted number of arguments and, when defined
+// is not nil, that every variable is defined. Variables on the left of "??"
+// may be missing and are not checked.
+func Check(expression string, defined func(name string) bool) error {
+	ensureDefaultFunctions()
+	root, err := parse(expression, true)
+	if err != nil {
+		return err
+	}
+	return checkNode(root, defined)
+}
+
+func checkNode(node *Node, defined func(name string) bool) error {
+	switch node.Type {
+	case NodeVariable:
+		name := node.Value.(string)
+		if defined != nil && !defined(name) {
+			return fmt.Errorf("undefined variable %s", name)
+		}
+		return nil
+	case NodeCall:
+		if _, ok := DefaultHelperFunctions[node.FuncName]; !ok {
+			return fmt.Errorf("undefined function %s", node.FuncName)
+		}
+		if arity, ok := FunctionArity(node.FuncName); ok && !arity.Accepts(len(node.Children)) {
+			return fmt.Errorf("function %s expects %s arguments, got %d", node.FuncName, arity, len(node.Children))
+		}
+	case NodeBinaryOp:
+		if node.Op == "??" && node.Children[0].Type == NodeVariable {
+			return checkNode(node.Children[1], defined)
+		}
+	}
+	for _, child := range node.Children {
+		if err := checkNode(child, defined); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package dsl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunctionArity(t *testing.T) {
+	for name, expected := range map[string]Arity{
+		"contains":     {Min: 2, Max: 2},
+		"md5":          {Min: 1, Max: 1},
+		"substr":       {Min: 2, Max: 3},
+		"rand_int":     {Min: 0, Max: 2},
+		"generate_jwt": {Min: 2, Max: 4},
+		"concat":       {Min: 0, Max: -1},
+		"join":         {Min: 1, Max: -1},
+		"split":        {Min: 2, Max: 3},
+		"randint":      {Min: 0, Max: 2},
+	} {
+		arity, ok := FunctionArity(name)
+		require.True(t, ok, name)
+		require.Equal(t, expected, arity, name)
+	}
+	_, ok := FunctionArity("contians")
+	require.False(t, ok)
+
+	require.Equal(t, "2", Arity{Min: 2, Max: 2}.String())
+	require.Equal(t, "2 to 3", Arity{Min: 2, Max: 3}.String())
+	require.Equal(t, "at least 1", Arity{Min: 1, Max: -1}.String())
+}
+
+func TestCheck(t *testing.T) {
+	defined := func(name string) bool {
+		return name == "body" || name == "status_code"
+	}
+	for expression, expected := range map[string]string{
+		`contains(body, "admin") && status_code == 200`: "",
+		`contians(body, "admin")`:                       "undefined function contians",
+		`contains(body)`:                                "function contains expects 2 arguments, got 1",
+		`substr(body, 1, 2, 3)`:                         "function substr expects 2 to 3 arguments, got 4",
+		`join()`:                                        "function join expects at least 1 arguments, got 0",
+		`contains(bodyy, "admin")`:                      "undefined variable bodyy",
+		`to_lower(md5(header)) == ""`:                   "undefined variable header",
+		`missing ?? body`:                               "",
+		`status_code in (200, 302)`:                     "",
+	} {
+		err := Check(expression, defined)
+		if expected == "" {
+			require.Nil(t, err, expression)
+			continue
+		}
+		require.EqualError(t, err, expected, expression)
+	}
+
+	require.Nil(t, Check(`contains(anything, "x")`, nil))
+	require.NotNil(t, Check(`contains(body, "x"`, nil))
+}
+
+func TestCheckAcceptsExpressionCorpus(t *testing.T) {
+	for expression := range dslExpressions() {
+		require.Nil(t, Check(expression, nil), expression)
+	}
+}
@@ -0,0 +1,258 @@
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// dynamicPlaceholder replaces the values strip_dynamic removes, so that two
+// stripped responses still line up.
+const dynamicPlaceholder = "__dynamic__"
+
+// maxLineDiffCells bounds the LCS table of line_diff_count, past it lines
+// are compared as multisets.
+const maxLineDiffCells = 1 << 22
+
+var (
+	// the value of csrf-like inputs and meta tags, and of nonce attributes
+	dynamicAttributeRegex = regexp.MustCompile(`(?i)((?:csrf|xsrf|token|nonce|authenticity)[\w-]*["']?[^<>]*?\b(?:value|content)\s*=\s*)(["'])[^"']*(["'])`)
+	dynamicNonceRegex     = regexp.MustCompile(`(?i)(\bnonce\s*=\s*)(["'])[^"']*(["'])`)
+	// "csrfToken": "..." in inline json or javascript
+	dynamicJSONKeyRegex = regexp.MustCompile(`(?i)(["'][\w-]*(?:csrf|xsrf|nonce)[\w-]*["']\s*:\s*)(["'])[^"']*(["'])`)
+
+	dynamicValueRegexes = []*regexp.Regexp{
+		// 2024-01-02T15:04:05.000Z, 2024-01-02 15:04:05+08:00, 2024/01/02
+		regexp.MustCompile(`\d{4}[-/]\d{2}[-/]\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2})?(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?)?`),
+		// Mon, 02 Jan 2006 15:04:05 GMT
+		regexp.MustCompile(`(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun), \d{2} (?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) \d{4} \d{2}:\d{2}:\d{2} [A-Z]{3}`),
+		regexp.MustCompile(`\b\d{2}:\d{2}:\d{2}(?:\.\d+)?\b`),
+		regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`),
+		regexp.MustCompile(`(?i)\b[0-9a-f]{16,}\b`),
+		// unix timestamps in seconds or milliseconds
+		regexp.MustCompile(`\b1\d{9}(?:\d{3})?\b`),
+	}
+	// random ids and session tokens: long runs mixing letters and digits
+	dynamicTokenRegex = regexp.MustCompile(`[A-Za-z0-9_\-+/]{20,}={0,2}`)
+)
+
+// stripDynamic replaces the parts of a response that change between two
+// identical requests: csrf tokens and nonces, dates and times, timestamps,
+// uuids, hex digests and random ids.
+func stripDynamic(input string) string {
+	input = dynamicAttributeRegex.ReplaceAllString(input, "${1}${2}"+dynamicPlaceholder+"${3}")
+	input = dynamicNonceRegex.ReplaceAllString(input, "${1}${2}"+dynamicPlaceholder+"${3}")
+	input = dynamicJSONKeyRegex.ReplaceAllString(input, "${1}${2}"+dynamicPlaceholder+"${3}")
+	for _, regex := range dynamicValueRegexes {
+		input = regex.ReplaceAllString(input, dynamicPlaceholder)
+	}
+	return dynamicTokenRegex.ReplaceAllStringFunc(input, func(token string) string {
+		if token == dynamicPlaceholder || !strings.ContainsAny(token, "0123456789") || strings.IndexFunc(token, unicode.IsLetter) < 0 {
+			return token
+		}
+		return dynamicPlaceholder
+	})
+}
+
+// similarity returns how similar a and b are, from 0 to 1, as the Dice
+// coefficient of their multisets of 3-token shingles. Tokens are words and
+// single punctuation characters, so markup counts but whitespace does not.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	shinglesA, shinglesB := shingles(a), shingles(b)
+	total := 0
+	for _, count := range shinglesA {
+		total += count
+	}
+	for _, count := range shinglesB {
+		total += count
+	}
+	if total == 0 {
+		return 1
+	}
+	common := 0
+	for shingle, count := range shinglesA {
+		if other := shinglesB[shingle]; other < count {
+			common += other
+		} else {
+			common += count
+		}
+	}
+	return 2 * float64(common) / float64(total)
+}
+
+func shingles(input string) map[string]int {
+	var tokens []string
+	start := -1
+	for i, ch := range input {
+		word := unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_'
+		if word {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, input[start:i])
+			start = -1
+		}
+		if !unicode.IsSpace(ch) {
+			tokens = append(tokens, string(ch))
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, input[start:])
+	}
+
+	result := make(map[string]int)
+	if len(tokens) < 3 {
+		if len(tokens) > 0 {
+			result[strings.Join(tokens, "\x00")]++
+		}
+		return result
+	}
+	for i := 0; i+3 <= len(tokens); i++ {
+		result[tokens[i]+"\x00"+tokens[i+1]+"\x00"+tokens[i+2]]++
+	}
+	return result
+}
+
+// lineDiffCount returns the number of lines added or removed between a and
+// b, like the +/- lines of a diff.
+func lineDiffCount(a, b string) int {
+	linesA, linesB := splitLines(a), splitLines(b)
+	for len(linesA) > 0 && len(linesB) > 0 && linesA[0] == linesB[0] {
+		linesA, linesB = linesA[1:], linesB[1:]
+	}
+	for len(linesA) > 0 && len(linesB) > 0 && linesA[len(linesA)-1] == linesB[len(linesB)-1] {
+		linesA, linesB = linesA[:len(linesA)-1], linesB[:len(linesB)-1]
+	}
+	if len(linesA) == 0 || len(linesB) == 0 {
+		return len(linesA) + len(linesB)
+	}
+	if len(linesA)*len(linesB) > maxLineDiffCells {
+		return multisetLineDiff(linesA, linesB)
+	}
+
+	// longest common subsequence, one row at a time
+	previous := make([]int, len(linesB)+1)
+	current := make([]int, len(linesB)+1)
+	for i := range linesA {
+		for j := range linesB {
+			switch {
+			case linesA[i] == linesB[j]:
+				current[j+1] = previous[j] + 1
+			case previous[j+1] > current[j]:
+				current[j+1] = previous[j+1]
+			default:
+				current[j+1] = current[j]
+			}
+		}
+		previous, current = current, previous
+	}
+	return len(linesA) + len(linesB) - 2*previous[len(linesB)]
+}
+
+func multisetLineDiff(linesA, linesB []string) int {
+	counts := make(map[string]int, len(linesA))
+	for _, line := range linesA {
+		counts[line]++
+	}
+	for _, line := range linesB {
+		counts[line]--
+	}
+	diff := 0
+	for _, count := range counts {
+		if count < 0 {
+			count = -count
+		}
+		diff += count
+	}
+	return diff
+}
+
+func splitLines(input string) []string {
+	if input == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(input, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// jsonDiff returns the sorted paths, like $.user.roles[1], at which the json
+// documents a and b differ. Objects are compared key by key and arrays index
+// by index.
+func jsonDiff(a, b string) ([]string, error) {
+	var valueA, valueB interface{}
+	if err := json.Unmarshal([]byte(a), &valueA); err != nil {
+		return nil, fmt.Errorf("invalid json: %v", err)
+	}
+	if err := json.Unmarshal([]byte(b), &valueB); err != nil {
+		return nil, fmt.Errorf("invalid json: %v", err)
+	}
+	paths := []string{}
+	collectJSONDiff("$", valueA, valueB, &paths)
+	sort.Strings(paths)
+	return paths, nil
+}
+
+var jsonIdentifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func collectJSONDiff(path string, a, b interface{}, paths *[]string) {
+	switch valueA := a.(type) {
+	case map[string]interface{}:
+		valueB, ok := b.(map[string]interface{})
+		if !ok {
+			*paths = append(*paths, path)
+			return
+		}
+		for key, item := range valueA {
+			other, ok := valueB[key]
+			if !ok {
+				*paths = append(*paths, jsonKeyPath(path, key))
+				continue
+			}
+			collectJSONDiff(jsonKeyPath(path, key), item, other, paths)
+		}
+		for key := range valueB {
+			if _, ok := valueA[key]; !ok {
+				*paths = append(*paths, jsonKeyPath(path, key))
+			}
+		}
+	case []interface{}:
+		valueB, ok := b.([]interface{})
+		if !ok {
+			*paths = append(*paths, path)
+			return
+		}
+		for i := 0; i < len(valueA) || i < len(valueB); i++ {
+			itemPath := path + "[" + strconv.Itoa(i) + "]"
+			if i >= len(valueA) || i >= len(valueB) {
+				*paths = append(*paths, itemPath)
+				continue
+			}
+			collectJSONDiff(itemPath, valueA[i], valueB[i], paths)
+		}
+	default:
+		if !reflect.DeepEqual(a, b) {
+			*paths = append(*paths, path)
+		}
+	}
+}
+
+func jsonKeyPath(path, key string) string {
+	if jsonIdentifierRegex.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
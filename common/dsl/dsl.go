@@ -14,6 +14,7 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -84,6 +85,8 @@ func ensureDefaultFunctions() {
 func refreshDefaultFunctions() {
 	DefaultHelperFunctions = buildHelperFunctions(functions)
 	FunctionNames = GetFunctionNames(DefaultHelperFunctions)
+	// cached expressions hold the functions they were compiled with
+	resetExpressionCache()
 }
 
 // IsFieldTransparent returns true if the named DSL function does not change
@@ -132,6 +135,10 @@ func MustAddFunction(function dslFunction) {
 func registerDefaultFunctions() {
 	// note: index helper is zero based
 	MustAddFunction(NewWithPositionalArgs("index", 2, false, func(args ...interface{}) (interface{}, error) {
+		// If the first argument is a map, we look the key up (e.g. jwt_decode)
+		if m, ok := args[0].(map[string]interface{}); ok {
+			return m[toString(args[1])], nil
+		}
 		index, err := strconv.ParseInt(toString(args[1]), 10, 64)
 		if err != nil {
 			return nil, err
@@ -144,6 +151,12 @@ func registerDefaultFunctions() {
 				return nil, fmt.Errorf("index out of range for %v: %d", v, index)
 			}
 			return v[index], nil
+		case []interface{}:
+			l := int64(len(v))
+			if index < 0 || index >= l {
+				return nil, fmt.Errorf("index out of range for %v: %d", v, index)
+			}
+			return v[index], nil
 		default:
 			// Otherwise, we index into the string
 			str := toString(v)
@@ -1163,91 +1176,61 @@ func registerDefaultFunctions() {
 			return result, nil
 		}))
 
-	//MustAddFunction(NewWithSingleSignature("generate_jwt",
-	//	"(jsonString, algorithm, optionalSignature string, optionalMaxAgeUnix interface{}) string",
-	//	false,
-	//	func(args ...interface{}) (interface{}, error) {
-	//		var algorithm string
-	//		var optionalSignature []byte
-	//		var optionalMaxAgeUnix time.Time
-	//
-	//		var signOpts []jwt.SignOption
-	//		var jsonData jwt.Map
-	//
-	//		argSize := len(args)
-	//
-	//		if argSize < 2 || argSize > 4 {
-	//			return nil, ErrInvalidDslFunction
-	//		}
-	//		jsonString := args[0].(string)
-	//
-	//		err := json.Unmarshal([]byte(jsonString), &jsonData)
-	//		if err != nil {
-	//			return nil, err
-	//		}
-	//
-	//		var jwtAlgorithm jwt.Alg
-	//		alg := args[1].(string)
-	//		algorithm = strings.ToUpper(alg)
-	//
-	//		switch algorithm {
-	//		case "":
-	//			jwtAlgorithm = jwt.NONE
-	//		case "HS256":
-	//			jwtAlgorithm = jwt.HS256
-	//		case "HS384":
-	//			jwtAlgorithm = jwt.HS384
-	//		case "HS512":
-	//			jwtAlgorithm = jwt.HS512
-	//		case "RS256":
-	//			jwtAlgorithm = jwt.RS256
-	//		case "RS384":
-	//			jwtAlgorithm = jwt.RS384
-	//		case "RS512":
-	//			jwtAlgorithm = jwt.RS512
-	//		case "PS256":
-	//			jwtAlgorithm = jwt.PS256
-	//		case "PS384":
-	//			jwtAlgorithm = jwt.PS384
-	//		case "PS512":
-	//			jwtAlgorithm = jwt.PS512
-	//		case "ES256":
-	//			jwtAlgorithm = jwt.ES256
-	//		case "ES384":
-	//			jwtAlgorithm = jwt.ES384
-	//		case "ES512":
-	//			jwtAlgorithm = jwt.ES512
-	//		case "EDDSA":
-	//			jwtAlgorithm = jwt.EdDSA
-	//		}
-	//
-	//		if isjwtAlgorithmNone(alg) {
-	//			jwtAlgorithm = &algNONE{algValue: alg}
-	//		}
-	//		if jwtAlgorithm == nil {
-	//			return nil, fmt.Errorf("invalid algorithm: %s", algorithm)
-	//		}
-	//
-	//		if argSize > 2 {
-	//			optionalSignature = []byte(args[2].(string))
-	//		}
-	//
-	//		if argSize > 3 {
-	//			times := make([]interface{}, 2)
-	//			times[0] = nil
-	//			times[1] = args[3]
-	//
-	//			optionalMaxAgeUnix, err = parseTimeOrNow(times)
-	//			if err != nil {
-	//				return nil, err
-	//			}
-	//
-	//			duration := time.Until(optionalMaxAgeUnix)
-	//			signOpts = append(signOpts, jwt.MaxAge(duration))
-	//		}
-	//
-	//		return jwt.Sign(jwtAlgorithm, optionalSignature, jsonData, signOpts...)
-	//	}))
+	MustAddFunction(NewWithSingleSignature("generate_jwt",
+		"(jsonString, algorithm, optionalSignature string, optionalMaxAgeUnix interface{}) string",
+		false,
+		func(args ...interface{}) (interface{}, error) {
+			argSize := len(args)
+			if argSize < 1 || argSize > 4 {
+				return nil, ErrInvalidDslFunction
+			}
+
+			var algorithm, optionalSignature string
+			if argSize > 1 {
+				algorithm = toString(args[1])
+			}
+			if argSize > 2 {
+				optionalSignature = toString(args[2])
+			}
+
+			var optionalMaxAgeUnix *time.Time
+			if argSize > 3 {
+				expiry, err := parseTimeOrNow([]interface{}{nil, args[3]})
+				if err != nil {
+					return nil, err
+				}
+				optionalMaxAgeUnix = &expiry
+			}
+
+			return generateJWT(toString(args[0]), algorithm, optionalSignature, optionalMaxAgeUnix)
+		}))
+	MustAddFunction(NewWithPositionalArgs("jwt_decode", 1, false, func(args ...interface{}) (interface{}, error) {
+		token, err := parseJWT(toString(args[0]))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"header": token.header, "claims": token.claims}, nil
+	}))
+	MustAddFunction(NewWithPositionalArgs("jwt_verify", 2, false, func(args ...interface{}) (interface{}, error) {
+		token, err := parseJWT(toString(args[0]))
+		if err != nil {
+			return false, nil
+		}
+		return token.verify(toString(args[1])), nil
+	}))
+	MustAddFunction(NewWithPositionalArgs("jwt_crack", 2, false, func(args ...interface{}) (interface{}, error) {
+		token, err := parseJWT(toString(args[0]))
+		if err != nil {
+			return nil, err
+		}
+		// returns the first secret the token verifies with, empty if none does
+		for _, secret := range jwtWordlist(args[1]) {
+			if token.verify(secret) {
+				return secret, nil
+			}
+		}
+		return "", nil
+	}))
 	MustAddFunction(NewWithPositionalArgs("json_minify", 1, false, func(args ...interface{}) (interface{}, error) {
 		var data map[string]interface{}
 
@@ -1273,6 +1256,18 @@ func registerDefaultFunctions() {
 
 		return buf.String(), nil
 	}))
+	MustAddFunction(NewWithPositionalArgs("json_diff", 2, false, func(args ...interface{}) (interface{}, error) {
+		return jsonDiff(toString(args[0]), toString(args[1]))
+	}))
+	MustAddFunction(NewWithPositionalArgs("similarity", 2, false, func(args ...interface{}) (interface{}, error) {
+		return similarity(toString(args[0]), toString(args[1])), nil
+	}))
+	MustAddFunction(NewWithPositionalArgs("line_diff_count", 2, false, func(args ...interface{}) (interface{}, error) {
+		return float64(lineDiffCount(toString(args[0]), toString(args[1]))), nil
+	}))
+	MustAddFunction(NewWithPositionalArgs("strip_dynamic", 1, false, func(args ...interface{}) (interface{}, error) {
+		return stripDynamic(toString(args[0])), nil
+	}))
 	//MustAddFunction(NewWithPositionalArgs("ip_format", 2, false, func(args ...interface{}) (interface{}, error) {
 	//	ipFormat, err := strconv.ParseInt(toString(args[1]), 10, 64)
 	//	if err != nil {
@@ -1294,29 +1289,66 @@ func registerDefaultFunctions() {
 	//	}
 	//	return llm.Query(prompt)
 	//}))
-	//MustAddFunction(NewWithPositionalArgs("unpack", 2, false, func(args ...interface{}) (interface{}, error) {
-	//	// format as string (ref: https://docs.python.org/3/library/struct.html#format-characters)
-	//	format, ok := args[0].(string)
-	//	if !ok {
-	//		return nil, errors.New("invalid format")
-	//	}
-	//	// binary packed data
-	//	data, ok := args[1].(string)
-	//	if !ok {
-	//		return nil, errors.New("invalid data")
-	//	}
-	//	// convert flat format into slice (eg. ">I" => [">","I"])
-	//	var formatParts []string
-	//	for idx := range format {
-	//		formatParts = append(formatParts, string(format[idx]))
-	//	}
-	//	// the dsl function supports unpacking only one type at a time
-	//	unpackedData, err := gostruct.UnPack(formatParts, []byte(data))
-	//	if len(unpackedData) > 0 {
-	//		return unpackedData[0], err
-	//	}
-	//	return nil, errors.New("no result")
-	//}))
+	MustAddFunction(NewWithSingleSignature("pack",
+		"(format string, args ...interface{}) string",
+		false,
+		func(args ...interface{}) (interface{}, error) {
+			if len(args) < 1 {
+				return nil, ErrInvalidDslFunction
+			}
+			return structPack(toString(args[0]), args[1:]...)
+		}))
+	MustAddFunction(NewWithPositionalArgs("unpack", 2, false, func(args ...interface{}) (interface{}, error) {
+		// format as string (ref: https://docs.python.org/3/library/struct.html#format-characters)
+		unpackedData, err := structUnpack(toString(args[0]), toString(args[1]))
+		if err != nil {
+			return nil, err
+		}
+		// a single value is returned as is, so it can be compared directly,
+		// several values as a list keeping their types
+		if len(unpackedData) == 1 {
+			return unpackedData[0], nil
+		}
+		return unpackedData, nil
+	}))
+	MustAddFunction(NewWithPositionalArgs("bytes_at", 3, false, func(args ...interface{}) (interface{}, error) {
+		offset, err := toStructInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		length, err := toStructInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+		return bytesAt(toString(args[0]), int(offset), int(length))
+	}))
+	MustAddFunction(NewWithSingleSignature("u16be",
+		"(data string, optionalOffset int) float64",
+		false,
+		func(args ...interface{}) (interface{}, error) {
+			return readUint(binary.BigEndian, 2, args...)
+		}))
+	MustAddFunction(NewWithSingleSignature("u16le",
+		"(data string, optionalOffset int) float64",
+		false,
+		func(args ...interface{}) (interface{}, error) {
+			return readUint(binary.LittleEndian, 2, args...)
+		}))
+	MustAddFunction(NewWithSingleSignature("u32be",
+		"(data string, optionalOffset int) float64",
+		false,
+		func(args ...interface{}) (interface{}, error) {
+			return readUint(binary.BigEndian, 4, args...)
+		}))
+	MustAddFunction(NewWithSingleSignature("u32le",
+		"(data string, optionalOffset int) float64",
+		false,
+		func(args ...interface{}) (interface{}, error) {
+			return readUint(binary.LittleEndian, 4, args...)
+		}))
+	MustAddFunction(NewWithPositionalArgs("len_prefix", 2, false, func(args ...interface{}) (interface{}, error) {
+		return lenPrefix(toString(args[0]), toString(args[1]))
+	}))
 	MustAddFunction(NewWithSingleSignature("xor",
 		"(args ...interface{}) interface{}",
 		false,
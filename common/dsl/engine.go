@@ -14,14 +14,14 @@ var (
 
 type Engine struct {
 	HelperFunctions map[string]govaluate.ExpressionFunction
-	ExpressionStore map[string]*govaluate.EvaluableExpression
+	ExpressionStore map[string]*Expression
 	exprmux         sync.RWMutex
 }
 
 func NewEngine() (*Engine, error) {
 	engine := &Engine{
 		HelperFunctions: HelperFunctions(),
-		ExpressionStore: make(map[string]*govaluate.EvaluableExpression),
+		ExpressionStore: make(map[string]*Expression),
 	}
 	return engine, nil
 }
@@ -29,7 +29,7 @@ func NewEngine() (*Engine, error) {
 func (e *Engine) EvalExpr(expr string, vars map[string]interface{}) (interface{}, error) {
 	e.exprmux.Lock()
 	defer e.exprmux.Unlock()
-	compiled, err := govaluate.NewEvaluableExpressionWithFunctions(expr, e.HelperFunctions)
+	compiled, err := NewExpression(expr, e.HelperFunctions)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,492 @@
+package dsl
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+
+	"github.com/Knetic/govaluate"
+)
+
+const (
+	logicalErrorFormat    = "Value '%v' cannot be used with the logical operator '%v', it is not a bool"
+	modifierErrorFormat   = "Value '%v' cannot be used with the modifier '%v', it is not a number"
+	comparatorErrorFormat = "Value '%v' cannot be used with the comparator '%v', it is not a number"
+	ternaryErrorFormat    = "Value '%v' cannot be used with the ternary operator '%v', it is not a bool"
+	prefixErrorFormat     = "Value '%v' cannot be used with the prefix '%v'"
+)
+
+// maxCachedExpressions bounds the compiled expression cache. Resolved
+// placeholders may embed response data, so the set of expressions is not
+// bounded by the templates alone.
+const maxCachedExpressions = 4096
+
+var expressionCache = struct {
+	sync.RWMutex
+	entries map[string]cachedExpression
+}{entries: make(map[string]cachedExpression)}
+
+type cachedExpression struct {
+	expression *Expression
+	err        error
+}
+
+type evalFunc func(params map[string]interface{}) (interface{}, error)
+
+// Expression is a DSL expression compiled by neutron's own engine. It is a
+// drop-in replacement for govaluate.EvaluableExpression: it accepts the same
+// syntax, the same helper function registry and returns the same value types.
+type Expression struct {
+	source    string
+	root      *Node
+	eval      evalFunc
+	vars      []string
+	functions []string
+}
+
+// NewExpression parses expression and resolves its function calls against
+// functions.
+func NewExpression(expression string, functions map[string]govaluate.ExpressionFunction) (*Expression, error) {
+	root, err := parse(expression, true)
+	if err != nil {
+		return nil, err
+	}
+	e := &Expression{source: expression, root: root}
+	if e.eval, err = e.compile(root, functions); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// CompileExpression compiles expression with the default helper functions.
+// Compiled expressions, and compile errors, are cached by source.
+func CompileExpression(expression string) (*Expression, error) {
+	ensureDefaultFunctions()
+
+	expressionCache.RLock()
+	cached, ok := expressionCache.entries[expression]
+	expressionCache.RUnlock()
+	if ok {
+		return cached.expression, cached.err
+	}
+
+	compiled, err := NewExpression(expression, DefaultHelperFunctions)
+	expressionCache.Lock()
+	if len(expressionCache.entries) >= maxCachedExpressions {
+		expressionCache.entries = make(map[string]cachedExpression)
+	}
+	expressionCache.entries[expression] = cachedExpression{expression: compiled, err: err}
+	expressionCache.Unlock()
+	return compiled, err
+}
+
+func resetExpressionCache() {
+	expressionCache.Lock()
+	expressionCache.entries = make(map[string]cachedExpression)
+	expressionCache.Unlock()
+}
+
+// Evaluate runs the expression against params.
+func (e *Expression) Evaluate(params map[string]interface{}) (interface{}, error) {
+	return e.eval(params)
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Root returns the parsed AST of the expression.
+func (e *Expression) Root() *Node {
+	return e.root
+}
+
+// Vars returns the variables referenced by the expression, in order of appearance.
+func (e *Expression) Vars() []string {
+	return e.vars
+}
+
+// Functions returns the helper functions called by the expression, in order of appearance.
+func (e *Expression) Functions() []string {
+	return e.functions
+}
+
+func (e *Expression) compile(node *Node, functions map[string]govaluate.ExpressionFunction) (evalFunc, error) {
+	children := make([]evalFunc, len(node.Children))
+	for i, child := range node.Children {
+		compiled, err := e.compile(child, functions)
+		if err != nil {
+			return nil, err
+		}
+		children[i] = compiled
+	}
+
+	switch node.Type {
+	case NodeLiteral:
+		value := node.Value
+		return func(map[string]interface{}) (interface{}, error) {
+			return value, nil
+		}, nil
+	case NodeVariable:
+		name := node.Value.(string)
+		e.vars = appendUnique(e.vars, name)
+		return func(params map[string]interface{}) (interface{}, error) {
+			value, ok := params[name]
+			if !ok {
+				return nil, errors.New("No parameter '" + name + "' found.")
+			}
+			return castToFloat64(value), nil
+		}, nil
+	case NodeCall:
+		function, ok := functions[node.FuncName]
+		if !ok {
+			return nil, fmt.Errorf("Undefined function %s", node.FuncName)
+		}
+		e.functions = appendUnique(e.functions, node.FuncName)
+		return func(params map[string]interface{}) (interface{}, error) {
+			args := make([]interface{}, len(children))
+			for i, child := range children {
+				value, err := child(params)
+				if err != nil {
+					return nil, err
+				}
+				args[i] = value
+			}
+			return function(args...)
+		}, nil
+	case NodeList:
+		return func(params map[string]interface{}) (interface{}, error) {
+			items := make([]interface{}, len(children))
+			for i, child := range children {
+				value, err := child(params)
+				if err != nil {
+					return nil, err
+				}
+				items[i] = value
+			}
+			return items, nil
+		}, nil
+	case NodeUnaryOp:
+		return compileUnary(node.Op, children[0])
+	case NodeTernary:
+		return compileTernary(children), nil
+	case NodeBinaryOp:
+		return compileBinary(node.Op, children[0], children[1])
+	}
+	return nil, fmt.Errorf("unsupported expression node %s", node)
+}
+
+func compileUnary(op string, operand evalFunc) (evalFunc, error) {
+	switch op {
+	case "!":
+		return func(params map[string]interface{}) (interface{}, error) {
+			value, err := operand(params)
+			if err != nil {
+				return nil, err
+			}
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf(prefixErrorFormat, value, op)
+			}
+			return !b, nil
+		}, nil
+	case "-", "~":
+		return func(params map[string]interface{}) (interface{}, error) {
+			value, err := operand(params)
+			if err != nil {
+				return nil, err
+			}
+			n, ok := toFloat64(value)
+			if !ok {
+				return nil, fmt.Errorf(prefixErrorFormat, value, op)
+			}
+			if op == "-" {
+				return -n, nil
+			}
+			return float64(^int64(n)), nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported prefix %s", op)
+}
+
+func compileTernary(children []evalFunc) evalFunc {
+	return func(params map[string]interface{}) (interface{}, error) {
+		value, err := children[0](params)
+		if err != nil {
+			return nil, err
+		}
+		cond, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf(ternaryErrorFormat, value, "?")
+		}
+		if cond {
+			return children[1](params)
+		}
+		if len(children) > 2 {
+			return children[2](params)
+		}
+		return nil, nil
+	}
+}
+
+func compileBinary(op string, left, right evalFunc) (evalFunc, error) {
+	switch op {
+	case "&&", "||":
+		// the right operand is only evaluated when it decides the result
+		return func(params map[string]interface{}) (interface{}, error) {
+			value, err := left(params)
+			if err != nil {
+				return nil, err
+			}
+			l, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf(logicalErrorFormat, value, op)
+			}
+			if l == (op == "||") {
+				return l, nil
+			}
+			if value, err = right(params); err != nil {
+				return nil, err
+			}
+			r, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf(logicalErrorFormat, value, op)
+			}
+			return r, nil
+		}, nil
+	case "??":
+		return func(params map[string]interface{}) (interface{}, error) {
+			// a missing parameter falls back to the right operand as well
+			if value, err := left(params); err == nil && value != nil {
+				return value, nil
+			}
+			return right(params)
+		}, nil
+	}
+
+	operator, ok := binaryOperators[op]
+	if !ok {
+		return nil, fmt.Errorf("unsupported operator %s", op)
+	}
+	return func(params map[string]interface{}) (interface{}, error) {
+		l, err := left(params)
+		if err != nil {
+			return nil, err
+		}
+		r, err := right(params)
+		if err != nil {
+			return nil, err
+		}
+		return operator(op, l, r)
+	}, nil
+}
+
+var binaryOperators = map[string]func(op string, left, right interface{}) (interface{}, error){
+	"==": func(op string, left, right interface{}) (interface{}, error) { return valuesEqual(left, right), nil },
+	"!=": func(op string, left, right interface{}) (interface{}, error) { return !valuesEqual(left, right), nil },
+	">":  compareValues,
+	">=": compareValues,
+	"<":  compareValues,
+	"<=": compareValues,
+	"=~": matchRegex,
+	"!~": matchRegex,
+	"in": func(op string, left, right interface{}) (interface{}, error) {
+		items, ok := right.([]interface{})
+		if !ok {
+			if items = toInterfaceSlice(right); items == nil {
+				return nil, fmt.Errorf("Value '%v' cannot be used with the comparator '%v', it is not a list", right, op)
+			}
+		}
+		for _, item := range items {
+			if valuesEqual(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	},
+	"+": func(op string, left, right interface{}) (interface{}, error) {
+		// string concat if either are strings
+		_, leftString := toText(left)
+		_, rightString := toText(right)
+		if leftString || rightString {
+			return toString(left) + toString(right), nil
+		}
+		return arithmetic(op, left, right)
+	},
+	"-":  arithmetic,
+	"*":  arithmetic,
+	"/":  arithmetic,
+	"%":  arithmetic,
+	"**": arithmetic,
+	"&":  arithmetic,
+	"|":  arithmetic,
+	"^":  arithmetic,
+	"<<": arithmetic,
+	">>": arithmetic,
+}
+
+func arithmetic(op string, left, right interface{}) (interface{}, error) {
+	l, ok := toFloat64(left)
+	if !ok {
+		return nil, fmt.Errorf(modifierErrorFormat, left, op)
+	}
+	r, ok := toFloat64(right)
+	if !ok {
+		return nil, fmt.Errorf(modifierErrorFormat, right, op)
+	}
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		return l / r, nil
+	case "%":
+		return math.Mod(l, r), nil
+	case "**":
+		return math.Pow(l, r), nil
+	case "&":
+		return float64(int64(l) & int64(r)), nil
+	case "|":
+		return float64(int64(l) | int64(r)), nil
+	case "^":
+		return float64(int64(l) ^ int64(r)), nil
+	case "<<":
+		return float64(uint64(l) << uint64(r)), nil
+	default:
+		return float64(uint64(l) >> uint64(r)), nil
+	}
+}
+
+func compareValues(op string, left, right interface{}) (interface{}, error) {
+	if l, ok := toText(left); ok {
+		if r, ok := toText(right); ok {
+			switch op {
+			case ">":
+				return l > r, nil
+			case ">=":
+				return l >= r, nil
+			case "<":
+				return l < r, nil
+			default:
+				return l <= r, nil
+			}
+		}
+	}
+	l, ok := toFloat64(left)
+	if !ok {
+		return nil, fmt.Errorf(comparatorErrorFormat, left, op)
+	}
+	r, ok := toFloat64(right)
+	if !ok {
+		return nil, fmt.Errorf(comparatorErrorFormat, right, op)
+	}
+	switch op {
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	case "<":
+		return l < r, nil
+	default:
+		return l <= r, nil
+	}
+}
+
+func matchRegex(op string, left, right interface{}) (interface{}, error) {
+	pattern, ok := toText(right)
+	if !ok {
+		return nil, fmt.Errorf(comparatorErrorFormat, right, op)
+	}
+	compiled, err := Regex(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to compile regexp pattern '%v': %v", pattern, err)
+	}
+	matched := compiled.MatchString(toString(left))
+	return matched == (op == "=~"), nil
+}
+
+// valuesEqual compares numbers by value whatever their go type, strings and
+// bytes by content, and everything else deeply.
+func valuesEqual(left, right interface{}) bool {
+	if l, ok := toFloat64(left); ok {
+		r, ok := toFloat64(right)
+		return ok && l == r
+	}
+	if l, ok := toText(left); ok {
+		r, ok := toText(right)
+		return ok && l == r
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func toText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	if n, ok := castToFloat64(value).(float64); ok {
+		return n, true
+	}
+	return 0, false
+}
+
+func toInterfaceSlice(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		return items
+	}
+	return nil
+}
+
+// castToFloat64 normalises go numbers the way govaluate does for parameters.
+func castToFloat64(value interface{}) interface{} {
+	switch v := value.(type) {
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return value
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,228 @@
+package dsl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Knetic/govaluate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpressionOperators(t *testing.T) {
+	params := map[string]interface{}{
+		"status_code":    200,
+		"body":           "<title>Admin</title>",
+		"raw":            []byte("HTTP/1.1 200 OK"),
+		"content_length": int64(1024),
+		"header-name":    "x",
+		"list":           []string{"a", "b"},
+		"nothing":        nil,
+	}
+	expressions := map[string]interface{}{
+		`status_code == 200 && contains(body, "Admin")`: true,
+		`1 + 2 * 3`:                              float64(7),
+		`(1 + 2) * 3`:                            float64(9),
+		`2 ** 3 ** 2`:                            float64(64),
+		`-content_length + 24`:                   float64(-1000),
+		`10 % 4`:                                 float64(2),
+		`0xff & 0x0f | 0x30`:                     float64(63),
+		`1 << 4 >> 2`:                            float64(4),
+		`~0`:                                     float64(-1),
+		`"status: " + status_code`:               "status: 200",
+		`raw == "HTTP/1.1 200 OK"`:               true,
+		`"b" > "a" && content_length >= 1024`:    true,
+		`body =~ "<title>[A-Z]"`:                 true,
+		`body !~ "(?i)login"`:                    true,
+		`status_code in (301, 302, 200)`:         true,
+		`"c" in list`:                            false,
+		`status_code == 200 ? "ok" : "ko"`:       "ok",
+		`status_code != 200 ? "ok"`:              nil,
+		`nothing ?? "default"`:                   "default",
+		`missing ?? body`:                        "<title>Admin</title>",
+		`[header-name] == "x"`:                   true,
+		`!!true`:                                 true,
+		`len(body) > 10 && !contains(body, "x")`: true,
+	}
+	for expression, expected := range expressions {
+		compiled, err := CompileExpression(expression)
+		require.Nil(t, err, "could not compile %s", expression)
+		result, err := compiled.Evaluate(params)
+		require.Nil(t, err, "could not evaluate %s", expression)
+		require.Equal(t, expected, result, expression)
+	}
+}
+
+func TestExpressionShortCircuit(t *testing.T) {
+	var calls int
+	functions := map[string]govaluate.ExpressionFunction{
+		"count": func(args ...interface{}) (interface{}, error) {
+			calls++
+			return true, nil
+		},
+		"fail": func(args ...interface{}) (interface{}, error) {
+			return nil, errors.New("should not be evaluated")
+		},
+	}
+	for expression, expected := range map[string]interface{}{
+		`false && fail()`:        false,
+		`true || fail()`:         true,
+		`count() || fail()`:      true,
+		`false ? fail() : "no"`:  "no",
+		`"set" ?? fail()`:        "set",
+		`count() && missing_var`: nil,
+	} {
+		compiled, err := NewExpression(expression, functions)
+		require.Nil(t, err)
+		result, err := compiled.Evaluate(nil)
+		if expected == nil {
+			require.NotNil(t, err)
+			require.True(t, strings.HasPrefix(err.Error(), "No parameter"), err.Error())
+			continue
+		}
+		require.Nil(t, err, expression)
+		require.Equal(t, expected, result, expression)
+	}
+	require.Equal(t, 2, calls)
+}
+
+func TestExpressionErrors(t *testing.T) {
+	_, err := CompileExpression(`contians(body, "x")`)
+	require.EqualError(t, err, "Undefined function contians")
+
+	_, err = CompileExpression(`contains(body, "x"`)
+	require.NotNil(t, err)
+
+	compiled, err := CompileExpression(`body == "x"`)
+	require.Nil(t, err)
+	_, err = compiled.Evaluate(map[string]interface{}{})
+	require.EqualError(t, err, "No parameter 'body' found.")
+
+	compiled, err = CompileExpression(`"a" && true`)
+	require.Nil(t, err)
+	_, err = compiled.Evaluate(nil)
+	require.NotNil(t, err)
+}
+
+func TestExpressionCache(t *testing.T) {
+	first, err := CompileExpression(`to_upper(body) == "X"`)
+	require.Nil(t, err)
+	second, err := CompileExpression(`to_upper(body) == "X"`)
+	require.Nil(t, err)
+	require.True(t, first == second, "expected the cached expression to be reused")
+	require.Equal(t, []string{"body"}, first.Vars())
+	require.Equal(t, []string{"to_upper"}, first.Functions())
+
+	// registering a helper invalidates expressions compiled without it
+	_, err = CompileExpression(`neutron_cache_test()`)
+	require.NotNil(t, err)
+	require.Nil(t, AddFunction(NewWithPositionalArgs("neutron_cache_test", 0, false, func(args ...interface{}) (interface{}, error) {
+		return "ok", nil
+	})))
+	compiled, err := CompileExpression(`neutron_cache_test()`)
+	require.Nil(t, err)
+	result, err := compiled.Evaluate(nil)
+	require.Nil(t, err)
+	require.Equal(t, "ok", result)
+}
+
+// engineCorpus returns the expressions of TestDslExpressions that are cheap
+// and free of side effects.
+func engineCorpus() []string {
+	var corpus []string
+	for expression := range dslExpressions() {
+		if strings.Contains(expression, "wait_for") || strings.Contains(expression, "print_debug") {
+			continue
+		}
+		corpus = append(corpus, expression)
+	}
+	return corpus
+}
+
+func TestExpressionParityWithGovaluate(t *testing.T) {
+	for _, expression := range engineCorpus() {
+		reference, err := govaluate.NewEvaluableExpressionWithFunctions(expression, DefaultHelperFunctions)
+		require.Nil(t, err, expression)
+		expected, err := reference.Evaluate(nil)
+		require.Nil(t, err, expression)
+
+		compiled, err := CompileExpression(expression)
+		require.Nil(t, err, expression)
+		actual, err := compiled.Evaluate(nil)
+		require.Nil(t, err, expression)
+		require.Equal(t, expected, actual, expression)
+	}
+}
+
+// TestExpressionEscapes pins the documented divergence from govaluate on
+// escapes in string literals, and the escapes both engines agree on.
+func TestExpressionEscapes(t *testing.T) {
+	for expression, expected := range map[string][2]string{
+		`"a\nb"`:       {"a\nb", "anb"},
+		`"\r\t\0"`:     {"\r\t\x00", "rt0"},
+		`"\x41\x4g"`:   {"Ax4g", "x41x4g"},
+		`"say \"hi\""`: {`say "hi"`, `say "hi"`},
+		`'it\'s'`:      {"it's", "it's"},
+		`"back\\"`:     {`back\`, `back\`},
+		`"\é"`:         {"é", "é"},
+	} {
+		compiled, err := CompileExpression(expression)
+		require.Nil(t, err, expression)
+		actual, err := compiled.Evaluate(nil)
+		require.Nil(t, err, expression)
+		require.Equal(t, expected[0], actual, expression)
+
+		reference, err := govaluate.NewEvaluableExpression(expression)
+		require.Nil(t, err, expression)
+		actual, err = reference.Evaluate(nil)
+		require.Nil(t, err, expression)
+		require.Equal(t, expected[1], actual, expression)
+	}
+}
+
+func BenchmarkExpressionEngines(b *testing.B) {
+	corpus := engineCorpus()
+	params := map[string]interface{}{}
+
+	b.Run("neutron/evaluate", func(b *testing.B) {
+		compiled := make([]*Expression, len(corpus))
+		for i, expression := range corpus {
+			compiled[i], _ = NewExpression(expression, DefaultHelperFunctions)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, expression := range compiled {
+				_, _ = expression.Evaluate(params)
+			}
+		}
+	})
+	b.Run("govaluate/evaluate", func(b *testing.B) {
+		compiled := make([]*govaluate.EvaluableExpression, len(corpus))
+		for i, expression := range corpus {
+			compiled[i], _ = govaluate.NewEvaluableExpressionWithFunctions(expression, DefaultHelperFunctions)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, expression := range compiled {
+				_, _ = expression.Evaluate(params)
+			}
+		}
+	})
+	// placeholders used to be recompiled on every request
+	b.Run("neutron/compile+evaluate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, expression := range corpus {
+				compiled, _ := CompileExpression(expression)
+				_, _ = compiled.Evaluate(params)
+			}
+		}
+	})
+	b.Run("govaluate/compile+evaluate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, expression := range corpus {
+				compiled, _ := govaluate.NewEvaluableExpressionWithFunctions(expression, DefaultHelperFunctions)
+				_, _ = compiled.Evaluate(params)
+			}
+		}
+	})
+}
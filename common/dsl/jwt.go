@@ -0,0 +1,153 @@
+package dsl
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidJWT = errors.New("invalid jwt token")
+
+	jwtEncoding = base64.RawURLEncoding
+)
+
+// jwtHMAC returns the hash used by a HMAC jwt algorithm, nil if alg is not one.
+func jwtHMAC(alg string) func() hash.Hash {
+	switch strings.ToUpper(alg) {
+	case "HS256":
+		return sha256.New
+	case "HS384":
+		return sha512.New384
+	case "HS512":
+		return sha512.New
+	}
+	return nil
+}
+
+// generateJWT signs claims with alg. The claims are kept in the order the
+// template wrote them unless an expiry has to be added. Any spelling of
+// "none" is kept as-is in the header, which is what alg:none bypasses rely on.
+func generateJWT(claims, alg, secret string, expiry *time.Time) (string, error) {
+	var claimsMap map[string]interface{}
+	if err := json.Unmarshal([]byte(claims), &claimsMap); err != nil {
+		return "", err
+	}
+
+	var algValue string
+	newHash := jwtHMAC(alg)
+	switch {
+	case newHash != nil:
+		algValue = strings.ToUpper(alg)
+	case isjwtAlgorithmNone(alg):
+		algValue = (&algNONE{algValue: strings.TrimSpace(alg)}).Name()
+	case alg == "":
+		algValue = "none"
+	default:
+		return "", fmt.Errorf("invalid algorithm: %s", alg)
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": algValue, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	var payload []byte
+	if expiry != nil {
+		claimsMap["exp"] = expiry.Unix()
+		if _, ok := claimsMap["iat"]; !ok {
+			claimsMap["iat"] = time.Now().Unix()
+		}
+		if payload, err = json.Marshal(claimsMap); err != nil {
+			return "", err
+		}
+	} else {
+		buf := &bytes.Buffer{}
+		if err = json.Compact(buf, []byte(claims)); err != nil {
+			return "", err
+		}
+		payload = buf.Bytes()
+	}
+
+	signingInput := jwtEncoding.EncodeToString(header) + "." + jwtEncoding.EncodeToString(payload)
+	if newHash == nil {
+		return signingInput + ".", nil
+	}
+	return signingInput + "." + jwtEncoding.EncodeToString(jwtSign(newHash, signingInput, secret)), nil
+}
+
+func jwtSign(newHash func() hash.Hash, signingInput, secret string) []byte {
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+type jwtToken struct {
+	header       map[string]interface{}
+	claims       map[string]interface{}
+	signingInput string
+	signature    []byte
+}
+
+func (t *jwtToken) alg() string {
+	alg, _ := t.header["alg"].(string)
+	return alg
+}
+
+func parseJWT(token string) (*jwtToken, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, errInvalidJWT
+	}
+	parsed := &jwtToken{signingInput: parts[0] + "." + parts[1]}
+	for i, dst := range []*map[string]interface{}{&parsed.header, &parsed.claims} {
+		data, err := jwtEncoding.DecodeString(strings.TrimRight(parts[i], "="))
+		if err != nil {
+			return nil, errInvalidJWT
+		}
+		if err := json.Unmarshal(data, dst); err != nil {
+			return nil, errInvalidJWT
+		}
+	}
+	signature, err := jwtEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	if err != nil {
+		return nil, errInvalidJWT
+	}
+	parsed.signature = signature
+	return parsed, nil
+}
+
+// verify checks the HMAC signature with secret. No secret verifies an
+// alg:none token, which is unsigned, nor a token of another algorithm.
+func (t *jwtToken) verify(secret string) bool {
+	alg := t.alg()
+	newHash := jwtHMAC(alg)
+	if newHash == nil {
+		return false
+	}
+	return hmac.Equal(t.signature, jwtSign(newHash, t.signingInput, secret))
+}
+
+// jwtWordlist flattens the value of a wordlist variable: a payload list or
+// a newline separated string.
+func jwtWordlist(v interface{}) []string {
+	switch vv := v.(type) {
+	case []interface{}:
+		words := make([]string, 0, len(vv))
+		for _, item := range vv {
+			words = append(words, toString(item))
+		}
+		return words
+	case string:
+		return strings.Split(strings.Replace(vv, "\r\n", "\n", -1), "\n")
+	}
+	return toStringSlice(v)
+}
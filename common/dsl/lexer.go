@@ -8,22 +8,40 @@ import (
 type TokenType int
 
 const (
-	TIdent  TokenType = iota // body, contains, status_code
-	TString                  // "value" or 'value'
-	TNumber                  // 200, 3.14
-	TBool                    // true, false
-	TLParen                  // (
-	TRParen                  // )
-	TComma                   // ,
-	TAnd                     // &&
-	TOr                      // ||
-	TEq                      // ==
-	TNeq                     // !=
-	TGt                      // >
-	TGte                     // >=
-	TLt                      // <
-	TLte                     // <=
-	TNot                     // !
+	TIdent    TokenType = iota // body, contains, status_code
+	TString                    // "value" or 'value'
+	TNumber                    // 200, 3.14
+	TBool                      // true, false
+	TLParen                    // (
+	TRParen                    // )
+	TComma                     // ,
+	TAnd                       // &&
+	TOr                        // ||
+	TEq                        // ==
+	TNeq                       // !=
+	TGt                        // >
+	TGte                       // >=
+	TLt                        // <
+	TLte                       // <=
+	TNot                       // !
+	TPlus                      // +
+	TMinus                     // -
+	TStar                      // *
+	TSlash                     // /
+	TPercent                   // %
+	TPow                       // **
+	TBitAnd                    // &
+	TBitOr                     // |
+	TBitXor                    // ^
+	TBitNot                    // ~
+	TShl                       // <<
+	TShr                       // >>
+	TMatch                     // =~
+	TNotMatch                  // !~
+	TQuestion                  // ?
+	TColon                     // :
+	TCoalesce                  // ??
+	TIn                        // in, IN
 	TEOF
 )
 
@@ -50,7 +68,7 @@ func Lex(input string) ([]Token, error) {
 		ch := runes[i]
 
 		switch {
-		case ch == '(' :
+		case ch == '(':
 			tokens = append(tokens, Token{TLParen, "(", pos})
 			i++
 		case ch == ')':
@@ -59,33 +77,24 @@ func Lex(input string) ([]Token, error) {
 		case ch == ',':
 			tokens = append(tokens, Token{TComma, ",", pos})
 			i++
-		case ch == '&' && i+1 < len(runes) && runes[i+1] == '&':
-			tokens = append(tokens, Token{TAnd, "&&", pos})
+		case i+1 < len(runes) && isOperatorPair(ch, runes[i+1]):
+			op := string(runes[i : i+2])
+			tokens = append(tokens, Token{operatorPairs[op], op, pos})
 			i += 2
-		case ch == '|' && i+1 < len(runes) && runes[i+1] == '|':
-			tokens = append(tokens, Token{TOr, "||", pos})
-			i += 2
-		case ch == '=' && i+1 < len(runes) && runes[i+1] == '=':
-			tokens = append(tokens, Token{TEq, "==", pos})
-			i += 2
-		case ch == '!' && i+1 < len(runes) && runes[i+1] == '=':
-			tokens = append(tokens, Token{TNeq, "!=", pos})
-			i += 2
-		case ch == '>' && i+1 < len(runes) && runes[i+1] == '=':
-			tokens = append(tokens, Token{TGte, ">=", pos})
-			i += 2
-		case ch == '<' && i+1 < len(runes) && runes[i+1] == '=':
-			tokens = append(tokens, Token{TLte, "<=", pos})
-			i += 2
-		case ch == '>':
-			tokens = append(tokens, Token{TGt, ">", pos})
-			i++
-		case ch == '<':
-			tokens = append(tokens, Token{TLt, "<", pos})
-			i++
-		case ch == '!':
-			tokens = append(tokens, Token{TNot, "!", pos})
+		case isOperator(ch):
+			tokens = append(tokens, Token{operators[ch], string(ch), pos})
 			i++
+		case ch == '[':
+			// [name-with-dashes] escapes a variable name, as in govaluate
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated variable name at position %d", pos)
+			}
+			tokens = append(tokens, Token{TIdent, string(runes[i+1 : end]), pos})
+			i = end + 1
 		case ch == '"' || ch == '\'':
 			s, end, err := lexString(runes, i)
 			if err != nil {
@@ -101,6 +110,8 @@ func Lex(input string) ([]Token, error) {
 			s, end := lexIdent(runes, i)
 			if s == "true" || s == "false" {
 				tokens = append(tokens, Token{TBool, s, pos})
+			} else if s == "in" || s == "IN" {
+				tokens = append(tokens, Token{TIn, s, pos})
 			} else {
 				tokens = append(tokens, Token{TIdent, s, pos})
 			}
@@ -147,7 +158,7 @@ func lexString(runes []rune, start int) (string, int, error) {
 				buf = append(buf, 0)
 				i += 2
 			default:
-				buf = append(buf, byte(next))
+				buf = append(buf, string(next)...)
 				i += 2
 			}
 			continue
@@ -174,8 +185,36 @@ func hexDigitVal(r rune) int {
 	}
 }
 
+var (
+	operatorPairs = map[string]TokenType{
+		"&&": TAnd, "||": TOr, "==": TEq, "!=": TNeq, ">=": TGte, "<=": TLte,
+		"**": TPow, "<<": TShl, ">>": TShr, "=~": TMatch, "!~": TNotMatch, "??": TCoalesce,
+	}
+	operators = map[rune]TokenType{
+		'>': TGt, '<': TLt, '!': TNot, '+': TPlus, '-': TMinus, '*': TStar, '/': TSlash,
+		'%': TPercent, '&': TBitAnd, '|': TBitOr, '^': TBitXor, '~': TBitNot, '?': TQuestion, ':': TColon,
+	}
+)
+
+func isOperatorPair(first, second rune) bool {
+	_, ok := operatorPairs[string([]rune{first, second})]
+	return ok
+}
+
+func isOperator(ch rune) bool {
+	_, ok := operators[ch]
+	return ok
+}
+
 func lexNumber(runes []rune, start int) (string, int) {
 	i := start
+	if runes[i] == '0' && i+2 < len(runes) && (runes[i+1] == 'x' || runes[i+1] == 'X') && hexDigitVal(runes[i+2]) >= 0 {
+		i += 2
+		for i < len(runes) && hexDigitVal(runes[i]) >= 0 {
+			i++
+		}
+		return string(runes[start:i]), i
+	}
 	for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
 		i++
 	}
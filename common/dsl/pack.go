@@ -0,0 +1,297 @@
+package dsl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// structField is a single item of a python struct format string, e.g. the
+// "4s" of ">H4s".
+type structField struct {
+	kind  byte
+	count int
+}
+
+var structSizes = map[byte]int{
+	'x': 1, 'c': 1, 'b': 1, 'B': 1, '?': 1,
+	'h': 2, 'H': 2,
+	'i': 4, 'I': 4, 'l': 4, 'L': 4, 'f': 4,
+	'q': 8, 'Q': 8, 'd': 8,
+	's': 1,
+}
+
+// maxStructCount bounds the repeat count of a struct format item, so a
+// format like "999999999x" cannot allocate without limit.
+const maxStructCount = 1 << 16
+
+// parseStructFormat parses a python struct format (ref: https://docs.python.org/3/library/struct.html).
+// Standard sizes are always used and there is no alignment; native order
+// ("@", "=" or none) is little endian.
+func parseStructFormat(format string) (binary.ByteOrder, []structField, error) {
+	var order binary.ByteOrder = binary.LittleEndian
+	if format != "" {
+		switch format[0] {
+		case '>', '!':
+			order = binary.BigEndian
+			format = format[1:]
+		case '<', '@', '=':
+			format = format[1:]
+		}
+	}
+
+	var fields []structField
+	count := -1
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		switch {
+		case c == ' ':
+			continue
+		case c >= '0' && c <= '9':
+			if count < 0 {
+				count = 0
+			}
+			if count = count*10 + int(c-'0'); count > maxStructCount {
+				return nil, nil, fmt.Errorf("struct format repeat count exceeds %d", maxStructCount)
+			}
+			continue
+		}
+		if _, ok := structSizes[c]; !ok {
+			return nil, nil, fmt.Errorf("invalid struct format character %q", c)
+		}
+		if count < 0 {
+			count = 1
+		}
+		fields = append(fields, structField{kind: c, count: count})
+		count = -1
+	}
+	if count >= 0 {
+		return nil, nil, fmt.Errorf("struct format %q ends with a repeat count", format)
+	}
+	return order, fields, nil
+}
+
+// structPack packs values following format, like python's struct.pack.
+func structPack(format string, values ...interface{}) (string, error) {
+	order, fields, err := parseStructFormat(format)
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	next := 0
+	value := func() (interface{}, error) {
+		if next >= len(values) {
+			return nil, fmt.Errorf("not enough arguments for struct format %q", format)
+		}
+		next++
+		return values[next-1], nil
+	}
+	for _, field := range fields {
+		switch field.kind {
+		case 'x':
+			buf.Write(make([]byte, field.count))
+			continue
+		case 's':
+			v, err := value()
+			if err != nil {
+				return "", err
+			}
+			data := []byte(toString(v))
+			if len(data) > field.count {
+				data = data[:field.count]
+			}
+			buf.Write(data)
+			buf.Write(make([]byte, field.count-len(data)))
+			continue
+		}
+		for i := 0; i < field.count; i++ {
+			v, err := value()
+			if err != nil {
+				return "", err
+			}
+			if err := packValue(buf, order, field.kind, v); err != nil {
+				return "", err
+			}
+		}
+	}
+	if next != len(values) {
+		return "", fmt.Errorf("too many arguments for struct format %q", format)
+	}
+	return buf.String(), nil
+}
+
+func packValue(buf *bytes.Buffer, order binary.ByteOrder, kind byte, v interface{}) error {
+	switch kind {
+	case 'c':
+		s := toString(v)
+		if len(s) != 1 {
+			return fmt.Errorf("struct format 'c' requires a single byte, got %q", s)
+		}
+		buf.WriteByte(s[0])
+		return nil
+	case '?':
+		if s := toString(v); s != "" && s != "0" && s != "false" {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		return nil
+	case 'f':
+		f, err := strconv.ParseFloat(toString(v), 32)
+		if err != nil {
+			return err
+		}
+		return binary.Write(buf, order, float32(f))
+	case 'd':
+		f, err := strconv.ParseFloat(toString(v), 64)
+		if err != nil {
+			return err
+		}
+		return binary.Write(buf, order, f)
+	}
+
+	n, err := toStructInt(v)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case 'b', 'B':
+		return binary.Write(buf, order, uint8(n))
+	case 'h', 'H':
+		return binary.Write(buf, order, uint16(n))
+	case 'i', 'I', 'l', 'L':
+		return binary.Write(buf, order, uint32(n))
+	default:
+		return binary.Write(buf, order, uint64(n))
+	}
+}
+
+// toStructInt converts DSL numbers (float64, ints or strings) to an integer,
+// keeping the full 64 bit range when the value is given as a string.
+func toStructInt(v interface{}) (int64, error) {
+	s := toString(v)
+	if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return n, nil
+	}
+	if n, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return int64(n), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid struct integer value %q", s)
+	}
+	return int64(f), nil
+}
+
+// structUnpack unpacks data following format, like python's struct.unpack.
+// Numbers are returned as float64 so they can be compared in expressions.
+func structUnpack(format string, data string) ([]interface{}, error) {
+	order, fields, err := parseStructFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int
+	for _, field := range fields {
+		size += structSizes[field.kind] * field.count
+	}
+	if len(data) < size {
+		return nil, fmt.Errorf("unpack requires %d bytes, got %d", size, len(data))
+	}
+
+	var values []interface{}
+	b := []byte(data)
+	for _, field := range fields {
+		switch field.kind {
+		case 'x':
+			b = b[field.count:]
+			continue
+		case 's':
+			values = append(values, string(b[:field.count]))
+			b = b[field.count:]
+			continue
+		}
+		for i := 0; i < field.count; i++ {
+			n := structSizes[field.kind]
+			values = append(values, unpackValue(order, field.kind, b[:n]))
+			b = b[n:]
+		}
+	}
+	return values, nil
+}
+
+func unpackValue(order binary.ByteOrder, kind byte, b []byte) interface{} {
+	switch kind {
+	case 'c':
+		return string(b)
+	case '?':
+		return b[0] != 0
+	case 'b':
+		return float64(int8(b[0]))
+	case 'B':
+		return float64(b[0])
+	case 'h':
+		return float64(int16(order.Uint16(b)))
+	case 'H':
+		return float64(order.Uint16(b))
+	case 'i', 'l':
+		return float64(int32(order.Uint32(b)))
+	case 'I', 'L':
+		return float64(order.Uint32(b))
+	case 'q':
+		return float64(int64(order.Uint64(b)))
+	case 'Q':
+		return float64(order.Uint64(b))
+	case 'f':
+		return float64(math.Float32frombits(order.Uint32(b)))
+	default:
+		return math.Float64frombits(order.Uint64(b))
+	}
+}
+
+// bytesAt returns length bytes of data from offset.
+func bytesAt(data string, offset, length int) (string, error) {
+	if offset < 0 || length < 0 || offset+length > len(data) {
+		return "", fmt.Errorf("bytes_at out of range: offset %d, length %d, size %d", offset, length, len(data))
+	}
+	return data[offset : offset+length], nil
+}
+
+// readUint reads a size bytes unsigned integer at the optional offset args.
+func readUint(order binary.ByteOrder, size int, args ...interface{}) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, ErrInvalidDslFunction
+	}
+	offset := 0
+	if len(args) == 2 {
+		n, err := toStructInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		offset = int(n)
+	}
+	b, err := bytesAt(toString(args[0]), offset, size)
+	if err != nil {
+		return nil, err
+	}
+	if size == 2 {
+		return float64(order.Uint16([]byte(b))), nil
+	}
+	return float64(order.Uint32([]byte(b))), nil
+}
+
+// lenPrefix prepends the length of data packed with format, e.g. ">H".
+func lenPrefix(format, data string) (string, error) {
+	if strings.ContainsAny(strings.TrimLeft(format, "<>!=@"), "sx") {
+		return "", fmt.Errorf("invalid length prefix format %q", format)
+	}
+	prefix, err := structPack(format, len(data))
+	if err != nil {
+		return "", err
+	}
+	return prefix + data, nil
+}
@@ -1,19 +1,30 @@
 package dsl
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type parser struct {
 	tokens []Token
 	pos    int
+	// typedNumbers turns number literals into float64 instead of keeping
+	// their source text, which is what the evaluator needs
+	typedNumbers bool
 }
 
 func Parse(input string) (*Node, error) {
+	return parse(input, false)
+}
+
+func parse(input string, typedNumbers bool) (*Node, error) {
 	tokens, err := Lex(input)
 	if err != nil {
 		return nil, err
 	}
-	p := &parser{tokens: tokens}
-	node, err := p.parseOr()
+	p := &parser{tokens: tokens, typedNumbers: typedNumbers}
+	node, err := p.parseTernary()
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +57,46 @@ func (p *parser) expect(typ TokenType) (Token, error) {
 	return t, nil
 }
 
+func (p *parser) parseTernary() (*Node, error) {
+	cond, err := p.parseCoalesce()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type != TQuestion {
+		return cond, nil
+	}
+	p.next()
+	then, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().Type != TColon {
+		return ternary(cond, then, nil), nil
+	}
+	p.next()
+	otherwise, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	return ternary(cond, then, otherwise), nil
+}
+
+func (p *parser) parseCoalesce() (*Node, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().Type == TCoalesce {
+		p.next()
+		right, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryOp("??", left, right)
+	}
+	return left, nil
+}
+
 func (p *parser) parseOr() (*Node, error) {
 	left, err := p.parseAnd()
 	if err != nil {
@@ -79,34 +130,82 @@ func (p *parser) parseAnd() (*Node, error) {
 }
 
 func (p *parser) parseComparison() (*Node, error) {
-	left, err := p.parseUnary()
+	left, err := p.parseBitwise()
 	if err != nil {
 		return nil, err
 	}
 	switch p.peek().Type {
-	case TEq, TNeq, TGt, TGte, TLt, TLte:
+	case TEq, TNeq, TGt, TGte, TLt, TLte, TMatch, TNotMatch, TIn:
+		op := p.next()
+		right, err := p.parseBitwise()
+		if err != nil {
+			return nil, err
+		}
+		return binaryOp(strings.ToLower(op.Value), left, right), nil
+	}
+	return left, nil
+}
+
+// parseBinary parses a left-associative level of binary operators, the
+// precedence levels follow govaluate's.
+func (p *parser) parseBinary(next func() (*Node, error), types ...TokenType) (*Node, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekIs(types...) {
 		op := p.next()
-		right, err := p.parseUnary()
+		right, err := next()
 		if err != nil {
 			return nil, err
 		}
-		return binaryOp(op.Value, left, right), nil
+		left = binaryOp(op.Value, left, right)
 	}
 	return left, nil
 }
 
+func (p *parser) parseBitwise() (*Node, error) {
+	return p.parseBinary(p.parseShift, TBitAnd, TBitOr, TBitXor)
+}
+
+func (p *parser) parseShift() (*Node, error) {
+	return p.parseBinary(p.parseAdditive, TShl, TShr)
+}
+
+func (p *parser) parseAdditive() (*Node, error) {
+	return p.parseBinary(p.parseMultiplicative, TPlus, TMinus)
+}
+
+func (p *parser) parseMultiplicative() (*Node, error) {
+	return p.parseBinary(p.parseExponential, TStar, TSlash, TPercent)
+}
+
+func (p *parser) parseExponential() (*Node, error) {
+	return p.parseBinary(p.parseUnary, TPow)
+}
+
 func (p *parser) parseUnary() (*Node, error) {
-	if p.peek().Type == TNot {
-		p.next()
-		operand, err := p.parsePrimary()
+	if p.peekIs(TNot, TMinus, TBitNot) {
+		op := p.next()
+		operand, err := p.parseUnary()
 		if err != nil {
 			return nil, err
 		}
-		return unaryOp("!", operand), nil
+		return unaryOp(op.Value, operand), nil
 	}
 	return p.parsePrimary()
 }
 
+func (p *parser) peekIs(types ...TokenType) bool {
+	current := p.peek().Type
+	for _, typ := range types {
+		if current == typ {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *parser) parsePrimary() (*Node, error) {
 	t := p.peek()
 
@@ -124,7 +223,10 @@ func (p *parser) parsePrimary() (*Node, error) {
 
 	case TNumber:
 		p.next()
-		return literal(t.Value), nil
+		if !p.typedNumbers {
+			return literal(t.Value), nil
+		}
+		return parseNumber(t)
 
 	case TBool:
 		p.next()
@@ -132,10 +234,23 @@ func (p *parser) parsePrimary() (*Node, error) {
 
 	case TLParen:
 		p.next()
-		node, err := p.parseOr()
+		node, err := p.parseTernary()
 		if err != nil {
 			return nil, err
 		}
+		if p.peek().Type == TComma {
+			// (a, b, c) is a list, used by the in operator
+			items := []*Node{node}
+			for p.peek().Type == TComma {
+				p.next()
+				item, err := p.parseTernary()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			node = list(items...)
+		}
 		if _, err := p.expect(TRParen); err != nil {
 			return nil, err
 		}
@@ -154,7 +269,7 @@ func (p *parser) parseCall(name string) (*Node, error) {
 				return nil, err
 			}
 		}
-		arg, err := p.parseOr()
+		arg, err := p.parseTernary()
 		if err != nil {
 			return nil, err
 		}
@@ -163,3 +278,18 @@ func (p *parser) parseCall(name string) (*Node, error) {
 	p.next() // consume ')'
 	return call(name, args...), nil
 }
+
+func parseNumber(t Token) (*Node, error) {
+	if strings.HasPrefix(t.Value, "0x") || strings.HasPrefix(t.Value, "0X") {
+		n, err := strconv.ParseUint(t.Value[2:], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.Value, t.Pos)
+		}
+		return literal(float64(n)), nil
+	}
+	n, err := strconv.ParseFloat(t.Value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q at position %d", t.Value, t.Pos)
+	}
+	return literal(n), nil
+}
@@ -0,0 +1,18 @@
+package tlsx
+
+import "github.com/chainreactors/neutron/common"
+
+// CertDSLKeys lists every key FillCertDSL may set, so that expressions
+// referencing certificate fields can be checked before any handshake.
+var CertDSLKeys = []string{
+	// cert_* style
+	"cert_subject", "cert_issuer", "cert_not_before", "cert_not_after",
+	"cert_dnsnames", "cert_serial", "cert_common_name", "cert_organization",
+	// nuclei style
+	"subject_cn", "subject_an", "subject_dn", "subject_org",
+	"issuer_cn", "issuer_dn", "issuer_org", "emails", "serial",
+	"not_before", "not_after", "domains", "wildcard_certificate",
+	"self_signed", "expired", "mismatched", "untrusted", "revoked", "sni",
+	"tls_version", "cipher", "fingerprint_hash", "tls_connection", "probe_status",
+	common.RawCertKey,
+}
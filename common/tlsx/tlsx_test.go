@@ -197,3 +197,18 @@ func TestCipherNameWeakSuites(t *testing.T) {
 		t.Errorf("CipherName(unknown) = %q, want bare hex %q", got, "0x9999")
 	}
 }
+
+func TestCertDSLKeysCoverFillCertDSL(t *testing.T) {
+	data := map[string]interface{}{}
+	FillCertDSL(data, sampleState(), "leaf.example")
+
+	known := make(map[string]bool, len(CertDSLKeys))
+	for _, key := range CertDSLKeys {
+		known[key] = true
+	}
+	for key := range data {
+		if !known[key] {
+			t.Errorf("FillCertDSL sets %q which is missing from CertDSLKeys", key)
+		}
+	}
+}
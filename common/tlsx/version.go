@@ -0,0 +1,22 @@
+package tlsx
+
+import "strings"
+
+// TLSVersionValue maps a textual version (sslv3, tls10 ... tls13, or the
+// dotted tls1.x form) to the crypto/tls constant, returning 0 when unknown.
+// Literal hex values keep this go1.11-safe (tls.VersionTLS13 was added in go1.12).
+func TLSVersionValue(name string) uint16 {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "sslv3", "ssl30":
+		return 0x0300
+	case "tls10", "tls1.0":
+		return 0x0301
+	case "tls11", "tls1.1":
+		return 0x0302
+	case "tls12", "tls1.2":
+		return 0x0303
+	case "tls13", "tls1.3":
+		return 0x0304
+	}
+	return 0
+}
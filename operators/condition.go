@@ -0,0 +1,195 @@
+package operators
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// conditionExpression is a compiled matchers-condition expression over matcher
+// names, e.g. `(version and banner) or favicon`. Unnamed matchers are referred
+// to as <type>-<n>, like in the result events.
+type conditionExpression struct {
+	// op is and, or, not, or empty for a matcher reference
+	op       string
+	matcher  int
+	children []*conditionExpression
+}
+
+// isConditionExpression reports whether a matchers-condition is an expression
+// rather than the flat and / or, in any case.
+func isConditionExpression(condition string) bool {
+	_, ok := conditionTypes[strings.ToLower(condition)]
+	return condition != "" && !ok
+}
+
+// compileConditionExpression parses expression. and binds tighter than or and
+// not tighter than both; every matcher must be referenced exactly by name.
+func compileConditionExpression(expression string, matchers []*Matcher) (*conditionExpression, error) {
+	names := make(map[string]int, len(matchers))
+	for i, matcher := range matchers {
+		name := getMatcherName(matcher, i)
+		if _, ok := names[name]; ok {
+			names[name] = -1
+			continue
+		}
+		names[name] = i
+	}
+
+	p := &conditionParser{tokens: tokenizeCondition(expression), names: names, used: make(map[int]bool)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid matchers-condition %q: %v", expression, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("invalid matchers-condition %q: unexpected %q", expression, p.tokens[p.pos])
+	}
+	for i, matcher := range matchers {
+		if !p.used[i] {
+			return nil, fmt.Errorf("invalid matchers-condition %q: matcher %s is not referenced", expression, getMatcherName(matcher, i))
+		}
+	}
+	return root, nil
+}
+
+func tokenizeCondition(expression string) []string {
+	var tokens []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, ch := range expression {
+		switch {
+		case ch == '(' || ch == ')':
+			flush()
+			tokens = append(tokens, string(ch))
+		case unicode.IsSpace(ch):
+			flush()
+		default:
+			current.WriteRune(ch)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type conditionParser struct {
+	tokens []string
+	pos    int
+	names  map[string]int
+	used   map[int]bool
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *conditionParser) parseOr() (*conditionExpression, error) {
+	return p.parseBinary("or", p.parseAnd)
+}
+
+func (p *conditionParser) parseAnd() (*conditionExpression, error) {
+	return p.parseBinary("and", p.parseNot)
+}
+
+func (p *conditionParser) parseBinary(op string, operand func() (*conditionExpression, error)) (*conditionExpression, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	children := []*conditionExpression{left}
+	for strings.EqualFold(p.peek(), op) {
+		p.pos++
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, right)
+	}
+	if len(children) == 1 {
+		return left, nil
+	}
+	return &conditionExpression{op: op, children: children}, nil
+}
+
+func (p *conditionParser) parseNot() (*conditionExpression, error) {
+	if strings.EqualFold(p.peek(), "not") {
+		p.pos++
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &conditionExpression{op: "not", children: []*conditionExpression{operand}}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() (*conditionExpression, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case token == "(":
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return inner, nil
+	case token == ")" || strings.EqualFold(token, "and") || strings.EqualFold(token, "or"):
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+	p.pos++
+	index, ok := p.names[token]
+	if !ok {
+		return nil, fmt.Errorf("unknown matcher %s", token)
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("matcher name %s is ambiguous", token)
+	}
+	p.used[index] = true
+	return &conditionExpression{matcher: index}, nil
+}
+
+// eval evaluates the expression left to right, short-circuiting and / or.
+// matched is only called for the matchers the result depends on. The
+// returned indexes are the matchers that made the expression true.
+func (c *conditionExpression) eval(matched func(index int) bool) (bool, []int) {
+	switch c.op {
+	case "":
+		if matched(c.matcher) {
+			return true, []int{c.matcher}
+		}
+		return false, nil
+	case "not":
+		result, _ := c.children[0].eval(matched)
+		return !result, nil
+	case "and":
+		var contributors []int
+		for _, child := range c.children {
+			result, indexes := child.eval(matched)
+			if !result {
+				return false, nil
+			}
+			contributors = append(contributors, indexes...)
+		}
+		return true, contributors
+	default:
+		for _, child := range c.children {
+			if result, indexes := child.eval(matched); result {
+				return true, indexes
+			}
+		}
+		return false, nil
+	}
+}
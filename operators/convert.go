@@ -26,6 +26,8 @@ func (m *Matcher) ToQuery() *dsl.Query {
 		q.Errors = append(q.Errors, "binary matcher cannot be converted to search query")
 	case SizeMatcher:
 		q.Errors = append(q.Errors, "size matcher cannot be converted to search query")
+	case TimingMatcher:
+		q.Errors = append(q.Errors, "timing matcher cannot be converted to search query")
 	default:
 		q.Errors = append(q.Errors, fmt.Sprintf("unknown matcher type: %d", m.matcherType))
 	}
@@ -40,20 +42,47 @@ func (m *Matcher) ToQuery() *dsl.Query {
 func (o *Operators) ToQuery() *dsl.Query {
 	q := dsl.NewQuery()
 	var nodes []*dsl.Node
+	matcherNodes := make([]*dsl.Node, len(o.Matchers))
 
-	for _, m := range o.Matchers {
+	for i, m := range o.Matchers {
 		mq := m.ToQuery()
 		q.Warnings = append(q.Warnings, mq.Warnings...)
 		q.Errors = append(q.Errors, mq.Errors...)
 		if mq.Node != nil {
 			nodes = append(nodes, mq.Node)
 		}
+		matcherNodes[i] = mq.Node
 	}
 
+	if o.matchersExpression != nil {
+		q.Node = o.matchersExpression.toNode(matcherNodes)
+		return q
+	}
 	q.Node = joinNodes(nodes, o.matchersCondition == ANDCondition)
 	return q
 }
 
+// toNode converts the matchers-condition expression, dropping the matchers
+// that cannot be converted like joinNodes does.
+func (c *conditionExpression) toNode(matcherNodes []*dsl.Node) *dsl.Node {
+	switch c.op {
+	case "":
+		return matcherNodes[c.matcher]
+	case "not":
+		if node := c.children[0].toNode(matcherNodes); node != nil {
+			return dsl.UnaryOp("!", node)
+		}
+		return nil
+	}
+	var nodes []*dsl.Node
+	for _, child := range c.children {
+		if node := child.toNode(matcherNodes); node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return joinNodes(nodes, c.op == "and")
+}
+
 func joinNodes(nodes []*dsl.Node, isAnd bool) *dsl.Node {
 	if len(nodes) == 0 {
 		return nil
@@ -311,3 +311,23 @@ func TestRealFingerprint_RegexPartialResult(t *testing.T) {
 		t.Error("expected errors from regex matcher")
 	}
 }
+
+func TestOperatorsExpressionToQuery(t *testing.T) {
+	ops := &Operators{
+		MatchersCondition: "(version and banner) or not status",
+		Matchers: []*Matcher{
+			{Type: "word", Name: "version", Words: []string{"v1.2"}},
+			{Type: "regex", Name: "banner", Regex: []string{"Acme"}},
+			{Type: "status", Name: "status", Status: []int{404}},
+		},
+	}
+	if err := ops.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := ops.ToQuery().ToFOFA()
+	expected := `body="v1.2" || !(status_code="404")`
+	if r.Query != expected {
+		t.Errorf("got %q, want %q", r.Query, expected)
+	}
+}
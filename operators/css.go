@@ -0,0 +1,420 @@
+package operators
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The css matcher and extractor select elements of an HTML response with
+// CSS selectors, on a stdlib tokenizer, e.g.
+//
+//	meta[name=generator]  with attribute: content
+//	script[src]           with attribute: src
+//	div#app > .version, footer a[href*="powered"]
+//
+// Supported: type and universal selectors, #id, .class, attribute selectors
+// with =, ~=, ^=, $=, *= and |=, the descendant (space) and child (>)
+// combinators, and selector lists. Pseudo-classes and sibling combinators
+// are not supported.
+func init() {
+	RegisterMatcherType("css", CSSMatcher, compileCSSMatcher, matchCSS)
+	RegisterExtractorType("css", CSSExtractor, compileCSSExtractor, extractCSS)
+}
+
+// cssSelector is a compiled selector list.
+type cssSelector []*cssComplex
+
+// cssComplex is compounds joined by combinators, combinators[i] sits between
+// compounds[i] and compounds[i+1] and is ' ' or '>'.
+type cssComplex struct {
+	compounds   []*cssCompound
+	combinators []byte
+}
+
+type cssCompound struct {
+	tag   string
+	attrs []cssAttribute
+}
+
+type cssAttribute struct {
+	name  string
+	op    string
+	value string
+}
+
+// compileCSSSelector compiles a CSS selector list.
+func compileCSSSelector(selector string) (cssSelector, error) {
+	p := &cssParser{input: selector}
+	compiled, err := p.parseList()
+	if err != nil {
+		return nil, fmt.Errorf("could not compile css selector %s: %v", selector, err)
+	}
+	return compiled, nil
+}
+
+type cssParser struct {
+	input string
+	pos   int
+}
+
+func (p *cssParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *cssParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *cssParser) skipSpaces() bool {
+	start := p.pos
+	for !p.eof() && isHTMLSpace(p.peek()) {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *cssParser) unexpected() error {
+	if p.eof() {
+		return fmt.Errorf("unexpected end of selector")
+	}
+	return fmt.Errorf("unexpected %q at offset %d", p.input[p.pos:], p.pos)
+}
+
+func (p *cssParser) parseList() (cssSelector, error) {
+	var list cssSelector
+	for {
+		p.skipSpaces()
+		complex, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, complex)
+		p.skipSpaces()
+		if p.eof() {
+			return list, nil
+		}
+		if p.peek() != ',' {
+			return nil, p.unexpected()
+		}
+		p.pos++
+	}
+}
+
+func (p *cssParser) parseComplex() (*cssComplex, error) {
+	complex := &cssComplex{}
+	for {
+		compound, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		complex.compounds = append(complex.compounds, compound)
+
+		spaced := p.skipSpaces()
+		switch {
+		case p.peek() == '>':
+			p.pos++
+			p.skipSpaces()
+			complex.combinators = append(complex.combinators, '>')
+		case p.eof() || p.peek() == ',':
+			return complex, nil
+		case spaced:
+			complex.combinators = append(complex.combinators, ' ')
+		default:
+			return nil, p.unexpected()
+		}
+	}
+}
+
+func (p *cssParser) parseCompound() (*cssCompound, error) {
+	compound := &cssCompound{}
+	start := p.pos
+	if p.peek() == '*' {
+		p.pos++
+	} else if isCSSNameChar(p.peek()) {
+		compound.tag = strings.ToLower(p.name())
+	}
+	for !p.eof() {
+		switch p.peek() {
+		case '#':
+			p.pos++
+			id := p.name()
+			if id == "" {
+				return nil, p.unexpected()
+			}
+			compound.attrs = append(compound.attrs, cssAttribute{name: "id", op: "=", value: id})
+		case '.':
+			p.pos++
+			class := p.name()
+			if class == "" {
+				return nil, p.unexpected()
+			}
+			compound.attrs = append(compound.attrs, cssAttribute{name: "class", op: "~=", value: class})
+		case '[':
+			p.pos++
+			attr, err := p.parseAttribute()
+			if err != nil {
+				return nil, err
+			}
+			compound.attrs = append(compound.attrs, attr)
+		case ':':
+			return nil, fmt.Errorf("pseudo-classes are not supported")
+		default:
+			if p.pos == start {
+				return nil, p.unexpected()
+			}
+			return compound, nil
+		}
+	}
+	if p.pos == start {
+		return nil, p.unexpected()
+	}
+	return compound, nil
+}
+
+func (p *cssParser) parseAttribute() (cssAttribute, error) {
+	p.skipSpaces()
+	attr := cssAttribute{name: strings.ToLower(p.name())}
+	if attr.name == "" {
+		return attr, p.unexpected()
+	}
+	p.skipSpaces()
+	if p.peek() == ']' {
+		p.pos++
+		return attr, nil
+	}
+	for _, op := range []string{"=", "~=", "^=", "$=", "*=", "|="} {
+		if strings.HasPrefix(p.input[p.pos:], op) {
+			attr.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if attr.op == "" {
+		return attr, p.unexpected()
+	}
+	p.skipSpaces()
+	if quote := p.peek(); quote == '"' || quote == '\'' {
+		end := strings.IndexByte(p.input[p.pos+1:], quote)
+		if end < 0 {
+			return attr, fmt.Errorf("unterminated string")
+		}
+		attr.value = p.input[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+	} else {
+		attr.value = p.name()
+	}
+	p.skipSpaces()
+	if p.peek() != ']' {
+		return attr, p.unexpected()
+	}
+	p.pos++
+	return attr, nil
+}
+
+func (p *cssParser) name() string {
+	start := p.pos
+	for isCSSNameChar(p.peek()) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func isCSSNameChar(ch byte) bool {
+	return ch == '-' || ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
+
+// selectFrom returns the elements of the tree under root matching the selector,
+// in document order.
+func (s cssSelector) selectFrom(root *htmlNode) []*htmlNode {
+	var out []*htmlNode
+	for _, element := range root.elements() {
+		for _, complex := range s {
+			if complex.matchAt(element, len(complex.compounds)-1) {
+				out = append(out, element)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (c *cssComplex) matchAt(element *htmlNode, i int) bool {
+	if !c.compounds[i].matches(element) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	if c.combinators[i-1] == '>' {
+		parent := element.parent
+		return parent != nil && parent.tag != "#root" && c.matchAt(parent, i-1)
+	}
+	for ancestor := element.parent; ancestor != nil && ancestor.tag != "#root"; ancestor = ancestor.parent {
+		if c.matchAt(ancestor, i-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cssCompound) matches(element *htmlNode) bool {
+	if c.tag != "" && c.tag != element.tag {
+		return false
+	}
+	for _, attr := range c.attrs {
+		value, ok := element.attr(attr.name)
+		if !ok || !attr.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a cssAttribute) matches(value string) bool {
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return value == a.value
+	case "~=":
+		for _, word := range strings.Fields(value) {
+			if word == a.value {
+				return true
+			}
+		}
+		return false
+	case "^=":
+		return a.value != "" && strings.HasPrefix(value, a.value)
+	case "$=":
+		return a.value != "" && strings.HasSuffix(value, a.value)
+	case "*=":
+		return a.value != "" && strings.Contains(value, a.value)
+	default: // |=
+		return value == a.value || strings.HasPrefix(value, a.value+"-")
+	}
+}
+
+func compileCSSSelectors(selectors []string) ([]cssSelector, error) {
+	compiled := make([]cssSelector, 0, len(selectors))
+	for _, selector := range selectors {
+		s, err := compileCSSSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, s)
+	}
+	return compiled, nil
+}
+
+func compileCSSMatcher(m *Matcher) error {
+	compiled, err := compileCSSSelectors(m.CSS)
+	if err != nil {
+		return err
+	}
+	m.SetCompiledData(compiled)
+	return nil
+}
+
+func compileCSSExtractor(e *Extractor) error {
+	compiled, err := compileCSSSelectors(e.CSS)
+	if err != nil {
+		return err
+	}
+	e.SetCompiledData(compiled)
+	return nil
+}
+
+// matchCSS matches when a selector selects at least one element. The hits
+// are the trimmed text of the selected elements.
+func matchCSS(m *Matcher, corpus string, _ map[string]interface{}) (bool, []MatchHit) {
+	compiled, ok := m.GetCompiledData().([]cssSelector)
+	if !ok {
+		return false, nil
+	}
+	root := parseHTML(corpus)
+
+	var matchedItems []MatchHit
+	for i, selector := range compiled {
+		elements := selector.selectFrom(root)
+		if len(elements) == 0 {
+			if m.GetCondition() == ANDCondition {
+				return false, nil
+			}
+			continue
+		}
+		for _, element := range elements {
+			matchedItems = append(matchedItems, MatchHit{Value: strings.TrimSpace(element.innerText()), Rule: m.CSS[i]})
+		}
+
+		if m.GetCondition() == ORCondition && !m.MatchAll {
+			return true, matchedItems
+		}
+		if len(compiled)-1 == i && !m.MatchAll {
+			return true, matchedItems
+		}
+	}
+	if len(matchedItems) > 0 && m.MatchAll {
+		return true, matchedItems
+	}
+	return false, nil
+}
+
+// extractCSS extracts the attribute of the selected elements, or their
+// trimmed text when no attribute is set.
+func extractCSS(e *Extractor, corpus string, _ map[string]interface{}) map[string]struct{} {
+	results := make(map[string]struct{})
+	compiled, ok := e.GetCompiledData().([]cssSelector)
+	if !ok {
+		return results
+	}
+	root := parseHTML(corpus)
+	for _, selector := range compiled {
+		for _, element := range selector.selectFrom(root) {
+			var value string
+			if e.Attribute != "" {
+				var ok bool
+				if value, ok = element.attr(strings.ToLower(e.Attribute)); !ok {
+					continue
+				}
+			} else {
+				value = strings.TrimSpace(element.innerText())
+			}
+			results[value] = struct{}{}
+		}
+	}
+	return results
+}
+
+// String returns the selector list in canonical form.
+func (s cssSelector) String() string {
+	complexes := make([]string, len(s))
+	for i, complex := range s {
+		var builder strings.Builder
+		for j, compound := range complex.compounds {
+			if j > 0 {
+				if complex.combinators[j-1] == '>' {
+					builder.WriteString(" > ")
+				} else {
+					builder.WriteString(" ")
+				}
+			}
+			if compound.tag == "" && len(compound.attrs) == 0 {
+				builder.WriteString("*")
+			}
+			builder.WriteString(compound.tag)
+			for _, attr := range compound.attrs {
+				builder.WriteString("[" + attr.name)
+				if attr.op != "" {
+					builder.WriteString(attr.op + strconv.Quote(attr.value))
+				}
+				builder.WriteString("]")
+			}
+		}
+		complexes[i] = builder.String()
+	}
+	return strings.Join(complexes, ", ")
+}
@@ -0,0 +1,115 @@
+package operators
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const cssCorpus = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="generator" content="WordPress 6.4.2">
+	<title>Admin &amp; Login</title>
+	<script src="/static/app.js?v=1.2"></script>
+	<script>var tag = "<div class='fake'>";</script>
+</head>
+<body>
+	<div id="app" class="container main">
+		<span class="version">v2.1</span>
+		<ul lang="en-US">
+			<li><a href="/docs">Docs</a>
+			<li><a href=/login data-role=auth>Login</a>
+		</ul>
+	</div>
+	<!-- <span class="version">commented</span> -->
+	<footer><p>Powered by <a href="https://example.com/powered">Example</a></p></footer>
+</body>
+</html>`
+
+func TestCompileCSSSelector(t *testing.T) {
+	for selector, expected := range map[string]string{
+		`meta[name=generator]`:         `meta[name="generator"]`,
+		`DIV#app > .version`:           `div[id="app"] > [class~="version"]`,
+		`footer  a[href*='powered']`:   `footer a[href*="powered"]`,
+		`*[ data-role ], ul[lang|=en]`: `[data-role], ul[lang|="en"]`,
+		`*`:                            `*`,
+	} {
+		compiled, err := compileCSSSelector(selector)
+		require.NoError(t, err, selector)
+		require.Equal(t, expected, compiled.String(), selector)
+	}
+
+	for _, selector := range []string{``, `div >`, `div,`, `a:first-child`, `a[href`, `a[href="x]`, `a[href^]`, `div + p`, `.`, `#`} {
+		_, err := compileCSSSelector(selector)
+		require.Error(t, err, selector)
+	}
+}
+
+func TestCSSSelect(t *testing.T) {
+	root := parseHTML(cssCorpus)
+	for selector, expected := range map[string][]string{
+		`title`:                        {"Admin & Login"},
+		`.version`:                     {"v2.1"},
+		`#app > .version`:              {"v2.1"},
+		`body > .version`:              nil,
+		`div.container.main span`:      {"v2.1"},
+		`ul li a`:                      {"Docs", "Login"},
+		`ul > li > a[data-role=auth]`:  {"Login"},
+		`li > a, footer a`:             {"Docs", "Login", "Example"},
+		`a[href^="/"]`:                 {"Docs", "Login"},
+		`a[href$=powered]`:             {"Example"},
+		`ul[lang|=en] a[href="/docs"]`: {"Docs"},
+		`div.fake`:                     nil,
+	} {
+		compiled, err := compileCSSSelector(selector)
+		require.NoError(t, err, selector)
+		var texts []string
+		for _, element := range compiled.selectFrom(root) {
+			texts = append(texts, element.innerText())
+		}
+		require.Equal(t, expected, texts, selector)
+	}
+}
+
+func TestCSSExtractor(t *testing.T) {
+	extract := func(attribute string, selectors ...string) []string {
+		extractor := &Extractor{Type: "css", CSS: selectors, Attribute: attribute}
+		require.NoError(t, extractor.CompileExtractors())
+		var values []string
+		for value := range extractCSS(extractor, cssCorpus, nil) {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+		return values
+	}
+
+	require.Equal(t, []string{"WordPress 6.4.2"}, extract("content", "meta[name=generator]"))
+	require.Equal(t, []string{"/static/app.js?v=1.2"}, extract("src", "script"))
+	require.Equal(t, []string{"/docs", "/login"}, extract("HREF", "li a"))
+	require.Equal(t, []string{"v2.1"}, extract("", ".version"))
+}
+
+func TestCSSMatcher(t *testing.T) {
+	match := func(condition string, selectors ...string) (bool, []MatchHit) {
+		matcher := &Matcher{Type: "css", CSS: selectors, Condition: condition}
+		require.NoError(t, matcher.CompileMatchers())
+		return matchCSS(matcher, cssCorpus, nil)
+	}
+
+	matched, hits := match("and", `meta[name=generator][content^="WordPress"]`, `#app .version`)
+	require.True(t, matched)
+	require.Equal(t, []MatchHit{{Value: "", Rule: `meta[name=generator][content^="WordPress"]`}, {Value: "v2.1", Rule: `#app .version`}}, hits)
+
+	matched, _ = match("and", `#app .version`, `meta[name=drupal]`)
+	require.False(t, matched)
+
+	matched, hits = match("or", `meta[name=drupal]`, `a[data-role=auth]`)
+	require.True(t, matched)
+	require.Equal(t, []MatchHit{{Value: "Login", Rule: `a[data-role=auth]`}}, hits)
+
+	matcher := &Matcher{Type: "css", CSS: []string{`a:hover`}}
+	require.Error(t, matcher.CompileMatchers())
+}
@@ -0,0 +1,363 @@
+package operators
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chainreactors/neutron/common"
+	"github.com/chainreactors/neutron/common/dsl"
+	"github.com/chainreactors/utils/iutils"
+)
+
+// maxExplainValue caps the length of the values recorded in explanations, so
+// a body referenced by a dsl matcher does not end up copied in full.
+const maxExplainValue = 256
+
+// Explanation records how the matchers of an Operators evaluated an event.
+type Explanation struct {
+	// Condition is the matchers-condition, and or or.
+	Condition string `json:"condition" yaml:"condition"`
+	// Matched is the aggregated result of the matchers.
+	Matched bool `json:"matched" yaml:"matched"`
+	// Reason tells why the aggregation failed.
+	Reason   string                `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Matchers []*MatcherExplanation `json:"matchers,omitempty" yaml:"matchers,omitempty"`
+}
+
+// MatcherExplanation records the evaluation of a single matcher.
+type MatcherExplanation struct {
+	// Name is the matcher name, or type-N for unnamed matchers.
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type" yaml:"type"`
+	// Part is the part of the event the matcher inspected.
+	Part      string `json:"part,omitempty" yaml:"part,omitempty"`
+	Condition string `json:"condition" yaml:"condition"`
+	Negative  bool   `json:"negative,omitempty" yaml:"negative,omitempty"`
+	// Matched is the result of the matcher, after negation.
+	Matched bool `json:"matched" yaml:"matched"`
+	// Reason tells why the matcher did not match.
+	Reason     string                  `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Conditions []*ConditionExplanation `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+// ConditionExplanation records a single word, regex, status, dsl... of a
+// matcher.
+type ConditionExplanation struct {
+	// Rule is the condition as written in the template.
+	Rule    string `json:"rule" yaml:"rule"`
+	Matched bool   `json:"matched" yaml:"matched"`
+	// Value is what the rule was compared with: the evaluated word, the regex
+	// match, the status code or the result of a dsl expression.
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+	// Variables are the values of the variables a dsl expression references.
+	Variables map[string]interface{} `json:"variables,omitempty" yaml:"variables,omitempty"`
+	Error     string                 `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// String renders the explanation as an indented tree.
+func (e *Explanation) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "matchers-condition %s: %s", e.Condition, verdict(e.Matched))
+	if e.Reason != "" {
+		fmt.Fprintf(&builder, " (%s)", e.Reason)
+	}
+	builder.WriteString("\n")
+	for _, matcher := range e.Matchers {
+		fmt.Fprintf(&builder, "  [%s] %s", verdict(matcher.Matched), matcher.Name)
+		if matcher.Part != "" {
+			fmt.Fprintf(&builder, " part=%s", matcher.Part)
+		}
+		fmt.Fprintf(&builder, " condition=%s", matcher.Condition)
+		if matcher.Negative {
+			builder.WriteString(" negative")
+		}
+		if matcher.Reason != "" {
+			fmt.Fprintf(&builder, " (%s)", matcher.Reason)
+		}
+		builder.WriteString("\n")
+		for _, condition := range matcher.Conditions {
+			fmt.Fprintf(&builder, "    [%s] %s", verdict(condition.Matched), condition.Rule)
+			if condition.Value != "" {
+				fmt.Fprintf(&builder, " => %q", condition.Value)
+			}
+			if condition.Error != "" {
+				fmt.Fprintf(&builder, " error: %s", condition.Error)
+			}
+			builder.WriteString("\n")
+			for _, name := range sortedKeys(condition.Variables) {
+				fmt.Fprintf(&builder, "        %s = %#v\n", name, condition.Variables[name])
+			}
+		}
+	}
+	return builder.String()
+}
+
+func verdict(matched bool) string {
+	if matched {
+		return "match"
+	}
+	return "miss"
+}
+
+// ExecuteWithExplanation executes the operators exactly like Execute and also
+// explains how every matcher evaluated. resolve returns the part of data a
+// matcher inspects, the same way the protocol match func resolves it; a nil
+// resolve looks the part up in data.
+//
+// Unlike Execute, every matcher is evaluated even after an and condition has
+// already failed, so the explanation covers all of them. A matchers-condition
+// expression still short-circuits, its explanation only holds the matchers
+// it evaluated.
+func (operators *Operators) ExecuteWithExplanation(data map[string]interface{}, match matchFunc, extract extractFunc, resolve func(part string) (string, bool)) (*Result, bool, *Explanation) {
+	if resolve == nil {
+		resolve = func(part string) (string, bool) {
+			item, ok := data[part]
+			return iutils.ToString(item), ok
+		}
+	}
+	condition := operators.GetMatchersCondition().String()
+	if operators.GetMatchersCondition() == ExpressionCondition {
+		condition = operators.MatchersCondition
+	}
+	explanation := &explainer{
+		Explanation: &Explanation{Condition: condition},
+		resolve:     resolve,
+	}
+	result, ok := operators.execute(data, match, extract, explanation)
+	return result, ok, explanation.Explanation
+}
+
+// explainer collects the explanation while the operators execute.
+type explainer struct {
+	*Explanation
+	resolve func(part string) (string, bool)
+}
+
+func (e *explainer) matcher(matcher *Matcher, index int, matched bool, data map[string]interface{}) {
+	e.Matchers = append(e.Matchers, matcher.explain(index, matched, data, e.resolve))
+}
+
+func (e *explainer) finish(matched bool) {
+	e.Matched = matched
+	if matched || len(e.Matchers) == 0 {
+		return
+	}
+	if e.Condition == "or" {
+		e.Reason = fmt.Sprintf("none of the %d matchers matched", len(e.Matchers))
+		return
+	}
+	var failed []string
+	for _, matcher := range e.Matchers {
+		if !matcher.Matched {
+			failed = append(failed, strconv.Quote(matcher.Name))
+		}
+	}
+	switch len(failed) {
+	case 0:
+		e.Reason = "matchers-condition is false"
+	case 1:
+		e.Reason = fmt.Sprintf("matcher %s did not match", failed[0])
+	default:
+		e.Reason = fmt.Sprintf("matchers %s did not match", strings.Join(failed, ", "))
+	}
+}
+
+// explain evaluates every condition of the matcher on its own. matched is the
+// result the match func returned, which stays authoritative.
+func (m *Matcher) explain(index int, matched bool, data map[string]interface{}, resolve func(part string) (string, bool)) *MatcherExplanation {
+	explanation := &MatcherExplanation{
+		Name:      getMatcherName(m, index),
+		Type:      m.Type,
+		Condition: m.condition.String(),
+		Negative:  m.Negative,
+		Matched:   matched,
+	}
+	switch m.matcherType {
+	case DSLMatcher:
+		explanation.Conditions = m.explainDSL(data)
+	case TimingMatcher:
+		checks, ok := timingChecks(data)
+		if !ok {
+			explanation.Reason = "no timing statistics in the event"
+			return explanation
+		}
+		for _, check := range checks {
+			explanation.Conditions = append(explanation.Conditions, &ConditionExplanation{
+				Rule:    check.rule,
+				Matched: check.matched,
+				Value:   check.value,
+			})
+		}
+	case StatusMatcher:
+		explanation.Part = "status_code"
+		statusCode, ok := data["status_code"]
+		if !ok {
+			explanation.Reason = "part status_code not found"
+			return explanation
+		}
+		for _, status := range m.Status {
+			explanation.Conditions = append(explanation.Conditions, &ConditionExplanation{
+				Rule:    strconv.Itoa(status),
+				Matched: statusCode == status,
+				Value:   iutils.ToString(statusCode),
+			})
+		}
+	default:
+		explanation.Part = m.Part
+		corpus, ok := resolve(m.Part)
+		if !ok {
+			explanation.Reason = fmt.Sprintf("part %s not found", m.Part)
+			return explanation
+		}
+		explanation.Conditions = m.explainCorpus(corpus, data)
+	}
+	if !matched {
+		explanation.Reason = m.failureReason(explanation.Conditions)
+	}
+	return explanation
+}
+
+func (m *Matcher) explainCorpus(corpus string, data map[string]interface{}) []*ConditionExplanation {
+	var conditions []*ConditionExplanation
+	switch m.matcherType {
+	case WordsMatcher:
+		if m.CaseInsensitive {
+			corpus = strings.ToLower(corpus)
+		}
+		for _, word := range m.Words {
+			condition := &ConditionExplanation{Rule: word}
+			if strings.Contains(word, common.ParenthesisOpen) || strings.Contains(word, common.General) {
+				evaluated, err := common.Evaluate(word, data)
+				if err != nil {
+					condition.Error = err.Error()
+				}
+				word = evaluated
+				condition.Value = truncateExplainValue(word)
+			}
+			condition.Matched = strings.Contains(corpus, word)
+			conditions = append(conditions, condition)
+		}
+	case RegexMatcher:
+		for i, regex := range m.regexCompiled {
+			found := regex.FindString(corpus)
+			conditions = append(conditions, &ConditionExplanation{
+				Rule:    m.Regex[i],
+				Matched: regex.MatchString(corpus),
+				Value:   truncateExplainValue(found),
+			})
+		}
+	case BinaryMatcher:
+		for i, binary := range m.binaryDecoded {
+			conditions = append(conditions, &ConditionExplanation{
+				Rule:    m.Binary[i],
+				Matched: strings.Contains(corpus, binary),
+			})
+		}
+	case SizeMatcher:
+		for _, size := range m.Size {
+			conditions = append(conditions, &ConditionExplanation{
+				Rule:    strconv.Itoa(size),
+				Matched: len(corpus) == size,
+				Value:   strconv.Itoa(len(corpus)),
+			})
+		}
+	case FaviconMatcher:
+		hashes := make(map[string]struct{})
+		for _, hash := range strings.Fields(corpus) {
+			hashes[hash] = struct{}{}
+		}
+		for _, hash := range m.Hash {
+			_, ok := hashes[hash]
+			conditions = append(conditions, &ConditionExplanation{Rule: hash, Matched: ok})
+		}
+	}
+	// json, xpath and other registered types only report the matcher result
+	return conditions
+}
+
+// explainDSL evaluates each dsl expression and records the values of the
+// variables it references.
+func (m *Matcher) explainDSL(data map[string]interface{}) []*ConditionExplanation {
+	conditions := make([]*ConditionExplanation, 0, len(m.dslCompiled))
+	for i, expression := range m.dslCompiled {
+		condition := &ConditionExplanation{Rule: m.DSL[i]}
+		conditions = append(conditions, condition)
+
+		exprStr := expression.String()
+		if strings.Contains(exprStr, common.ParenthesisOpen) || strings.Contains(exprStr, common.General) {
+			resolved, err := common.Evaluate(exprStr, data)
+			if err == nil {
+				expression, err = dsl.CompileExpression(resolved)
+			}
+			if err != nil {
+				condition.Error = err.Error()
+				continue
+			}
+		}
+		for _, name := range expression.Vars() {
+			if value, ok := data[name]; ok {
+				if condition.Variables == nil {
+					condition.Variables = make(map[string]interface{})
+				}
+				condition.Variables[name] = explainValue(value)
+			}
+		}
+		result, err := expression.Evaluate(data)
+		if err != nil {
+			condition.Error = err.Error()
+			continue
+		}
+		condition.Value = truncateExplainValue(fmt.Sprint(result))
+		if matched, ok := result.(bool); ok {
+			condition.Matched = matched
+		} else {
+			condition.Error = "the expression does not return a boolean"
+		}
+	}
+	return conditions
+}
+
+func (m *Matcher) failureReason(conditions []*ConditionExplanation) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	if m.Negative {
+		return "negative matcher and the conditions matched"
+	}
+	if m.condition == ANDCondition {
+		for _, condition := range conditions {
+			if !condition.Matched {
+				return fmt.Sprintf("%q did not match", condition.Rule)
+			}
+		}
+	}
+	return fmt.Sprintf("none of the %d conditions matched", len(conditions))
+}
+
+func explainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return truncateExplainValue(v)
+	case []byte:
+		return truncateExplainValue(string(v))
+	}
+	return value
+}
+
+func truncateExplainValue(value string) string {
+	if len(value) > maxExplainValue {
+		return value[:maxExplainValue] + "..."
+	}
+	return value
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,8 +2,8 @@ package operators
 
 import (
 	"fmt"
-	"github.com/Knetic/govaluate"
 	"github.com/chainreactors/neutron/common"
+	"github.com/chainreactors/neutron/common/dsl"
 	"regexp"
 	"strings"
 )
@@ -83,14 +83,22 @@ type Extractor struct {
 	//       []string{"/html/body/div/p[2]/a"}
 	XPath []string `json:"xpath,omitempty" yaml:"xpath,omitempty"`
 	// description: |
-	//   Attribute is an optional attribute to extract from response XPath.
+	//   CSS allows using css selectors to extract items from html response
+	//
+	// examples:
+	//   - value: >
+	//       []string{"meta[name=generator]"}
+	CSS []string `json:"css,omitempty" yaml:"css,omitempty"`
+	// description: |
+	//   Attribute is an optional attribute to extract from response XPath or CSS.
+	//   Without it the css extractor returns the text of the selected elements.
 	//
 	// examples:
 	//   - value: "\"href\""
 	Attribute string `json:"attribute,omitempty" yaml:"attribute,omitempty" jsonschema:"title=optional attribute to extract from xpath,description=Optional attribute to extract from response XPath"`
 
 	DSL         []string `yaml:"dsl,omitempty" json:"dsl,omitempty" `
-	dslCompiled []*govaluate.EvaluableExpression
+	dslCompiled []*dsl.Expression
 	// description: |
 	//   Part is the part of the request response to extract data from.
 	//
@@ -111,6 +119,30 @@ type Extractor struct {
 	//   - false
 	//   - true
 	CaseInsensitive bool `json:"case-insensitive,omitempty" yaml:"case-insensitive,omitempty"`
+
+	// description: |
+	//   Transforms is a chain of DSL functions applied to each extracted value.
+	//   An entry is either a helper function name, called with the value, or
+	//   an expression over the `value` variable.
+	// examples:
+	//   - value: >
+	//       []string{"url_decode", "trim_space", "replace(value, \"+\", \" \")"}
+	Transforms []string `json:"transforms,omitempty" yaml:"transforms,omitempty"`
+	// description: |
+	//   Filter is a DSL predicate over `value`, only the values it is true for
+	//   are kept.
+	// examples:
+	//   - value: "\"len(value) == 32\""
+	Filter string `json:"filter,omitempty" yaml:"filter,omitempty"`
+	// description: |
+	//   Unique drops duplicate values, after the transforms.
+	Unique bool `json:"unique,omitempty" yaml:"unique,omitempty"`
+	// description: |
+	//   Limit keeps at most limit values. 0 keeps all of them.
+	Limit int `json:"limit,omitempty" yaml:"limit,omitempty"`
+
+	transformsCompiled []*dsl.Expression
+	filterCompiled     *dsl.Expression
 }
 
 // CompileExtractors performs the initial setup operation on an extractor
@@ -142,13 +174,17 @@ func (e *Extractor) CompileExtractors() error {
 	}
 
 	for _, dslExp := range e.DSL {
-		compiled, err := govaluate.NewEvaluableExpressionWithFunctions(dslExp, common.GetHelperFunctions())
+		compiled, err := dsl.CompileExpression(dslExp)
 		if err != nil {
 			return fmt.Errorf("could not compile dsl expression: %s", dslExp)
 		}
 		e.dslCompiled = append(e.dslCompiled, compiled)
 	}
 
+	if err := e.compilePipeline(); err != nil {
+		return err
+	}
+
 	if e.CaseInsensitive {
 		if e.GetType() != KValExtractor {
 			return fmt.Errorf("case-insensitive flag is supported only for 'kval' extractors (not '%s')", e.Type)
@@ -0,0 +1,250 @@
+package operators
+
+import (
+	"html"
+	"strings"
+)
+
+// htmlNode is an element or text node of the lenient HTML tree the css
+// matcher and extractor run on. It is not a conforming HTML5 parser: it
+// tolerates unclosed and misnested tags, which is what fingerprinting needs.
+type htmlNode struct {
+	tag      string
+	attrs    [][2]string
+	text     string
+	parent   *htmlNode
+	children []*htmlNode
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// rawTextElements hold text up to their end tag, no markup. The text of
+// title and textarea still has its character references decoded.
+var rawTextElements = map[string]bool{"script": true, "style": true, "textarea": true, "title": true}
+
+// selfClosingSiblings are closed by a sibling start tag of the same name,
+// e.g. <li>a<li>b.
+var selfClosingSiblings = map[string]bool{
+	"li": true, "p": true, "option": true, "tr": true, "td": true, "th": true, "dt": true, "dd": true,
+}
+
+func (n *htmlNode) attr(name string) (string, bool) {
+	for _, attr := range n.attrs {
+		if attr[0] == name {
+			return attr[1], true
+		}
+	}
+	return "", false
+}
+
+// innerText returns the text of the node and its descendants.
+func (n *htmlNode) innerText() string {
+	if n.tag == "" {
+		return n.text
+	}
+	var builder strings.Builder
+	var walk func(node *htmlNode)
+	walk = func(node *htmlNode) {
+		for _, child := range node.children {
+			if child.tag == "" {
+				builder.WriteString(child.text)
+			} else {
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	return builder.String()
+}
+
+// elements returns the elements below n in document order.
+func (n *htmlNode) elements() []*htmlNode {
+	var out []*htmlNode
+	var walk func(node *htmlNode)
+	walk = func(node *htmlNode) {
+		for _, child := range node.children {
+			if child.tag != "" {
+				out = append(out, child)
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	return out
+}
+
+// parseHTML builds the element tree of document under a root node.
+func parseHTML(document string) *htmlNode {
+	root := &htmlNode{tag: "#root"}
+	current := root
+	appendText := func(text string) {
+		if text != "" {
+			current.children = append(current.children, &htmlNode{text: html.UnescapeString(text), parent: current})
+		}
+	}
+
+	for i := 0; i < len(document); {
+		lt := strings.IndexByte(document[i:], '<')
+		if lt < 0 {
+			appendText(document[i:])
+			break
+		}
+		appendText(document[i : i+lt])
+		i += lt
+		rest := document[i:]
+
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				return root
+			}
+			i += 4 + end + 3
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return root
+			}
+			i += end + 1
+		case strings.HasPrefix(rest, "</"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return root
+			}
+			name := strings.ToLower(strings.TrimSpace(rest[2:end]))
+			if fields := strings.Fields(name); len(fields) > 0 {
+				name = fields[0]
+			}
+			for node := current; node != root; node = node.parent {
+				if node.tag == name {
+					current = node.parent
+					break
+				}
+			}
+			i += end + 1
+		default:
+			name, attrs, selfClosing, n := parseStartTag(rest)
+			if n == 0 {
+				appendText("<")
+				i++
+				continue
+			}
+			i += n
+			if selfClosingSiblings[name] && current.tag == name {
+				current = current.parent
+			}
+			node := &htmlNode{tag: name, attrs: attrs, parent: current}
+			current.children = append(current.children, node)
+			if voidElements[name] || selfClosing {
+				continue
+			}
+			if rawTextElements[name] {
+				end := indexFold(document[i:], "</"+name)
+				if end < 0 {
+					end = len(document) - i
+				}
+				if text := document[i : i+end]; text != "" {
+					if name == "title" || name == "textarea" {
+						text = html.UnescapeString(text)
+					}
+					node.children = append(node.children, &htmlNode{text: text, parent: node})
+				}
+				i += end
+				if close := strings.IndexByte(document[i:], '>'); close >= 0 {
+					i += close + 1
+				}
+				continue
+			}
+			current = node
+		}
+	}
+	return root
+}
+
+// parseStartTag parses the start tag at the beginning of s and returns its
+// length, 0 when s does not start with a tag.
+func parseStartTag(s string) (name string, attrs [][2]string, selfClosing bool, n int) {
+	if len(s) < 2 || !(s[1] >= 'a' && s[1] <= 'z' || s[1] >= 'A' && s[1] <= 'Z') {
+		return "", nil, false, 0
+	}
+	i := 1
+	for i < len(s) && isTagNameChar(s[i]) {
+		i++
+	}
+	name = strings.ToLower(s[1:i])
+	for i < len(s) {
+		for i < len(s) && isHTMLSpace(s[i]) {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+		switch s[i] {
+		case '>':
+			return name, attrs, selfClosing, i + 1
+		case '/':
+			selfClosing = true
+			i++
+			continue
+		}
+		selfClosing = false
+		start := i
+		for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		if i == start {
+			// a stray = or quote
+			i++
+			continue
+		}
+		attrName := strings.ToLower(s[start:i])
+		for i < len(s) && isHTMLSpace(s[i]) {
+			i++
+		}
+		var value string
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isHTMLSpace(s[i]) {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				quote := s[i]
+				end := strings.IndexByte(s[i+1:], quote)
+				if end < 0 {
+					return "", nil, false, 0
+				}
+				value = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start := i
+				for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+				value = s[start:i]
+			}
+		}
+		attrs = append(attrs, [2]string{attrName, html.UnescapeString(value)})
+	}
+	return "", nil, false, 0
+}
+
+func isTagNameChar(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '-' || ch == ':' || ch == '_'
+}
+
+func isHTMLSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f'
+}
+
+// indexFold is strings.Index ignoring ASCII case.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,108 @@
+package operators
+
+import (
+	"encoding/json"
+
+	"github.com/chainreactors/neutron/common"
+)
+
+// The stdlib json engine backs the `json` matcher and extractor types, so
+// JSON-API templates also run in builds without operators/full. Importing
+// operators/full replaces it with gojq, its init runs after this one.
+func init() {
+	RegisterExtractorType("json", JSONExtractor, compileJSONExtractor, extractJSON)
+	RegisterMatcherType("json", JSONMatcher, compileJSONMatcher, matchJSON)
+}
+
+func compileJSONQueries(queries []string) ([]*JSONQuery, error) {
+	compiled := make([]*JSONQuery, 0, len(queries))
+	for _, query := range queries {
+		q, err := CompileJSONQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, q)
+	}
+	return compiled, nil
+}
+
+func compileJSONExtractor(e *Extractor) error {
+	compiled, err := compileJSONQueries(e.JSON)
+	if err != nil {
+		return err
+	}
+	e.SetCompiledData(compiled)
+	return nil
+}
+
+func compileJSONMatcher(m *Matcher) error {
+	compiled, err := compileJSONQueries(m.JSON)
+	if err != nil {
+		return err
+	}
+	m.SetCompiledData(compiled)
+	return nil
+}
+
+func extractJSON(e *Extractor, corpus string, _ map[string]interface{}) map[string]struct{} {
+	results := make(map[string]struct{})
+
+	var jsonObj interface{}
+	if err := json.Unmarshal([]byte(corpus), &jsonObj); err != nil {
+		return results
+	}
+	compiled, ok := e.GetCompiledData().([]*JSONQuery)
+	if !ok {
+		return results
+	}
+	for _, query := range compiled {
+		for _, v := range query.Evaluate(jsonObj) {
+			var result string
+			if res, err := common.JSONScalarToString(v); err == nil {
+				result = res
+			} else if res, err := json.Marshal(v); err == nil {
+				result = string(res)
+			} else {
+				result = common.ToString(v)
+			}
+			results[result] = struct{}{}
+		}
+	}
+	return results
+}
+
+// matchJSON matches when the first output of a query is truthy, like the
+// gojq matcher of operators/full.
+func matchJSON(m *Matcher, corpus string, _ map[string]interface{}) (bool, []MatchHit) {
+	var jsonObj interface{}
+	if err := json.Unmarshal([]byte(corpus), &jsonObj); err != nil {
+		return false, nil
+	}
+	compiled, ok := m.GetCompiledData().([]*JSONQuery)
+	if !ok {
+		return false, nil
+	}
+
+	var matchedItems []MatchHit
+	for i, query := range compiled {
+		values := query.Evaluate(jsonObj)
+		if len(values) == 0 || !isJSONTruthy(values[0]) {
+			if m.GetCondition() == ANDCondition {
+				return false, nil
+			}
+			continue
+		}
+		matchedItems = append(matchedItems, MatchHit{Value: common.ToString(values[0]), Rule: m.JSON[i]})
+
+		if m.GetCondition() == ORCondition && !m.MatchAll {
+			return true, matchedItems
+		}
+		if len(compiled)-1 == i && !m.MatchAll {
+			return true, matchedItems
+		}
+	}
+	if len(matchedItems) > 0 && m.MatchAll {
+		return true, matchedItems
+	}
+	return false, nil
+}
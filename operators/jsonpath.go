@@ -0,0 +1,501 @@
+package operators
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONQuery is a compiled query of the stdlib json engine. It accepts the
+// jq path subset templates use, plus the JSONPath spellings of the same
+// operations:
+//
+//	.                      the input itself ($ and @ are accepted as well)
+//	.foo.bar ."a-b" ["a"]  object fields, null when the field is missing
+//	[0] [-1]               array indices, negative from the end
+//	.[] [*] .*             every array element or object value
+//	..  ..foo  $..foo      recursive descent, ..foo only emits existing fields
+//	[?(@.id == "x")]       the elements / values the filter is true for
+//	a | select(.n > 1)     pipes and select with a single comparison
+//
+// Comparisons are ==, !=, <, <=, > and >= between a relative path and a
+// JSON literal (or another path); a lone path tests for truthiness.
+//
+// Everything else gojq supports is out of scope and is rejected at compile
+// time: functions (length, keys, map, test...), arithmetic, the // and ?
+// operators, and/or inside filters, slices, object and array construction,
+// variables and reduce. Templates that need them must import operators/full.
+type JSONQuery struct {
+	source string
+	steps  []jsonStep
+}
+
+type jsonStep func(v interface{}) []interface{}
+
+// CompileJSONQuery compiles query, see JSONQuery for the syntax.
+func CompileJSONQuery(query string) (*JSONQuery, error) {
+	p := &jsonQueryParser{input: query}
+	steps, err := p.parsePipeline()
+	if err != nil {
+		return nil, fmt.Errorf("could not compile json query %s: %v", query, err)
+	}
+	return &JSONQuery{source: query, steps: steps}, nil
+}
+
+// String returns the source of the query.
+func (q *JSONQuery) String() string {
+	return q.source
+}
+
+// Evaluate runs the query on a decoded JSON value and returns its outputs.
+func (q *JSONQuery) Evaluate(v interface{}) []interface{} {
+	return runJSONSteps(q.steps, v)
+}
+
+func runJSONSteps(steps []jsonStep, v interface{}) []interface{} {
+	values := []interface{}{v}
+	for _, step := range steps {
+		var next []interface{}
+		for _, value := range values {
+			next = append(next, step(value)...)
+		}
+		values = next
+	}
+	return values
+}
+
+type jsonQueryParser struct {
+	input string
+	pos   int
+}
+
+func (p *jsonQueryParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *jsonQueryParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *jsonQueryParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\n' || p.peek() == '\r') {
+		p.pos++
+	}
+}
+
+func (p *jsonQueryParser) expect(ch byte) error {
+	p.skipSpaces()
+	if p.peek() != ch {
+		return p.unexpected()
+	}
+	p.pos++
+	return nil
+}
+
+func (p *jsonQueryParser) unexpected() error {
+	if p.eof() {
+		return fmt.Errorf("unexpected end of query")
+	}
+	return fmt.Errorf("unexpected %q at offset %d", p.input[p.pos:], p.pos)
+}
+
+func (p *jsonQueryParser) parsePipeline() ([]jsonStep, error) {
+	var steps []jsonStep
+	for {
+		p.skipSpaces()
+		if strings.HasPrefix(p.input[p.pos:], "select(") {
+			p.pos += len("select(")
+			condition, err := p.parseCondition()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(')'); err != nil {
+				return nil, err
+			}
+			steps = append(steps, func(v interface{}) []interface{} {
+				if condition(v) {
+					return []interface{}{v}
+				}
+				return nil
+			})
+		} else {
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, path...)
+		}
+		p.skipSpaces()
+		if p.eof() {
+			return steps, nil
+		}
+		if err := p.expect('|'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parsePath parses a path starting with ., $ or @.
+func (p *jsonQueryParser) parsePath() ([]jsonStep, error) {
+	switch p.peek() {
+	case '$', '@':
+		p.pos++
+	case '.', '[':
+	default:
+		return nil, p.unexpected()
+	}
+
+	var steps []jsonStep
+	// lenient steps skip the values they do not apply to, as after ..
+	lenient := false
+	for !p.eof() {
+		switch {
+		case strings.HasPrefix(p.input[p.pos:], ".."):
+			p.pos += 2
+			steps = append(steps, recurseJSON)
+			lenient = true
+			if isJSONIdentifier(p.peek()) {
+				steps = append(steps, jsonField(p.identifier(), true))
+				lenient = false
+			} else if p.peek() == '*' {
+				p.pos++
+				steps = append(steps, iterateJSON)
+				lenient = false
+			}
+			continue
+		case p.peek() == '.':
+			p.pos++
+			switch ch := p.peek(); {
+			case isJSONIdentifier(ch):
+				steps = append(steps, jsonField(p.identifier(), lenient))
+			case ch == '"':
+				key, err := p.quoted()
+				if err != nil {
+					return nil, err
+				}
+				steps = append(steps, jsonField(key, lenient))
+			case ch == '*':
+				p.pos++
+				steps = append(steps, iterateJSON)
+			case ch == '[':
+				continue
+			}
+		case p.peek() == '[':
+			p.pos++
+			step, err := p.parseBracket(lenient)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		default:
+			return steps, nil
+		}
+		lenient = false
+	}
+	return steps, nil
+}
+
+func (p *jsonQueryParser) parseBracket(lenient bool) (jsonStep, error) {
+	p.skipSpaces()
+	switch ch := p.peek(); {
+	case ch == ']':
+		p.pos++
+		return iterateJSON, nil
+	case ch == '*':
+		p.pos++
+		return iterateJSON, p.expect(']')
+	case ch == '"' || ch == '\'':
+		key, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return jsonField(key, lenient), p.expect(']')
+	case ch == '?':
+		p.pos++
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		condition, err := p.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		return func(v interface{}) []interface{} {
+			var out []interface{}
+			for _, child := range iterateJSON(v) {
+				if condition(child) {
+					out = append(out, child)
+				}
+			}
+			return out
+		}, p.expect(']')
+	case ch == '-' || ch >= '0' && ch <= '9':
+		start := p.pos
+		p.pos++
+		for p.peek() >= '0' && p.peek() <= '9' {
+			p.pos++
+		}
+		index, err := strconv.Atoi(p.input[start:p.pos])
+		if err != nil {
+			return nil, err
+		}
+		return jsonIndex(index, lenient), p.expect(']')
+	}
+	return nil, p.unexpected()
+}
+
+var jsonComparisons = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseCondition parses `operand [op operand]`.
+func (p *jsonQueryParser) parseCondition() (func(v interface{}) bool, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	var op string
+	for _, candidate := range jsonComparisons {
+		if strings.HasPrefix(p.input[p.pos:], candidate) {
+			op = candidate
+			p.pos += len(candidate)
+			break
+		}
+	}
+	if op == "" {
+		return func(v interface{}) bool {
+			value, ok := left(v)
+			return ok && isJSONTruthy(value)
+		}, nil
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return func(v interface{}) bool {
+		a, _ := left(v)
+		b, _ := right(v)
+		return compareJSON(op, a, b)
+	}, nil
+}
+
+// parseOperand parses a relative path, whose first output is used, or a
+// JSON literal.
+func (p *jsonQueryParser) parseOperand() (func(v interface{}) (interface{}, bool), error) {
+	p.skipSpaces()
+	switch ch := p.peek(); {
+	case ch == '.' || ch == '@' || ch == '$':
+		steps, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return func(v interface{}) (interface{}, bool) {
+			values := runJSONSteps(steps, v)
+			if len(values) == 0 {
+				return nil, false
+			}
+			return values[0], true
+		}, nil
+	case ch == '"' || ch == '\'':
+		literal, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return constantJSON(literal), nil
+	}
+	start := p.pos
+	for !p.eof() && strings.IndexByte(" \t\r\n)]|=!<>", p.peek()) < 0 {
+		p.pos++
+	}
+	token := p.input[start:p.pos]
+	switch token {
+	case "true":
+		return constantJSON(true), nil
+	case "false":
+		return constantJSON(false), nil
+	case "null":
+		return constantJSON(nil), nil
+	}
+	number, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.unexpected()
+	}
+	return constantJSON(number), nil
+}
+
+func constantJSON(value interface{}) func(interface{}) (interface{}, bool) {
+	return func(interface{}) (interface{}, bool) {
+		return value, true
+	}
+}
+
+func (p *jsonQueryParser) identifier() string {
+	start := p.pos
+	for isJSONIdentifier(p.peek()) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+// quoted parses a double quoted JSON string or a single quoted JSONPath one.
+func (p *jsonQueryParser) quoted() (string, error) {
+	quote := p.peek()
+	start := p.pos
+	p.pos++
+	for !p.eof() && p.peek() != quote {
+		if p.peek() == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.eof() {
+		return "", fmt.Errorf("unterminated string")
+	}
+	p.pos++
+	if quote == '\'' {
+		return strings.Replace(p.input[start+1:p.pos-1], `\'`, `'`, -1), nil
+	}
+	return strconv.Unquote(p.input[start:p.pos])
+}
+
+func isJSONIdentifier(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
+
+// jsonField looks key up in objects. Like jq, a missing key and a null input
+// give null; lenient fields only emit existing keys.
+func jsonField(key string, lenient bool) jsonStep {
+	return func(v interface{}) []interface{} {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			if field, ok := value[key]; ok {
+				return []interface{}{field}
+			}
+		case nil:
+		default:
+			return nil
+		}
+		if lenient {
+			return nil
+		}
+		return []interface{}{nil}
+	}
+}
+
+func jsonIndex(index int, lenient bool) jsonStep {
+	return func(v interface{}) []interface{} {
+		array, ok := v.([]interface{})
+		if !ok {
+			if v == nil && !lenient {
+				return []interface{}{nil}
+			}
+			return nil
+		}
+		i := index
+		if i < 0 {
+			i += len(array)
+		}
+		if i < 0 || i >= len(array) {
+			if lenient {
+				return nil
+			}
+			return []interface{}{nil}
+		}
+		return []interface{}{array[i]}
+	}
+}
+
+// iterateJSON returns the elements of an array or the values of an object,
+// ordered by key like gojq.
+func iterateJSON(v interface{}) []interface{} {
+	switch value := v.(type) {
+	case []interface{}:
+		return value
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := make([]interface{}, len(keys))
+		for i, key := range keys {
+			out[i] = value[key]
+		}
+		return out
+	}
+	return nil
+}
+
+// recurseJSON returns v and everything below it, depth first like jq's `..`.
+func recurseJSON(v interface{}) []interface{} {
+	out := []interface{}{v}
+	for _, child := range iterateJSON(v) {
+		out = append(out, recurseJSON(child)...)
+	}
+	return out
+}
+
+func compareJSON(op string, a, b interface{}) bool {
+	switch op {
+	case "==":
+		return reflect.DeepEqual(a, b)
+	case "!=":
+		return !reflect.DeepEqual(a, b)
+	}
+	var cmp int
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(x, y)
+	default:
+		return false
+	}
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// isJSONTruthy follows jq, where only null and false are falsy, except that
+// like the operators/full matcher 0 and "" are falsy too.
+func isJSONTruthy(v interface{}) bool {
+	switch value := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return value
+	case float64:
+		return value != 0
+	case string:
+		return value != ""
+	default:
+		return true
+	}
+}
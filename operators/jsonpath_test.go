@@ -0,0 +1,110 @@
+package operators
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const jsonQueryCorpus = `{
+	"name": "api",
+	"version": {"major": 2, "tag": "v2.1"},
+	"a-b": "dash",
+	"items": [
+		{"id": "x", "name": "first", "price": 5, "active": true},
+		{"id": "y", "name": "second", "price": 12, "active": false},
+		{"id": "z", "name": "third", "price": 20, "tags": {"name": "nested"}}
+	],
+	"empty": null
+}`
+
+func TestJSONQueryEvaluate(t *testing.T) {
+	var corpus interface{}
+	require.NoError(t, json.Unmarshal([]byte(jsonQueryCorpus), &corpus))
+
+	for query, expected := range map[string][]interface{}{
+		`.name`:                                 {"api"},
+		`$.version.tag`:                         {"v2.1"},
+		`.version["major"]`:                     {float64(2)},
+		`."a-b"`:                                {"dash"},
+		`.['a-b']`:                              {"dash"},
+		`.missing`:                              {nil},
+		`.empty.deeper`:                         {nil},
+		`.name.deeper`:                          nil,
+		`.items[0].id`:                          {"x"},
+		`.items[-1].id`:                         {"z"},
+		`.items[7]`:                             {nil},
+		`.items[].id`:                           {"x", "y", "z"},
+		`.items[*].price`:                       {float64(5), float64(12), float64(20)},
+		`.version.*`:                            {float64(2), "v2.1"},
+		`.version[]`:                            {float64(2), "v2.1"},
+		`..name`:                                {"api", "first", "second", "third", "nested"},
+		`$..tags.name`:                          {"nested"},
+		`.items[?(@.price > 10)].id`:            {"y", "z"},
+		`.items[?(@.active)].id`:                {"x"},
+		`.items[?(@.id != 'y')].name`:           {"first", "third"},
+		`.items[] | select(.id == "x") | .name`: {"first"},
+		`.items[] | select(.price <= 12) | .price`:  {float64(5), float64(12)},
+		`.items[] | select(.tags) | .tags.name`:     {"nested"},
+		`.items[] | select(.active == false) | .id`: {"y"},
+		`.version | .major`:                         {float64(2)},
+		`.`:                                         {corpus},
+	} {
+		compiled, err := CompileJSONQuery(query)
+		require.NoError(t, err, query)
+		actual := compiled.Evaluate(corpus)
+		if query == `..name` {
+			sort.Slice(actual, func(i, j int) bool { return actual[i].(string) < actual[j].(string) })
+			sort.Slice(expected, func(i, j int) bool { return expected[i].(string) < expected[j].(string) })
+		}
+		require.Equal(t, expected, actual, query)
+	}
+}
+
+func TestJSONQueryOutOfScope(t *testing.T) {
+	for _, query := range []string{
+		`.items | length`,
+		`.name // empty`,
+		`.items[]?`,
+		`.items[1:2]`,
+		`[.name]`,
+		`.items[] | select(.id == "x" and .active)`,
+		`.name +`,
+		`select(.id == )`,
+		`.foo |`,
+		`.["unterminated]`,
+	} {
+		_, err := CompileJSONQuery(query)
+		require.Error(t, err, query)
+	}
+}
+
+func TestStdlibJSONOperators(t *testing.T) {
+	corpus := `{"issuer_org":["Google Trust Services","Foo"],"subject_cn":"www.example.com","hash":{"md5":"x"},"ok":true,"count":0}`
+
+	extractor := &Extractor{Type: "json", JSON: []string{".issuer_org[]", ".subject_cn", ".hash", ".nope"}}
+	require.NoError(t, extractor.CompileExtractors())
+	require.Equal(t, map[string]struct{}{
+		"Google Trust Services": {},
+		"Foo":                   {},
+		"www.example.com":       {},
+		`{"md5":"x"}`:           {},
+		"":                      {},
+	}, extractor.ExtractWithHandler(corpus, nil))
+
+	matcher := &Matcher{Type: "json", JSON: []string{".ok", ".count"}, Condition: "and"}
+	require.NoError(t, matcher.CompileMatchers())
+	matched, _ := matcher.MatchWithHandler(corpus, nil)
+	require.False(t, matched, "0 is falsy")
+
+	matcher = &Matcher{Type: "json", JSON: []string{".count", `.issuer_org[] | select(. == "Foo")`}}
+	require.NoError(t, matcher.CompileMatchers())
+	matched, hits := matcher.MatchWithHandler(corpus, nil)
+	require.True(t, matched)
+	require.Equal(t, []MatchHit{{Value: "Foo", Rule: `.issuer_org[] | select(. == "Foo")`}}, hits)
+
+	err := (&Matcher{Type: "json", JSON: []string{".a | keys"}}).CompileMatchers()
+	require.Error(t, err)
+}
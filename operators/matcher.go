@@ -3,8 +3,8 @@ package operators
 import (
 	"encoding/hex"
 	"fmt"
-	"github.com/Knetic/govaluate"
 	"github.com/chainreactors/neutron/common"
+	"github.com/chainreactors/neutron/common/dsl"
 	"regexp"
 	"strings"
 )
@@ -44,6 +44,8 @@ type Matcher struct {
 	JSON []string `json:"json,omitempty" yaml:"json,omitempty"`
 	// XPath contains xpath expressions used for matching html/xml response
 	XPath []string `json:"xpath,omitempty" yaml:"xpath,omitempty"`
+	// CSS contains css selectors used for matching html response
+	CSS []string `json:"css,omitempty" yaml:"css,omitempty"`
 	// Encoding specifies the encoding for the word content if any.
 	Encoding string `json:"encoding,omitempty" yaml:"encoding,omitempty"`
 	// description: |
@@ -56,7 +58,7 @@ type Matcher struct {
 	condition       ConditionType
 	matcherType     MatcherType
 	regexCompiled   []*regexp.Regexp
-	dslCompiled     []*govaluate.EvaluableExpression
+	dslCompiled     []*dsl.Expression
 	binaryDecoded   []string
 	compiledData    interface{}
 }
@@ -129,7 +131,7 @@ func (m *Matcher) CompileMatchers() error {
 
 	// Compile the dsl expressions
 	for _, dslExpression := range m.DSL {
-		compiledExpression, err := govaluate.NewEvaluableExpressionWithFunctions(dslExpression, common.GetHelperFunctions())
+		compiledExpression, err := dsl.CompileExpression(dslExpression)
 		if err != nil {
 			return fmt.Errorf("could not compile dsl expression: %s", dslExpression)
 		}
@@ -320,7 +322,7 @@ func (m *Matcher) MatchDSL(data map[string]interface{}) bool {
 				common.Logger().Errorf(m.Name, err)
 				return false
 			}
-			expression, err = govaluate.NewEvaluableExpressionWithFunctions(resolvedExpression, common.GetHelperFunctions())
+			expression, err = dsl.CompileExpression(resolvedExpression)
 			if err != nil {
 				common.Logger().Errorf(m.Name, err)
 				return false
@@ -3,6 +3,7 @@ package operators
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/chainreactors/neutron/common"
 	"github.com/chainreactors/utils/parsers"
@@ -18,9 +19,14 @@ type Operators struct {
 	Extractors []*Extractor `json:"extractors,omitempty" yaml:"extractors,omitempty"`
 	// MatchersCondition is the condition of the matchers
 	// whether to use AND or OR. Default is OR.
+	//
+	// It can also be a boolean expression over the matcher names, e.g.
+	// `(version and banner) or favicon`, with and, or, not and parentheses.
+	// Unnamed matchers are referenced as <type>-<n>.
 	MatchersCondition string `json:"matchers-condition,omitempty" yaml:"matchers-condition,omitempty"`
 	// cached variables that may be used along with request.
-	matchersCondition ConditionType
+	matchersCondition  ConditionType
+	matchersExpression *conditionExpression
 
 	// TemplateID is the ID of the template for matcher
 	TemplateID string `json:"templateID,omitempty" yaml:"templateID,omitempty"`
@@ -28,12 +34,17 @@ type Operators struct {
 
 type Result = parsers.NeutronResult
 
+// TemplateEvent is a single match or extract event recorded on a Result.
+type TemplateEvent = parsers.TemplateEvent
+
 func (r *Operators) Compile() error {
 	if r == nil {
 		return fmt.Errorf("operators is nil")
 	}
-	if r.MatchersCondition != "" {
-		r.matchersCondition = conditionTypes[r.MatchersCondition]
+	if isConditionExpression(r.MatchersCondition) {
+		r.matchersCondition = ExpressionCondition
+	} else if r.MatchersCondition != "" {
+		r.matchersCondition = conditionTypes[strings.ToLower(r.MatchersCondition)]
 	} else {
 		r.matchersCondition = ORCondition
 	}
@@ -53,6 +64,13 @@ func (r *Operators) Compile() error {
 			return err
 		}
 	}
+	if r.matchersCondition == ExpressionCondition {
+		expression, err := compileConditionExpression(r.MatchersCondition, r.Matchers)
+		if err != nil {
+			return err
+		}
+		r.matchersExpression = expression
+	}
 	return nil
 }
 
@@ -71,6 +89,10 @@ type extractFunc func(data map[string]interface{}, matcher *Extractor) map[strin
 
 // Execute executes the operators on data and returns a result structure
 func (operators *Operators) Execute(data map[string]interface{}, match matchFunc, extract extractFunc) (*Result, bool) {
+	return operators.execute(data, match, extract, nil)
+}
+
+func (operators *Operators) execute(data map[string]interface{}, match matchFunc, extract extractFunc, explanation *explainer) (*Result, bool) {
 	matcherCondition := operators.GetMatchersCondition()
 
 	var matches bool
@@ -87,7 +109,7 @@ func (operators *Operators) Execute(data map[string]interface{}, match matchFunc
 		}
 
 		if extractor.GetType() == DSLExtractor {
-			typedResults := extractor.ExtractDSLTyped(data)
+			typedResults := extractor.PostProcess(extractor.ExtractDSLTyped(data), data)
 			if len(typedResults) == 0 {
 				continue
 			}
@@ -111,9 +133,8 @@ func (operators *Operators) Execute(data map[string]interface{}, match matchFunc
 			continue
 		}
 
-		var extractorResults []string
-		for m := range extract(data, extractor) {
-			extractorResults = append(extractorResults, m)
+		extractorResults := extractor.postProcessSet(extract(data, extractor), data)
+		for _, m := range extractorResults {
 			if extractor.Internal {
 				result.DynamicValues[extractor.Name] = m
 			} else {
@@ -134,30 +155,49 @@ func (operators *Operators) Execute(data map[string]interface{}, match matchFunc
 	}
 
 	var andEvents []parsers.TemplateEvent
-	for matcherIndex, matcher := range operators.Matchers {
-		if isMatch, matched := match(data, matcher); isMatch {
-			common.Debug("Matched: %+v", matcher)
-			matcherName := getMatcherName(matcher, matcherIndex)
-			evts := make([]parsers.TemplateEvent, len(matched))
-			for i, h := range matched {
-				evts[i] = parsers.TemplateEvent{Type: "match", Name: matcherName, Rule: h.Rule, Value: h.Value}
+	var andFailed bool
+	if matcherCondition == ExpressionCondition {
+		matches = operators.executeExpression(data, match, result, explanation)
+	} else {
+		for matcherIndex, matcher := range operators.Matchers {
+			isMatch, matched := match(data, matcher)
+			if explanation != nil {
+				explanation.matcher(matcher, matcherIndex, isMatch, data)
 			}
-			if matcherCondition == ORCondition {
-				if matcher.Name != "" {
-					result.Events = append(result.Events, evts...)
+			if isMatch {
+				common.Debug("Matched: %+v", matcher)
+				matcherName := getMatcherName(matcher, matcherIndex)
+				evts := make([]parsers.TemplateEvent, len(matched))
+				for i, h := range matched {
+					evts[i] = parsers.TemplateEvent{Type: "match", Name: matcherName, Rule: h.Rule, Value: h.Value}
+				}
+				if matcherCondition == ORCondition {
+					if matcher.Name != "" {
+						result.Events = append(result.Events, evts...)
+					}
+				} else {
+					andEvents = append(andEvents, evts...)
+				}
+				matches = true
+			} else if matcherCondition == ANDCondition {
+				common.Debug("Not Matched: %+v", matcher)
+				if explanation == nil {
+					return nil, false
 				}
+				// keep going so that every matcher is explained
+				andFailed = true
 			} else {
-				andEvents = append(andEvents, evts...)
+				common.Debug("Not Matched: %+v", matcher)
 			}
-			matches = true
-		} else if matcherCondition == ANDCondition {
-			common.Debug("Not Matched: %+v", matcher)
-			return nil, false
-		} else {
-			common.Debug("Not Matched: %+v", matcher)
 		}
 	}
 
+	if andFailed {
+		matches = false
+	}
+	if explanation != nil {
+		explanation.finish(matches)
+	}
 	if matcherCondition == ANDCondition && matches {
 		result.Events = append(result.Events, andEvents...)
 	}
@@ -187,7 +227,7 @@ func (operators *Operators) ExecuteInternalExtractors(data map[string]interface{
 			continue
 		}
 		if extractor.GetType() == DSLExtractor {
-			typedResults := extractor.ExtractDSLTyped(data)
+			typedResults := extractor.PostProcess(extractor.ExtractDSLTyped(data), data)
 			if len(typedResults) == 1 {
 				dynamicValues[extractor.Name] = typedResults[0]
 			} else if len(typedResults) > 1 {
@@ -195,7 +235,7 @@ func (operators *Operators) ExecuteInternalExtractors(data map[string]interface{
 			}
 			continue
 		}
-		for match := range extract(data, extractor) {
+		for _, match := range extractor.postProcessSet(extract(data, extractor), data) {
 			if _, ok := dynamicValues[extractor.Name]; !ok {
 				dynamicValues[extractor.Name] = match
 			}
@@ -274,6 +314,37 @@ func getExtractedValue(values []string) interface{} {
 	}
 }
 
+// executeExpression evaluates the matchers-condition expression, each
+// matcher at most once, and records the events of the matchers that made it
+// true.
+func (operators *Operators) executeExpression(data map[string]interface{}, match matchFunc, result *Result, explanation *explainer) bool {
+	hits := make(map[int][]MatchHit)
+	evaluated := make(map[int]bool)
+	matches, contributors := operators.matchersExpression.eval(func(index int) bool {
+		if isMatch, ok := evaluated[index]; ok {
+			return isMatch
+		}
+		matcher := operators.Matchers[index]
+		isMatch, matched := match(data, matcher)
+		if explanation != nil {
+			explanation.matcher(matcher, index, isMatch, data)
+		}
+		evaluated[index] = isMatch
+		hits[index] = matched
+		return isMatch
+	})
+	if !matches {
+		return false
+	}
+	for _, index := range contributors {
+		matcherName := getMatcherName(operators.Matchers[index], index)
+		for _, h := range hits[index] {
+			result.Events = append(result.Events, parsers.TemplateEvent{Type: "match", Name: matcherName, Rule: h.Rule, Value: h.Value})
+		}
+	}
+	return true
+}
+
 func getMatcherName(matcher *Matcher, matcherIndex int) string {
 	if matcher.Name != "" {
 		return matcher.Name
@@ -202,3 +202,242 @@ func TestMatcherDSLMissingVariablesAreNotDefaulted(t *testing.T) {
 		}))
 	})
 }
+
+func TestOperatorsExecuteWithExplanation(t *testing.T) {
+	match := func(data map[string]interface{}, matcher *Matcher) (bool, []MatchHit) {
+		corpus, _ := data[matcher.Part].(string)
+		switch matcher.GetType() {
+		case DSLMatcher:
+			return matcher.Result(matcher.MatchDSL(data)), nil
+		case StatusMatcher:
+			return matcher.Result(matcher.MatchStatusCode(data["status_code"].(int))), nil
+		case RegexMatcher:
+			return matcher.ResultWithMatchedSnippet(matcher.MatchRegex(corpus))
+		default:
+			return matcher.ResultWithMatchedSnippet(matcher.MatchWords(corpus, data))
+		}
+	}
+	extract := func(data map[string]interface{}, extractor *Extractor) map[string]struct{} { return nil }
+	data := map[string]interface{}{"body": "<title>Admin</title>", "status_code": 403}
+
+	ops := &Operators{
+		MatchersCondition: "and",
+		Matchers: []*Matcher{
+			{Type: "status", Status: []int{200, 302}},
+			{Type: "word", Name: "admin", Words: []string{"Admin", "login"}, Condition: "and"},
+			{Type: "dsl", DSL: []string{`status_code == 403 && contains(body, "Admin")`}},
+			{Type: "regex", Part: "headers", Regex: []string{"nginx"}},
+		},
+	}
+	require.NoError(t, ops.Compile())
+
+	result, ok, explanation := ops.ExecuteWithExplanation(data, match, extract, func(part string) (string, bool) {
+		item, ok := data[part].(string)
+		return item, ok
+	})
+	require.Nil(t, result)
+	require.False(t, ok)
+	require.False(t, explanation.Matched)
+	require.Equal(t, "and", explanation.Condition)
+	require.Equal(t, `matchers "status-1", "admin", "regex-4" did not match`, explanation.Reason)
+	require.Len(t, explanation.Matchers, 4, "every matcher is explained after the and condition failed")
+
+	status := explanation.Matchers[0]
+	require.Equal(t, "status_code", status.Part)
+	require.Equal(t, "none of the 2 conditions matched", status.Reason)
+	require.Equal(t, &ConditionExplanation{Rule: "200", Value: "403"}, status.Conditions[0])
+
+	words := explanation.Matchers[1]
+	require.Equal(t, "body", words.Part)
+	require.Equal(t, `"login" did not match`, words.Reason)
+	require.True(t, words.Conditions[0].Matched)
+	require.False(t, words.Conditions[1].Matched)
+
+	expression := explanation.Matchers[2]
+	require.True(t, expression.Matched)
+	require.Equal(t, "true", expression.Conditions[0].Value)
+	require.Equal(t, map[string]interface{}{"status_code": 403, "body": "<title>Admin</title>"}, expression.Conditions[0].Variables)
+
+	require.Equal(t, "part headers not found", explanation.Matchers[3].Reason)
+	require.Contains(t, explanation.String(), `[miss] admin part=body condition=and ("login" did not match)`)
+
+	// the explanation does not change the result of Execute
+	result, ok = ops.Execute(data, match, extract)
+	require.Nil(t, result)
+	require.False(t, ok)
+}
+
+func TestOperatorsExplanationOR(t *testing.T) {
+	ops := &Operators{Matchers: []*Matcher{
+		{Type: "dsl", DSL: []string{`missing == 1`, `to_upper(body)`}},
+	}}
+	require.NoError(t, ops.Compile())
+	match := func(data map[string]interface{}, matcher *Matcher) (bool, []MatchHit) {
+		return matcher.MatchDSL(data), nil
+	}
+	_, ok, explanation := ops.ExecuteWithExplanation(map[string]interface{}{"body": "x"}, match, nil, nil)
+	require.False(t, ok)
+	require.Equal(t, "none of the 1 matchers matched", explanation.Reason)
+	conditions := explanation.Matchers[0].Conditions
+	require.Equal(t, "No parameter 'missing' found.", conditions[0].Error)
+	require.Equal(t, "X", conditions[1].Value)
+	require.Equal(t, "the expression does not return a boolean", conditions[1].Error)
+}
+
+func TestOperatorsMatchersConditionExpression(t *testing.T) {
+	var evaluated []string
+	match := func(data map[string]interface{}, matcher *Matcher) (bool, []MatchHit) {
+		evaluated = append(evaluated, matcher.Name)
+		return matcher.ResultWithMatchedSnippet(matcher.MatchWords(data["body"].(string), data))
+	}
+	newOperators := func(condition string) *Operators {
+		ops := &Operators{
+			MatchersCondition: condition,
+			Matchers: []*Matcher{
+				{Type: "word", Name: "version", Words: []string{"v1.2"}},
+				{Type: "word", Name: "banner", Words: []string{"Acme"}},
+				{Type: "word", Name: "favicon", Words: []string{"favicon"}},
+			},
+		}
+		require.NoError(t, ops.Compile())
+		return ops
+	}
+
+	t.Run("only contributing matchers produce events", func(t *testing.T) {
+		evaluated = nil
+		ops := newOperators("(version and banner) or favicon")
+		result, ok := ops.Execute(map[string]interface{}{"body": "Acme v1.2 favicon"}, match, nil)
+		require.True(t, ok)
+		require.True(t, result.Matched)
+		require.Equal(t, []string{"version", "banner"}, evaluated, "favicon is short-circuited")
+		require.Equal(t, []TemplateEvent{
+			{Type: "match", Name: "version", Rule: "v1.2", Value: "v1.2"},
+			{Type: "match", Name: "banner", Rule: "Acme", Value: "Acme"},
+		}, result.Events)
+	})
+
+	t.Run("falls through to the or branch", func(t *testing.T) {
+		evaluated = nil
+		ops := newOperators("(version and banner) or favicon")
+		result, ok := ops.Execute(map[string]interface{}{"body": "Acme favicon"}, match, nil)
+		require.True(t, ok)
+		require.Equal(t, []string{"version", "favicon"}, evaluated, "banner is short-circuited")
+		require.Equal(t, []TemplateEvent{{Type: "match", Name: "favicon", Rule: "favicon", Value: "favicon"}}, result.Events)
+	})
+
+	t.Run("not and precedence", func(t *testing.T) {
+		ops := newOperators("banner and not version or favicon")
+		result, ok := ops.Execute(map[string]interface{}{"body": "Acme"}, match, nil)
+		require.True(t, ok)
+		require.Equal(t, []TemplateEvent{{Type: "match", Name: "banner", Rule: "Acme", Value: "Acme"}}, result.Events)
+
+		result, ok = ops.Execute(map[string]interface{}{"body": "Acme v1.2"}, match, nil)
+		require.False(t, ok)
+		require.Nil(t, result)
+	})
+
+	t.Run("explanation", func(t *testing.T) {
+		ops := newOperators("version and (banner or favicon)")
+		_, ok, explanation := ops.ExecuteWithExplanation(map[string]interface{}{"body": "v1.2"}, match, nil, nil)
+		require.False(t, ok)
+		require.Equal(t, "version and (banner or favicon)", explanation.Condition)
+		require.Equal(t, `matchers "banner", "favicon" did not match`, explanation.Reason)
+	})
+
+	t.Run("unnamed matchers", func(t *testing.T) {
+		ops := &Operators{
+			MatchersCondition: "word-1 or status-2",
+			Matchers:          []*Matcher{{Type: "word", Words: []string{"x"}}, {Type: "status", Status: []int{200}}},
+		}
+		require.NoError(t, ops.Compile())
+		require.Equal(t, ExpressionCondition, ops.GetMatchersCondition())
+	})
+
+	t.Run("flat conditions in any case", func(t *testing.T) {
+		for condition, expected := range map[string]ConditionType{"AND": ANDCondition, "Or": ORCondition, "and": ANDCondition} {
+			require.Equal(t, expected, newOperators(condition).GetMatchersCondition(), condition)
+		}
+	})
+
+	for condition, expected := range map[string]string{
+		"version and banner":                 "matcher favicon is not referenced",
+		"version and banner or fav":          "unknown matcher fav",
+		"(version and banner or favicon":     "missing )",
+		"version and or banner and favicon":  `unexpected "or"`,
+		"version banner or favicon":          `unexpected "banner"`,
+		"version and banner or favicon and":  "unexpected end of expression",
+		"version and (banner) or favicon) x": `unexpected ")"`,
+	} {
+		err := (&Operators{
+			MatchersCondition: condition,
+			Matchers: []*Matcher{
+				{Type: "word", Name: "version", Words: []string{"v1.2"}},
+				{Type: "word", Name: "banner", Words: []string{"Acme"}},
+				{Type: "word", Name: "favicon", Words: []string{"favicon"}},
+			},
+		}).Compile()
+		require.Error(t, err, condition)
+		require.Contains(t, err.Error(), expected, condition)
+	}
+
+	err := (&Operators{
+		MatchersCondition: "admin or admin",
+		Matchers:          []*Matcher{{Type: "word", Name: "admin", Words: []string{"a"}}, {Type: "word", Name: "admin", Words: []string{"b"}}},
+	}).Compile()
+	require.EqualError(t, err, `invalid matchers-condition "admin or admin": matcher name admin is ambiguous`)
+}
+
+func TestExtractorPostProcess(t *testing.T) {
+	extract := func(data map[string]interface{}, extractor *Extractor) map[string]struct{} {
+		return extractor.ExtractRegex(data["body"].(string))
+	}
+	data := func() map[string]interface{} {
+		return map[string]interface{}{"body": "token=%20AbC%20; token=abc; token=x; token=Zz%2B", "min": 2}
+	}
+
+	ops := &Operators{Extractors: []*Extractor{{
+		Type:       "regex",
+		Name:       "token",
+		Regex:      []string{`token=([^;]+)`},
+		RegexGroup: 1,
+		Transforms: []string{"url_decode", "trim_space", "to_lower"},
+		Filter:     `len(value) >= min`,
+		Unique:     true,
+	}}}
+	require.NoError(t, ops.Compile())
+	result, ok := ops.Execute(data(), nil, extract)
+	require.True(t, ok)
+	require.Equal(t, []TemplateEvent{
+		{Type: "extract", Name: "token", Value: "abc"},
+		{Type: "extract", Name: "token", Value: "zz+"},
+	}, result.Events)
+
+	t.Run("limit and internal values", func(t *testing.T) {
+		ops.Extractors[0].Limit = 1
+		ops.Extractors[0].Internal = true
+		values := ops.ExecuteInternalExtractors(data(), extract)
+		require.Equal(t, map[string]interface{}{"token": "abc"}, values)
+
+		result, ok := ops.Execute(data(), nil, extract)
+		require.True(t, ok)
+		require.Equal(t, map[string]interface{}{"token": "abc"}, result.DynamicValues)
+	})
+
+	t.Run("dsl extractor", func(t *testing.T) {
+		ops := &Operators{Extractors: []*Extractor{{
+			Type:       "dsl",
+			Name:       "length",
+			DSL:        []string{`"  4  "`, `"x"`, `" 4"`},
+			Transforms: []string{"trim_space", "to_number(value) * 2"},
+			Unique:     true,
+		}}}
+		require.NoError(t, ops.Compile())
+		result, ok := ops.Execute(map[string]interface{}{}, nil, nil)
+		require.True(t, ok)
+		require.Equal(t, []TemplateEvent{{Type: "extract", Name: "length", Value: "8"}}, result.Events)
+	})
+
+	err := (&Operators{Extractors: []*Extractor{{Type: "regex", Transforms: []string{"nope"}}}}).Compile()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "could not compile transform nope")
+}
@@ -0,0 +1,101 @@
+package operators
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Keys of the latency statistics the http timing analysis adds to the
+// event, in seconds. The timing matcher reads them.
+const (
+	TimingBaseline       = "timing_baseline"
+	TimingBaselineMean   = "timing_baseline_mean"
+	TimingBaselineStddev = "timing_baseline_stddev"
+	TimingDelays         = "timing_delays"
+	TimingSamples        = "timing_samples"
+	TimingSlope          = "timing_slope"
+	TimingIntercept      = "timing_intercept"
+	TimingCorrelation    = "timing_correlation"
+	TimingTolerance      = "timing_tolerance"
+)
+
+// TimingDSLKeys are the keys of the latency statistics.
+var TimingDSLKeys = []string{
+	TimingBaseline, TimingBaselineMean, TimingBaselineStddev, TimingDelays, TimingSamples,
+	TimingSlope, TimingIntercept, TimingCorrelation, TimingTolerance,
+}
+
+// timingCheck is one of the conditions of the timing matcher.
+type timingCheck struct {
+	rule    string
+	value   string
+	matched bool
+}
+
+// MatchTiming confirms a time-based injection from the latency statistics of
+// data: the latency must grow by one second per second of injected delay, in
+// a straight line starting at the baseline, each delayed response taking at
+// least its delay. It never matches an event without statistics.
+func (m *Matcher) MatchTiming(data map[string]interface{}) bool {
+	checks, ok := timingChecks(data)
+	if !ok {
+		return false
+	}
+	for _, check := range checks {
+		if !check.matched {
+			return false
+		}
+	}
+	return true
+}
+
+func timingChecks(data map[string]interface{}) ([]timingCheck, bool) {
+	slope, ok1 := data[TimingSlope].(float64)
+	intercept, ok2 := data[TimingIntercept].(float64)
+	correlation, ok3 := data[TimingCorrelation].(float64)
+	mean, ok4 := data[TimingBaselineMean].(float64)
+	stddev, ok5 := data[TimingBaselineStddev].(float64)
+	tolerance, ok6 := data[TimingTolerance].(float64)
+	delays, ok7 := data[TimingDelays].([]float64)
+	samples, ok8 := data[TimingSamples].([]float64)
+	if !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6 && ok7 && ok8) || len(delays) == 0 || len(delays) != len(samples) {
+		return nil, false
+	}
+
+	minDelay := delays[0]
+	for _, delay := range delays {
+		minDelay = math.Min(minDelay, delay)
+	}
+	interceptError := tolerance*minDelay + 3*stddev
+
+	checks := []timingCheck{
+		{
+			rule:    fmt.Sprintf("slope in [%s, %s]", formatSeconds(1-tolerance), formatSeconds(1+tolerance)),
+			value:   formatSeconds(slope),
+			matched: math.Abs(slope-1) <= tolerance,
+		},
+		{
+			rule:    fmt.Sprintf("correlation >= %s", formatSeconds(1-tolerance)),
+			value:   formatSeconds(correlation),
+			matched: correlation >= 1-tolerance,
+		},
+		{
+			rule:    fmt.Sprintf("intercept within %ss of baseline %ss", formatSeconds(interceptError), formatSeconds(mean)),
+			value:   formatSeconds(intercept),
+			matched: math.Abs(intercept-mean) <= interceptError,
+		},
+	}
+	for i, delay := range delays {
+		checks = append(checks, timingCheck{
+			rule:    fmt.Sprintf("latency >= %ss", formatSeconds(delay)),
+			value:   formatSeconds(samples[i]),
+			matched: samples[i] >= delay,
+		})
+	}
+	return checks, true
+}
+
+func formatSeconds(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
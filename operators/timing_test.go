@@ -0,0 +1,38 @@
+package operators
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTiming(t *testing.T) {
+	matcher := &Matcher{Type: "timing"}
+	require.NoError(t, matcher.CompileMatchers())
+
+	stats := func(samples ...float64) map[string]interface{} {
+		return map[string]interface{}{
+			TimingBaselineMean:   0.2,
+			TimingBaselineStddev: 0.05,
+			TimingDelays:         []float64{2, 4, 6},
+			TimingSamples:        samples,
+			TimingSlope:          (samples[2] - samples[0]) / 4,
+			TimingIntercept:      samples[0] - (samples[2]-samples[0])/2,
+			TimingCorrelation:    0.99,
+			TimingTolerance:      0.3,
+		}
+	}
+
+	require.True(t, matcher.MatchTiming(stats(2.2, 4.2, 6.2)))
+	// latency does not follow the delay
+	require.False(t, matcher.MatchTiming(stats(5.2, 5.4, 5.6)))
+	// a constant offset on every delayed request, e.g. a slow error page
+	require.False(t, matcher.MatchTiming(stats(4.2, 6.2, 8.2)))
+	// returned before the injected delay elapsed
+	require.False(t, matcher.MatchTiming(stats(1.9, 4.0, 6.1)))
+	require.False(t, matcher.MatchTiming(map[string]interface{}{"duration": 6.2}))
+
+	data := stats(2.2, 4.2, 6.2)
+	data[TimingCorrelation] = 0.5
+	require.False(t, matcher.MatchTiming(data))
+}
@@ -0,0 +1,136 @@
+package operators
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/chainreactors/neutron/common/dsl"
+)
+
+// TransformValue is the variable holding the extracted value in the
+// transforms and filter of an extractor.
+const TransformValue = "value"
+
+var transformFunctionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// TransformExpressions returns the transforms of the extractor as DSL
+// expressions: a bare helper name such as trim_space is called with the
+// value, anything else is already an expression over value.
+func (e *Extractor) TransformExpressions() []string {
+	expressions := make([]string, len(e.Transforms))
+	for i, transform := range e.Transforms {
+		if transformFunctionName.MatchString(transform) && transform != TransformValue {
+			transform = transform + "(" + TransformValue + ")"
+		}
+		expressions[i] = transform
+	}
+	return expressions
+}
+
+func (e *Extractor) compilePipeline() error {
+	for i, expression := range e.TransformExpressions() {
+		compiled, err := dsl.CompileExpression(expression)
+		if err != nil {
+			return fmt.Errorf("could not compile transform %s: %v", e.Transforms[i], err)
+		}
+		e.transformsCompiled = append(e.transformsCompiled, compiled)
+	}
+	if e.Filter != "" {
+		compiled, err := dsl.CompileExpression(e.Filter)
+		if err != nil {
+			return fmt.Errorf("could not compile filter %s: %v", e.Filter, err)
+		}
+		e.filterCompiled = compiled
+	}
+	if e.Limit < 0 {
+		return fmt.Errorf("invalid extractor limit %d", e.Limit)
+	}
+	return nil
+}
+
+func (e *Extractor) hasPipeline() bool {
+	return len(e.transformsCompiled) > 0 || e.filterCompiled != nil || e.Unique || e.Limit > 0
+}
+
+// PostProcess applies the transforms, filter, unique and limit options of
+// the extractor to values, in that order. Values a transform fails on are
+// dropped.
+func (e *Extractor) PostProcess(values []interface{}, data map[string]interface{}) []interface{} {
+	if !e.hasPipeline() {
+		return values
+	}
+	var results []interface{}
+	seen := make(map[string]struct{})
+	for _, value := range values {
+		value, ok := e.transform(value, data)
+		if !ok {
+			continue
+		}
+		if e.filterCompiled != nil {
+			keep, err := evaluateWithValue(e.filterCompiled, value, data)
+			if err != nil || keep != true {
+				continue
+			}
+		}
+		if e.Unique {
+			key := fmt.Sprint(value)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+		}
+		results = append(results, value)
+		if e.Limit > 0 && len(results) >= e.Limit {
+			break
+		}
+	}
+	return results
+}
+
+// postProcessSet is PostProcess for the string sets returned by the regex,
+// kval, json, xpath and css extractors. Sets are sorted first so that limit is
+// deterministic.
+func (e *Extractor) postProcessSet(set map[string]struct{}, data map[string]interface{}) []string {
+	values := make([]string, 0, len(set))
+	for value := range set {
+		values = append(values, value)
+	}
+	if !e.hasPipeline() {
+		return values
+	}
+	sort.Strings(values)
+	typed := make([]interface{}, len(values))
+	for i, value := range values {
+		typed[i] = value
+	}
+	values = values[:0]
+	for _, value := range e.PostProcess(typed, data) {
+		values = append(values, fmt.Sprint(value))
+	}
+	return values
+}
+
+func (e *Extractor) transform(value interface{}, data map[string]interface{}) (interface{}, bool) {
+	for _, expression := range e.transformsCompiled {
+		transformed, err := evaluateWithValue(expression, value, data)
+		if err != nil || transformed == nil {
+			return nil, false
+		}
+		value = transformed
+	}
+	return value, true
+}
+
+// evaluateWithValue evaluates expression with value bound to TransformValue,
+// next to the variables of data it references.
+func evaluateWithValue(expression *dsl.Expression, value interface{}, data map[string]interface{}) (interface{}, error) {
+	params := make(map[string]interface{}, len(expression.Vars())+1)
+	for _, name := range expression.Vars() {
+		if v, ok := data[name]; ok {
+			params[name] = v
+		}
+	}
+	params[TransformValue] = value
+	return expression.Evaluate(params)
+}
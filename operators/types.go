@@ -15,6 +15,8 @@ const (
 	JSONExtractor
 	// name:dsl
 	DSLExtractor
+	// name:css
+	CSSExtractor
 
 	limit
 )
@@ -58,10 +60,16 @@ const (
 	DSLMatcher
 	// FaviconMatcher matches responses with favicon hash
 	FaviconMatcher
-	// JSONMatcher matches responses using jq-style expressions
+	// JSONMatcher matches responses using jq-style expressions, with the
+	// stdlib engine unless operators/full is imported
 	JSONMatcher
 	// XPathMatcher matches responses using xpath expressions
 	XPathMatcher
+	// CSSMatcher matches html responses using css selectors
+	CSSMatcher
+	// TimingMatcher confirms time-based injections from the latency
+	// statistics of the http timing analysis
+	TimingMatcher
 )
 
 // matcherTypes is an table for conversion of matcher type from string.
@@ -73,6 +81,7 @@ var matcherTypes = map[string]MatcherType{
 	"binary":  BinaryMatcher,
 	"dsl":     DSLMatcher,
 	"favicon": FaviconMatcher,
+	"timing":  TimingMatcher,
 }
 
 // conditionType is the type of condition for matcher
@@ -83,6 +92,9 @@ const (
 	ANDCondition ConditionType = iota + 1
 	// ORCondition matches responses with AND condition in arguments.
 	ORCondition
+	// ExpressionCondition combines named matchers with a boolean expression,
+	// only valid as matchers-condition.
+	ExpressionCondition
 )
 
 // conditionTypes is an table for conversion of condition type from string.
@@ -90,3 +102,13 @@ var conditionTypes = map[string]ConditionType{
 	"and": ANDCondition,
 	"or":  ORCondition,
 }
+
+// String returns the template name of the condition.
+func (c ConditionType) String() string {
+	for name, condition := range conditionTypes {
+		if condition == c {
+			return name
+		}
+	}
+	return ""
+}
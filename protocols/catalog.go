@@ -0,0 +1,208 @@
+package protocols
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Catalog opens the files templates reference, e.g. the wordlists of their
+// payloads. Names are slash separated and relative to the root of the
+// catalog, see DirCatalog and NewFSCatalog.
+type Catalog interface {
+	Open(name string) (io.ReadCloser, error)
+}
+
+var errCatalogPath = errors.New("path escapes the catalog")
+
+// DirCatalog is the Catalog of the files under a directory.
+type DirCatalog string
+
+func (d DirCatalog) Open(name string) (io.ReadCloser, error) {
+	name, ok := cleanCatalogPath(name)
+	if !ok {
+		return nil, errCatalogPath
+	}
+	return os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// cleanCatalogPath cleans name, false when it is absolute or leaves the root
+// of the catalog.
+func cleanCatalogPath(name string) (string, bool) {
+	if name == "" || path.IsAbs(name) || filepath.IsAbs(name) || strings.Contains(name, "\\") {
+		return "", false
+	}
+	name = path.Clean(name)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// ResolvePath returns the name in Catalog of the file a template references,
+// looked up next to the template, then from the root of the catalog. Paths
+// leaving the catalog are never opened.
+func (o *ExecuterOptions) ResolvePath(name string) (string, bool) {
+	if o == nil || o.Catalog == nil {
+		return "", false
+	}
+	candidates := []string{name}
+	if o.TemplatePath != "" {
+		candidates = []string{path.Join(path.Dir(o.TemplatePath), name), name}
+	}
+	for _, candidate := range candidates {
+		candidate, ok := cleanCatalogPath(candidate)
+		if !ok {
+			continue
+		}
+		file, err := o.Catalog.Open(candidate)
+		if err != nil {
+			continue
+		}
+		file.Close()
+		return candidate, true
+	}
+	return "", false
+}
+
+// ResolvePayloads returns payloads with the values naming a file of the
+// catalog replaced by the lines of the file, streamed when iterated. Other
+// values, e.g. a single payload like ../../etc/passwd, are kept as they are.
+func (o *ExecuterOptions) ResolvePayloads(payloads map[string]interface{}) (map[string]interface{}, error) {
+	if o == nil || o.Catalog == nil {
+		return payloads, nil
+	}
+	resolved := make(map[string]interface{}, len(payloads))
+	for name, payload := range payloads {
+		resolved[name] = payload
+		value, ok := payload.(string)
+		if !ok || strings.Contains(value, "\n") || payloadGeneratorRegex.MatchString(value) {
+			continue
+		}
+		file, ok := o.ResolvePath(strings.TrimSpace(value))
+		if !ok {
+			continue
+		}
+		source, err := newFileSource(o.Catalog, file)
+		if err != nil {
+			return nil, err
+		}
+		resolved[name] = source
+	}
+	return resolved, nil
+}
+
+// fileSource is a wordlist of the catalog, one payload per non-empty line.
+// Only its line count is kept, every iterator reads the file through its own
+// cursor.
+type fileSource struct {
+	catalog Catalog
+	name    string
+	count   int
+}
+
+func newFileSource(catalog Catalog, name string) (*fileSource, error) {
+	source := &fileSource{catalog: catalog, name: name}
+	err := source.scan(func(string) bool {
+		source.count++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// scan calls fn with each payload of the file until fn returns false.
+func (f *fileSource) scan(fn func(line string) bool) error {
+	file, err := f.catalog.Open(f.name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" && !fn(line) {
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (f *fileSource) Len() int { return f.count }
+
+func (f *fileSource) Value(index int) string {
+	var value string
+	_ = f.scan(func(line string) bool {
+		if index == 0 {
+			value = line
+			return false
+		}
+		index--
+		return true
+	})
+	return value
+}
+
+func (f *fileSource) cursor() payloadSource {
+	return &fileCursor{source: f}
+}
+
+// fileCursor reads the lines of a fileSource sequentially, reopening the
+// file only to go back.
+type fileCursor struct {
+	source  *fileSource
+	file    io.ReadCloser
+	reader  *bufio.Reader
+	next    int
+	current string
+}
+
+func (c *fileCursor) Len() int { return c.source.count }
+
+func (c *fileCursor) Value(index int) string {
+	if index == c.next-1 {
+		return c.current
+	}
+	if c.reader == nil || index < c.next {
+		c.close()
+		file, err := c.source.catalog.Open(c.source.name)
+		if err != nil {
+			return ""
+		}
+		c.file, c.reader, c.next = file, bufio.NewReader(file), 0
+	}
+	for c.next <= index {
+		line, err := c.reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			c.current = line
+			c.next++
+		}
+		if err != nil {
+			break
+		}
+	}
+	if c.next >= c.source.count {
+		c.close()
+	}
+	if index != c.next-1 {
+		return ""
+	}
+	return c.current
+}
+
+func (c *fileCursor) close() {
+	if c.file != nil {
+		c.file.Close()
+	}
+	c.file, c.reader = nil, nil
+}
@@ -0,0 +1,27 @@
+//go:build go1.16
+// +build go1.16
+
+package protocols
+
+import (
+	"io"
+	"io/fs"
+)
+
+// NewFSCatalog returns the Catalog of the files of fsys, e.g. an embed.FS, a
+// *zip.Reader or os.DirFS.
+func NewFSCatalog(fsys fs.FS) Catalog {
+	return fsCatalog{fsys: fsys}
+}
+
+type fsCatalog struct {
+	fsys fs.FS
+}
+
+func (c fsCatalog) Open(name string) (io.ReadCloser, error) {
+	name, ok := cleanCatalogPath(name)
+	if !ok {
+		return nil, errCatalogPath
+	}
+	return c.fsys.Open(name)
+}
@@ -0,0 +1,43 @@
+//go:build go1.16
+// +build go1.16
+
+package protocols
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSCatalog(t *testing.T) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	file, err := writer.Create("helpers/users.txt")
+	require.NoError(t, err)
+	file.Write([]byte("root\nadmin\n"))
+	require.NoError(t, writer.Close())
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	for _, catalog := range []Catalog{
+		NewFSCatalog(fstest.MapFS{"helpers/users.txt": {Data: []byte("root\nadmin\n")}}),
+		NewFSCatalog(reader),
+	} {
+		options := &ExecuterOptions{Catalog: catalog, TemplatePath: "http/login.yaml"}
+		name, ok := options.ResolvePath("helpers/users.txt")
+		require.True(t, ok)
+		require.Equal(t, "helpers/users.txt", name)
+
+		payloads, err := options.ResolvePayloads(map[string]interface{}{"users": "helpers/users.txt"})
+		require.NoError(t, err)
+		gen, err := NewGenerator(payloads, Sniper)
+		require.NoError(t, err)
+		require.Equal(t, 2, gen.NewIterator().Total())
+
+		_, err = catalog.Open("/helpers/users.txt")
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,74 @@
+package protocols
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvePayloadFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "cves", "helpers"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "helpers", "wordlists"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cves", "helpers", "users.txt"), []byte("root\r\n\nadmin\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "helpers", "wordlists", "passwords.txt"), []byte("123456\npassword"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(filepath.Dir(dir), "outside.txt"), []byte("secret\n"), 0644))
+	defer os.Remove(filepath.Join(filepath.Dir(dir), "outside.txt"))
+
+	options := &ExecuterOptions{Catalog: DirCatalog(dir), TemplatePath: "cves/template.yaml"}
+	payloads, err := options.ResolvePayloads(map[string]interface{}{
+		"users":     "helpers/users.txt",
+		"passwords": "helpers/wordlists/passwords.txt",
+		"traversal": "../../outside.txt",
+		"literal":   "admin",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "../../outside.txt", payloads["traversal"])
+	require.Equal(t, "admin", payloads["literal"])
+
+	gen, err := NewGenerator(payloads, ClusterBomb)
+	require.NoError(t, err)
+	iterator := gen.NewIterator()
+	require.Equal(t, 4, iterator.Total())
+	var got []string
+	for {
+		value, ok := iterator.Value()
+		if !ok {
+			break
+		}
+		got = append(got, value["users"].(string)+":"+value["passwords"].(string))
+	}
+	require.ElementsMatch(t, []string{"root:123456", "admin:123456", "root:password", "admin:password"}, got)
+
+	_, ok := options.ResolvePath("../outside.txt")
+	require.False(t, ok)
+	_, err = DirCatalog(dir).Open("../outside.txt")
+	require.Equal(t, errCatalogPath, err)
+
+	payloads, err = (&ExecuterOptions{}).ResolvePayloads(map[string]interface{}{"users": "helpers/users.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "helpers/users.txt", payloads["users"])
+}
+
+func TestFileSourceCursor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "words.txt"), []byte("a\nb\n\nc\n"), 0644))
+
+	source, err := newFileSource(DirCatalog(dir), "words.txt")
+	require.NoError(t, err)
+	require.Equal(t, 3, source.Len())
+	require.Equal(t, "c", source.Value(2))
+
+	cursor := source.cursor()
+	for _, index := range []int{0, 1, 1, 2, 0, 2} {
+		require.Equal(t, []string{"a", "b", "c"}[index], cursor.Value(index))
+	}
+	require.Equal(t, "", cursor.Value(3))
+}
@@ -0,0 +1,245 @@
+package protocols
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chainreactors/neutron/common/dsl"
+	"github.com/chainreactors/neutron/operators"
+)
+
+// BuiltinVariables are the variables every request block derives from its
+// target, plus the per-scan random values.
+var BuiltinVariables = []string{
+	"BaseURL", "RootURL", "Hostname", "Host", "Port", "Path", "File", "Scheme",
+	"FQDN", "RDN", "DN", "TLD", "SD",
+	"randstr", "randnum",
+}
+
+// DSLScope is the set of names the DSL expressions of a template may
+// reference. It backs the compile-time checks of CheckDSL.
+type DSLScope struct {
+	names map[string]struct{}
+	// open accepts names only known at runtime, e.g. http response headers
+	open func(name string) bool
+	// warn, when set, receives the undefined variables instead of failing
+	// the check
+	warn func(warning string)
+}
+
+// NewDSLScope creates a scope defining names.
+func NewDSLScope(names ...string) *DSLScope {
+	scope := &DSLScope{names: make(map[string]struct{}, len(names))}
+	return scope.Add(names...)
+}
+
+// Add defines names in the scope.
+func (s *DSLScope) Add(names ...string) *DSLScope {
+	for _, name := range names {
+		s.names[name] = struct{}{}
+	}
+	return s
+}
+
+// With returns a copy of the scope that also defines names and, when open is
+// not nil, every name accepted by open.
+func (s *DSLScope) With(open func(name string) bool, names ...string) *DSLScope {
+	scope := NewDSLScope(names...)
+	for name := range s.names {
+		scope.names[name] = struct{}{}
+	}
+	scope.open, scope.warn = s.open, s.warn
+	if open != nil {
+		parent := s.open
+		scope.open = func(name string) bool {
+			return open(name) || parent != nil && parent(name)
+		}
+	}
+	return scope
+}
+
+// WithWarnings returns a copy of the scope where undefined variables are
+// reported to warn, e.g. `http[0].path[0]: undefined variable token`, and do
+// not fail the checks. Unknown functions and wrong argument counts still do.
+func (s *DSLScope) WithWarnings(warn func(warning string)) *DSLScope {
+	scope := s.With(nil)
+	scope.warn = warn
+	return scope
+}
+
+// WithHistory returns a copy of the scope that also defines the request
+// history fields of responses, e.g. body_1. History is shared by every block
+// of a template, so a later request can use the fields of any earlier one.
+func (s *DSLScope) WithHistory(responses ...*DSLScope) *DSLScope {
+	return s.With(func(name string) bool {
+		i := strings.LastIndex(name, "_")
+		if i <= 0 || !isDigits(name[i+1:]) {
+			return false
+		}
+		for _, response := range responses {
+			if response.Defines(name[:i]) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithProtocols returns a copy of the scope that also defines the fields the
+// executer publishes for the request blocks of each protocol, e.g.
+// ssl_subject_cn or network_1_data. responses are the response scopes of the
+// blocks, by protocol name.
+func (s *DSLScope) WithProtocols(responses map[string][]*DSLScope) *DSLScope {
+	return s.With(func(name string) bool {
+		for protocol, scopes := range responses {
+			if !strings.HasPrefix(name, protocol+"_") {
+				continue
+			}
+			field := name[len(protocol)+1:]
+			if i := strings.Index(field, "_"); i > 0 && isDigits(field[:i]) {
+				n, _ := strconv.Atoi(field[:i])
+				if n < 1 || n > len(scopes) {
+					continue
+				}
+				field = field[i+1:]
+			}
+			for _, response := range scopes {
+				if response.Defines(field) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// Defines reports whether name is defined in the scope. Request history
+// fields such as `body_1` are defined when their base name is.
+func (s *DSLScope) Defines(name string) bool {
+	if _, ok := s.names[name]; ok {
+		return true
+	}
+	if s.open != nil && s.open(name) {
+		return true
+	}
+	if i := strings.LastIndex(name, "_"); i > 0 && isDigits(name[i+1:]) {
+		return s.Defines(name[:i])
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckDSL statically checks a DSL expression against scope (see dsl.Check).
+// field is the template path of the expression, e.g. http[0].matchers[1].dsl[0].
+func CheckDSL(field, expression string, scope *DSLScope) error {
+	defined := scope.Defines
+	if scope.warn != nil {
+		defined = func(name string) bool {
+			if !scope.Defines(name) {
+				scope.warn(fmt.Sprintf("%s: undefined variable %s", field, name))
+			}
+			return true
+		}
+	}
+	if err := dsl.Check(expression, defined); err != nil {
+		return fmt.Errorf("%s: %v", field, err)
+	}
+	return nil
+}
+
+// CheckPlaceholders checks the {{...}} expressions of value. Placeholders that
+// do not parse, only hold literals like {{7*7}} or are dashed names like
+// {{interactsh-url}}, filled at runtime, are not checked.
+func CheckPlaceholders(field, value string, scope *DSLScope) error {
+	for _, expression := range templateExpressions(value) {
+		if reDashedName.MatchString(strings.TrimSpace(expression)) {
+			continue
+		}
+		root, err := dsl.Parse(expression)
+		if err != nil || !hasReferences(root) {
+			continue
+		}
+		if err := CheckDSL(field, expression, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reDashedName matches placeholders naming a value, e.g. interactsh-url,
+// which the DSL would otherwise parse as a subtraction.
+var reDashedName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(-[A-Za-z0-9_]+)+$`)
+
+func hasReferences(node *dsl.Node) bool {
+	if node.Type == dsl.NodeVariable || node.Type == dsl.NodeCall {
+		return true
+	}
+	for _, child := range node.Children {
+		if hasReferences(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOperators checks the dsl matchers and extractors of ops, including the
+// transforms and filter of the extractors.
+func CheckOperators(field string, ops *operators.Operators, scope *DSLScope) error {
+	if ops == nil {
+		return nil
+	}
+	for i, matcher := range ops.Matchers {
+		for j, expression := range matcher.DSL {
+			if err := CheckDSL(fmt.Sprintf("%s.matchers[%d].dsl[%d]", field, i, j), expression, scope); err != nil {
+				return err
+			}
+		}
+	}
+	valueScope := scope.With(nil, operators.TransformValue)
+	for i, extractor := range ops.Extractors {
+		for j, expression := range extractor.DSL {
+			if err := CheckDSL(fmt.Sprintf("%s.extractors[%d].dsl[%d]", field, i, j), expression, scope); err != nil {
+				return err
+			}
+		}
+		for j, expression := range extractor.TransformExpressions() {
+			if err := CheckDSL(fmt.Sprintf("%s.extractors[%d].transforms[%d]", field, i, j), expression, valueScope); err != nil {
+				return err
+			}
+		}
+		if extractor.Filter != "" {
+			if err := CheckDSL(fmt.Sprintf("%s.extractors[%d].filter", field, i), extractor.Filter, valueScope); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ExtractorNames returns the names of the named extractors of ops, which
+// later matchers and requests can reference.
+func ExtractorNames(ops *operators.Operators) []string {
+	if ops == nil {
+		return nil
+	}
+	var names []string
+	for _, extractor := range ops.Extractors {
+		if extractor.Name != "" {
+			names = append(names, extractor.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,75 @@
+package protocols
+
+import (
+	"testing"
+
+	"github.com/chainreactors/neutron/operators"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDSLScope(t *testing.T) {
+	scope := NewDSLScope("BaseURL", "token")
+	require.True(t, scope.Defines("token"))
+	require.False(t, scope.Defines("body"))
+
+	response := scope.With(func(name string) bool { return name == "x_powered_by" }, "body")
+	require.True(t, response.Defines("body"))
+	require.True(t, response.Defines("body_2"))
+	require.True(t, response.Defines("x_powered_by"))
+	require.True(t, response.Defines("token"))
+	require.False(t, scope.Defines("body"), "With must not change the parent scope")
+
+	history := scope.WithHistory(response)
+	require.True(t, history.Defines("body_1"))
+	require.False(t, history.Defines("body"))
+	require.False(t, history.Defines("data_1"))
+
+	protocols := scope.WithProtocols(map[string][]*DSLScope{"http": {response, response}})
+	require.True(t, protocols.Defines("http_body"))
+	require.True(t, protocols.Defines("http_2_body"))
+	require.True(t, protocols.Defines("http_x_powered_by"))
+	require.False(t, protocols.Defines("http_3_body"))
+	require.False(t, protocols.Defines("network_body"))
+}
+
+func TestCheckPlaceholders(t *testing.T) {
+	scope := NewDSLScope(BuiltinVariables...)
+	require.Nil(t, CheckPlaceholders("path[0]", "{{BaseURL}}/{{md5(randstr)}}?q={{7*7}}", scope))
+	require.Nil(t, CheckPlaceholders("path[0]", "{{.Values}} {{", scope))
+	require.EqualError(t, CheckPlaceholders("path[0]", "{{BaseURL}}/{{Basepath}}", scope),
+		"path[0]: undefined variable Basepath")
+	require.EqualError(t, CheckPlaceholders("body", `{"id": "{{rand_base(8, "abc", 1)}}"}`, scope),
+		"body: function rand_base expects 1 to 2 arguments, got 3")
+	require.Nil(t, CheckPlaceholders("path[0]", "{{BaseURL}}/?x={{interactsh-url}}&y={{ interactsh-url }}", scope))
+
+	var warnings []string
+	warn := scope.WithWarnings(func(warning string) { warnings = append(warnings, warning) }).With(nil, "token")
+	require.Nil(t, CheckPlaceholders("path[0]", "{{BaseURL}}/{{Basepath}}/{{token}}", warn))
+	require.Equal(t, []string{"path[0]: undefined variable Basepath"}, warnings)
+	require.EqualError(t, CheckPlaceholders("path[0]", "{{contians(Basepath)}}", warn),
+		"path[0]: undefined function contians")
+}
+
+func TestCheckOperators(t *testing.T) {
+	ops := &operators.Operators{
+		Matchers: []*operators.Matcher{
+			{Type: "word", Words: []string{"admin"}},
+			{Type: "dsl", DSL: []string{`status_code == 200`, `contians(body, "admin")`}},
+		},
+		Extractors: []*operators.Extractor{{Type: "dsl", Name: "version", DSL: []string{`body`}}},
+	}
+	scope := NewDSLScope("body", "status_code")
+	require.EqualError(t, CheckOperators("http[0]", ops, scope), "http[0].matchers[1].dsl[1]: undefined function contians")
+
+	ops.Matchers[1].DSL[1] = `contains(body, "admin")`
+	require.Nil(t, CheckOperators("http[0]", ops, scope))
+	require.Equal(t, []string{"version"}, ExtractorNames(ops))
+
+	ops.Extractors[0].Transforms = []string{"trim_space", `replace(value, "v", "")`, "url_decod"}
+	require.EqualError(t, CheckOperators("http[0]", ops, scope), "http[0].extractors[0].transforms[2]: undefined function url_decod")
+	ops.Extractors[0].Transforms[2] = "url_decode"
+	ops.Extractors[0].Filter = `len(value) > min_length`
+	require.EqualError(t, CheckOperators("http[0]", ops, scope), "http[0].extractors[0].filter: undefined variable min_length")
+	ops.Extractors[0].Filter = `len(value) > 0 && value != body`
+	require.Nil(t, CheckOperators("http[0]", ops, scope))
+}
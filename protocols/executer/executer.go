@@ -1,6 +1,8 @@
 package executer
 
 import (
+	"strings"
+
 	"github.com/chainreactors/utils/iutils"
 	"github.com/chainreactors/neutron/common/dsl"
 	"github.com/chainreactors/neutron/operators"
@@ -60,8 +62,11 @@ func (e *Executer) Execute(input *protocols.ScanContext) (*operators.Result, err
 	previous := make(map[string]interface{})
 	dynamicValues := iutils.MergeMaps(make(map[string]interface{}), input.Payloads)
 	requestIndexOffset := 0
+	blocks := make(map[protocols.ProtocolType]int)
 	for _, req := range e.requests {
 		dynamicValues["__request_index_offset"] = requestIndexOffset
+		blocks[req.Type()]++
+		dynamicValues["__protocol_index"] = blocks[req.Type()]
 		err := req.ExecuteWithResults(input, dynamicValues, previous, func(event *protocols.InternalWrappedEvent) {
 			if event.OperatorsResult != nil {
 				for key, value := range event.OperatorsResult.DynamicValues {
@@ -74,12 +79,21 @@ func (e *Executer) Execute(input *protocols.ScanContext) (*operators.Result, err
 					}
 				}
 			}
+			protocols.ExplainResults(req, event)
 			input.LogEvent(event)
 		})
 		if err != nil {
 			return nil, err
 		}
-		requestIndexOffset += req.Requests()
+		// the protocol qualified fields of the block, see AddProtocolEvent,
+		// are also usable in the placeholders of the following blocks
+		prefix := req.Type().String() + "_"
+		for key, value := range previous {
+			if strings.HasPrefix(key, prefix) {
+				dynamicValues[key] = value
+			}
+		}
+		requestIndexOffset += protocols.ScanRequests(req, input)
 	}
 	return result, nil
 }
@@ -89,11 +103,21 @@ func computeGlobalVars(options *protocols.ExecuterOptions) map[string]interface{
 		"randstr": dsl.RandStr(8),
 		"randnum": dsl.RandNum(4),
 	}
-	if options == nil || options.Variables.Len() == 0 {
+	if options == nil {
 		return globalVars
 	}
-	for k, v := range options.Variables.StableValues() {
+	for k, v := range options.Constants {
 		globalVars[k] = v
 	}
+	if options.Variables.Len() > 0 {
+		for k, v := range options.Variables.StableValues() {
+			globalVars[k] = v
+		}
+	}
+	if options.Options != nil {
+		for k, v := range options.Options.Vars {
+			globalVars[k] = v
+		}
+	}
 	return globalVars
 }
@@ -0,0 +1,44 @@
+package protocols
+
+import "github.com/chainreactors/neutron/operators"
+
+// ExplainKey is the ResultEvent metadata key holding the
+// *operators.Explanation of the event when the scan runs in explain mode.
+const ExplainKey = "explain"
+
+// ExecuteOperators executes ops on data with the match and extract funcs of
+// request. When the scan context is in explain mode the explanation of the
+// matchers is recorded on event; resolve is the part resolver of request.
+func ExecuteOperators(input *ScanContext, request Request, ops *operators.Operators, data map[string]interface{}, event *InternalWrappedEvent, resolve PartResolver) (*operators.Result, bool) {
+	if input == nil || !input.Explain {
+		return ops.Execute(data, request.Match, request.Extract)
+	}
+	result, ok, explanation := ops.ExecuteWithExplanation(data, request.Match, request.Extract, resolve)
+	event.Explanation = explanation
+	return result, ok
+}
+
+// ExplainResults adds the explanation of event to the metadata of its
+// results. An event without results gets one carrying the explanation, so
+// misses are reported too.
+func ExplainResults(request Request, event *InternalWrappedEvent) {
+	if event.Explanation == nil {
+		return
+	}
+	if len(event.Results) == 0 {
+		wrapped := &InternalWrappedEvent{InternalEvent: event.InternalEvent, OperatorsResult: event.OperatorsResult}
+		if wrapped.OperatorsResult == nil {
+			wrapped.OperatorsResult = &operators.Result{}
+		}
+		event.Results = []*ResultEvent{request.MakeResultEventItem(wrapped)}
+	}
+	for _, result := range event.Results {
+		// the metadata may be the payload values of the operators result
+		metadata := make(map[string]interface{}, len(result.Metadata)+1)
+		for k, v := range result.Metadata {
+			metadata[k] = v
+		}
+		metadata[ExplainKey] = event.Explanation
+		result.Metadata = metadata
+	}
+}
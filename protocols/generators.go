@@ -11,23 +11,32 @@ import (
 // Inspired from https://github.com/ffuf/ffuf/blob/master/pkg/input/input.go
 
 // loadPayloads loads the input payloads from a map to a data map
-func loadPayloads(payloads map[string]interface{}) (map[string][]string, error) {
-	loadedPayloads := make(map[string][]string)
+func loadPayloads(payloads map[string]interface{}) (map[string]payloadSource, error) {
+	loadedPayloads := make(map[string]payloadSource)
 
 	for name, payload := range payloads {
 		switch pt := payload.(type) {
+		case payloadSource:
+			loadedPayloads[name] = pt
 		case string:
+			if source, ok, err := parsePayloadGenerator(pt); ok {
+				if err != nil {
+					return nil, errors.New("invalid payload generator for key '" + name + "': " + err.Error())
+				}
+				loadedPayloads[name] = source
+				continue
+			}
 			elements := strings.Split(pt, "\n")
 			//golint:gomnd // this is not a magic number
-			loadedPayloads[name] = elements
+			loadedPayloads[name] = listSource(elements)
 		case []string:
-			loadedPayloads[name] = pt
+			loadedPayloads[name] = listSource(pt)
 		case []interface{}:
 			s := make([]string, len(pt))
 			for i, v := range pt {
 				s[i] = iutils.ToString(v)
 			}
-			loadedPayloads[name] = s
+			loadedPayloads[name] = listSource(s)
 		default:
 			// Skip unsupported payload types (e.g., nested maps)
 			// Return error to make it explicit
@@ -40,7 +49,7 @@ func loadPayloads(payloads map[string]interface{}) (map[string][]string, error)
 // generator is the generator struct for generating payloads
 type Generator struct {
 	Type     Type
-	payloads map[string][]string
+	payloads map[string]payloadSource
 }
 
 // Type is type of attack
@@ -53,16 +62,22 @@ const (
 	PitchFork
 	// ClusterBomb replaces variables with all possible combinations of values
 	ClusterBomb
+	// BatteringRam replaces all variables with the same value at a time.
+	BatteringRam
 )
 
 // StringToType is an table for conversion of attack type from string.
 var StringToType = map[string]Type{
-	"sniper":      Sniper,
-	"pitchfork":   PitchFork,
-	"clusterbomb": ClusterBomb,
+	"sniper":       Sniper,
+	"pitchfork":    PitchFork,
+	"clusterbomb":  ClusterBomb,
+	"batteringram": BatteringRam,
 }
 
-// NewGenerator creates a new generator structure for payload generation
+// NewGenerator creates a new generator structure for payload generation.
+// A payload is a list of values, or a generator computed lazily while
+// iterating: range(start, end[, step[, width]]), brute(charset, min, max),
+// daterange(start, end[, layout[, days]]) or dsl(expression).
 func NewGenerator(payloads map[string]interface{}, payloadType Type) (*Generator, error) {
 	generator := &Generator{}
 	//if err := generator.validate(payloads, templatePath); err != nil {
@@ -80,10 +95,10 @@ func NewGenerator(payloads map[string]interface{}, payloadType Type) (*Generator
 	if payloadType == PitchFork {
 		var totalLength int
 		for _, values := range compiled {
-			if totalLength != 0 && totalLength != len(values) {
+			if totalLength != 0 && totalLength != values.Len() {
 				return nil, errors.New("pitchfork payloads must be of equal number")
 			}
-			totalLength = len(values)
+			totalLength = values.Len()
 		}
 	}
 	return generator, nil
@@ -108,7 +123,11 @@ func (g *Generator) NewIterator() *Iterator {
 
 	payloads := make([]*payloadIterator, 0, len(names))
 	for _, name := range names {
-		payloads = append(payloads, &payloadIterator{name: name, values: g.payloads[name]})
+		source := g.payloads[name]
+		if file, ok := source.(*fileSource); ok {
+			source = file.cursor()
+		}
+		payloads = append(payloads, &payloadIterator{name: name, source: source})
 	}
 	iterator := &Iterator{
 		Type:     g.Type,
@@ -137,20 +156,21 @@ func (i *Iterator) Remaining() int {
 func (i *Iterator) Total() int {
 	count := 0
 	switch i.Type {
-	case Sniper:
-		for _, p := range i.payloads {
-			count += len(p.values)
-		}
 	case PitchFork:
 		if len(i.payloads) == 0 {
 			count = 0
 		} else {
-			count = len(i.payloads[0].values)
+			count = i.payloads[0].source.Len()
 		}
 	case ClusterBomb:
 		count = 1
 		for _, p := range i.payloads {
-			count *= len(p.values)
+			count *= p.source.Len()
+		}
+	default:
+		// sniper and batteringram, Value iterates unset types like sniper
+		for _, p := range i.payloads {
+			count += p.source.Len()
 		}
 	}
 	return count
@@ -165,6 +185,8 @@ func (i *Iterator) Value() (map[string]interface{}, bool) {
 		return i.pitchforkValue()
 	case ClusterBomb:
 		return i.clusterbombValue()
+	case BatteringRam:
+		return i.batteringRamValue()
 	default:
 		return i.sniperValue()
 	}
@@ -189,6 +211,28 @@ func (i *Iterator) sniperValue() (map[string]interface{}, bool) {
 	return values, true
 }
 
+// batteringRamValue returns the same payload for all the keywords, taking
+// the values of each payload list in turn like sniper
+func (i *Iterator) batteringRamValue() (map[string]interface{}, bool) {
+	if i.msbIterator >= len(i.payloads) {
+		return nil, false
+	}
+	values := make(map[string]interface{}, len(i.payloads))
+
+	payload := i.payloads[i.msbIterator]
+	if !payload.next() {
+		i.msbIterator++
+		return i.batteringRamValue()
+	}
+	value := payload.value()
+	for _, p := range i.payloads {
+		values[p.name] = value
+	}
+	payload.incrementPosition()
+	i.position++
+	return values, true
+}
+
 // pitchforkValue returns a map of keyword:value pairs in same index
 func (i *Iterator) pitchforkValue() (map[string]interface{}, bool) {
 	values := make(map[string]interface{}, len(i.payloads))
@@ -256,12 +300,12 @@ func (i *Iterator) clusterbombIteratorReset() {
 type payloadIterator struct {
 	index  int
 	name   string
-	values []string
+	source payloadSource
 }
 
 // next returns true if there are more values in payload iterator
 func (i *payloadIterator) next() bool {
-	return i.index < len(i.values)
+	return i.index < i.source.Len()
 }
 
 // resetPosition resets the position of the payload iterator
@@ -276,7 +320,7 @@ func (i *payloadIterator) incrementPosition() {
 
 // value returns the value of the payload at an index
 func (i *payloadIterator) value() string {
-	return i.values[i.index]
+	return i.source.Value(i.index)
 }
 
 // BuildPayloadFromOptions returns a map with the payloads provided via CLI
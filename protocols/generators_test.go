@@ -1,6 +1,7 @@
 package protocols
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -97,3 +98,94 @@ func TestClusterBombValues(t *testing.T) {
 		t.Fatalf("expected total 4, got %d", iter.Total())
 	}
 }
+
+func TestBatteringRam(t *testing.T) {
+	gen, err := NewGenerator(map[string]interface{}{
+		"a": []string{"1", "2"},
+		"b": []string{"x"},
+	}, StringToType["batteringram"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	iter := gen.NewIterator()
+	if iter.Total() != 3 {
+		t.Fatalf("expected total 3, got %d", iter.Total())
+	}
+	for _, expected := range []string{"1", "2", "x"} {
+		v, ok := iter.Value()
+		if !ok {
+			t.Fatalf("expected value %s", expected)
+		}
+		if v["a"] != expected || v["b"] != expected {
+			t.Fatalf("expected a=b=%s, got a=%v,b=%v", expected, v["a"], v["b"])
+		}
+	}
+	if _, ok := iter.Value(); ok {
+		t.Fatal("expected no more values")
+	}
+}
+
+func generatedValues(t *testing.T, payload string) []string {
+	gen, err := NewGenerator(map[string]interface{}{"p": payload}, Sniper)
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", payload, err)
+	}
+	var values []string
+	iter := gen.NewIterator()
+	for {
+		v, ok := iter.Value()
+		if !ok {
+			break
+		}
+		values = append(values, v["p"].(string))
+	}
+	return values
+}
+
+func TestPayloadGenerators(t *testing.T) {
+	for payload, expected := range map[string][]string{
+		"range(1,3)":                                 {"1", "2", "3"},
+		"range(3, 1)":                                {"3", "2", "1"},
+		"range(0, 10, 5, 3)":                         {"000", "005", "010"},
+		"brute(ab, 1, 2)":                            {"a", "b", "aa", "ab", "ba", "bb"},
+		"brute(',x', 1, 1)":                          {",", "x"},
+		"daterange(2024-02-28, 2024-03-01)":          {"2024-02-28", "2024-02-29", "2024-03-01"},
+		"daterange(2024-01-01, 2024-01-20, 0102, 7)": {"0101", "0108", "0115"},
+		`dsl(split("a,b", ","))`:                     {"a", "b"},
+		"range":                                      {"range"},
+	} {
+		values := generatedValues(t, payload)
+		if strings.Join(values, "|") != strings.Join(expected, "|") {
+			t.Fatalf("%s: expected %v, got %v", payload, expected, values)
+		}
+	}
+}
+
+func TestPayloadGeneratorsLazy(t *testing.T) {
+	gen, err := NewGenerator(map[string]interface{}{"p": "brute(digits, 1, 8)"}, Sniper)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	iter := gen.NewIterator()
+	if iter.Total() != 111111110 {
+		t.Fatalf("expected total 111111110, got %d", iter.Total())
+	}
+	source := gen.payloads["p"]
+	if v := source.Value(source.Len() - 1); v != "99999999" {
+		t.Fatalf("expected last value 99999999, got %s", v)
+	}
+
+	for _, payload := range []string{
+		"range(1)",
+		"range(1, 10, -1)",
+		"range(a, 10)",
+		"brute(digits, 0, 2)",
+		"brute(alnum, 1, 8)",
+		"daterange(2024-01-02, 2024-01-01)",
+		"dsl(unknown_function())",
+	} {
+		if _, err := NewGenerator(map[string]interface{}{"p": payload}, Sniper); err == nil {
+			t.Fatalf("%s: expected error", payload)
+		}
+	}
+}
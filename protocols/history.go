@@ -0,0 +1,112 @@
+package protocols
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/chainreactors/neutron/operators"
+)
+
+var (
+	// Determines if request condition are needed by detecting the pattern _xxx
+	reRequestCondition = regexp.MustCompile(`(?m)_\d+`)
+)
+
+// NeedsRequestCondition reports whether the operators reference indexed
+// history fields such as `body_1` or `data_2`, either in DSL or as a part.
+func NeedsRequestCondition(ops *operators.Operators) bool {
+	if ops == nil {
+		return false
+	}
+	for _, matcher := range ops.Matchers {
+		if checkRequestConditionExpressions(matcher.DSL...) {
+			return true
+		}
+		if checkRequestConditionExpressions(matcher.Part) {
+			return true
+		}
+	}
+	for _, extractor := range ops.Extractors {
+		if checkRequestConditionExpressions(extractor.DSL...) {
+			return true
+		}
+		if checkRequestConditionExpressions(extractor.Part) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRequestConditionExpressions(expressions ...string) bool {
+	for _, expression := range expressions {
+		if reRequestCondition.MatchString(expression) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestIndex returns the template-wide, 1-based index of the count-th
+// request of a block. The executer publishes the number of requests of the
+// preceding blocks as `__request_index_offset`, so indices stay unique across
+// blocks of different protocols.
+func RequestIndex(dynamicValues map[string]interface{}, count int) int {
+	return count + intValue(dynamicValues["__request_index_offset"])
+}
+
+// ScanRequester is implemented by the requests whose number of requests
+// depends on the scan, e.g. on the payloads of the ScanContext, which
+// Requests cannot account for.
+type ScanRequester interface {
+	ScanRequests(input *ScanContext) int
+}
+
+// ScanRequests returns the number of requests req performs for input, the
+// count the executer adds to `__request_index_offset` after the block.
+func ScanRequests(req Request, input *ScanContext) int {
+	if requester, ok := req.(ScanRequester); ok {
+		return requester.ScanRequests(input)
+	}
+	return req.Requests()
+}
+
+func intValue(v interface{}) int {
+	switch v := v.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// AddRequestHistory stores every field of outputEvent as `<key>_<index>` in
+// previous, which the executer shares between blocks, and in finalEvent, the
+// map the operators of the current request run against.
+func AddRequestHistory(previous, finalEvent, outputEvent map[string]interface{}, index int) {
+	for k, v := range outputEvent {
+		key := fmt.Sprintf("%s_%d", k, index)
+		previous[key] = v
+		finalEvent[key] = v
+	}
+}
+
+// AddProtocolEvent stores every field of outputEvent as `<protocol>_<key>`
+// and `<protocol>_<n>_<key>` in previous, where n is the 1-based index of the
+// block among the blocks of its protocol, published by the executer as
+// `__protocol_index`. Later blocks can then reference e.g. ssl_subject_cn or
+// network_1_data. The dynamic values the event was built with are skipped.
+func AddProtocolEvent(previous, outputEvent map[string]interface{}, protocol ProtocolType, dynamicValues map[string]interface{}) {
+	index := intValue(dynamicValues["__protocol_index"])
+	for k, v := range outputEvent {
+		if _, ok := dynamicValues[k]; ok {
+			continue
+		}
+		previous[fmt.Sprintf("%s_%s", protocol, k)] = v
+		if index > 0 {
+			previous[fmt.Sprintf("%s_%d_%s", protocol, index, k)] = v
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package protocols
+
+import (
+	"testing"
+
+	"github.com/chainreactors/neutron/operators"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeedsRequestCondition(t *testing.T) {
+	require.False(t, NeedsRequestCondition(nil))
+	require.False(t, NeedsRequestCondition(&operators.Operators{
+		Matchers: []*operators.Matcher{{Type: "dsl", DSL: []string{`contains(data, "x")`}}},
+	}))
+	require.True(t, NeedsRequestCondition(&operators.Operators{
+		Matchers: []*operators.Matcher{{Type: "dsl", DSL: []string{`data_1 != data_2`}}},
+	}))
+	require.True(t, NeedsRequestCondition(&operators.Operators{
+		Extractors: []*operators.Extractor{{Type: "regex", Part: "subject_cn_1"}},
+	}))
+}
+
+func TestRequestHistory(t *testing.T) {
+	require.Equal(t, 1, RequestIndex(map[string]interface{}{}, 1))
+	require.Equal(t, 4, RequestIndex(map[string]interface{}{"__request_index_offset": 3}, 1))
+	require.Equal(t, 5, RequestIndex(map[string]interface{}{"__request_index_offset": float64(3)}, 2))
+
+	previous := map[string]interface{}{"data_1": "first"}
+	final := map[string]interface{}{"data": "second"}
+	AddRequestHistory(previous, final, map[string]interface{}{"data": "second"}, 2)
+	require.Equal(t, map[string]interface{}{"data_1": "first", "data_2": "second"}, previous)
+	require.Equal(t, "second", final["data_2"])
+}
+
+func TestProtocolEvent(t *testing.T) {
+	previous := map[string]interface{}{}
+	dynamicValues := map[string]interface{}{"__protocol_index": 2, "token": "abc"}
+	AddProtocolEvent(previous, map[string]interface{}{"subject_cn": "example.com", "token": "abc"}, SSLProtocol, dynamicValues)
+	require.Equal(t, map[string]interface{}{"ssl_subject_cn": "example.com", "ssl_2_subject_cn": "example.com"}, previous)
+}
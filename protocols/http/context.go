@@ -1,6 +1,9 @@
 package http
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
@@ -13,6 +16,7 @@ const (
 	KeyCookieJar = "http.cookiejar"
 	KeyClient    = "http.client"
 	KeyProxy     = "http.proxy"
+	KeyInput     = "http.input"
 )
 
 func SetTransport(ctx *protocols.ScanContext, t http.RoundTripper) {
@@ -67,6 +71,34 @@ func GetProxy(ctx *protocols.ScanContext) func(*http.Request) (*url.URL, error)
 	return p
 }
 
+// SetInputRequest sets the request the fuzzing rules mutate when a template
+// has no path or raw, e.g. a request found by a crawler. The body is kept so
+// that every template reads it.
+func SetInputRequest(ctx *protocols.ScanContext, req *http.Request) error {
+	if req.Body != nil && req.GetBody == nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		req.Body.Close()
+		req.Body = NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	ctx.Set(KeyInput, req)
+	return nil
+}
+
+func GetInputRequest(ctx *protocols.ScanContext) *http.Request {
+	v, ok := ctx.Get(KeyInput)
+	if !ok {
+		return nil
+	}
+	r, _ := v.(*http.Request)
+	return r
+}
+
 func NewHTTPScanContext(input string, payloads map[string]interface{}) *protocols.ScanContext {
 	ctx := protocols.NewScanContext(input, payloads)
 	jar, _ := cookiejar.New(nil)
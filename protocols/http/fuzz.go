@@ -0,0 +1,533 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chainreactors/neutron/common"
+	"github.com/chainreactors/neutron/protocols"
+	"github.com/chainreactors/utils/iutils"
+)
+
+// Rule is a nuclei v3 fuzzing rule. It injects the fuzz values into the
+// parameters of a part of the request, e.g. every query parameter:
+//
+//	fuzzing:
+//	  - part: query
+//	    type: postfix
+//	    mode: single
+//	    keys-regex: ["^(id|q)$"]
+//	    fuzz:
+//	      - "'"
+//	      - "{{injection}}"
+//
+// The fuzzed request is the one built from path or raw, or without them the
+// input request of the scan context (see SetInputRequest), or a GET of the
+// input URL.
+type Rule struct {
+	// Part is the part of the request to fuzz: query, path, header, cookie,
+	// body or request for all of them.
+	Part string `json:"part,omitempty" yaml:"part,omitempty"`
+	// Parts fuzzes several parts with the same rule.
+	Parts []string `json:"parts,omitempty" yaml:"parts,omitempty"`
+	// Type is how the fuzz value is injected into the parameter value:
+	// replace, prefix, postfix, infix or replace-regex. Default is replace.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Mode is single to fuzz one parameter per request, or multiple to fuzz
+	// all of them at once. Default is single.
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// Keys are the names of the parameters to fuzz, all of them when Keys and
+	// KeysRegex are empty. Nested body parameters match by full path
+	// (user.name) or by name (name).
+	Keys []string `json:"keys,omitempty" yaml:"keys,omitempty"`
+	// KeysRegex are regexes on the names of the parameters to fuzz.
+	KeysRegex []string `json:"keys-regex,omitempty" yaml:"keys-regex,omitempty"`
+	// Values are regexes the value of a parameter must match to be fuzzed.
+	Values []string `json:"values,omitempty" yaml:"values,omitempty"`
+	// ReplaceRegex is the regex the replace-regex type replaces.
+	ReplaceRegex string `json:"replace-regex,omitempty" yaml:"replace-regex,omitempty"`
+	// Fuzz are the values injected, they may reference the payloads.
+	Fuzz []string `json:"fuzz,omitempty" yaml:"fuzz,omitempty"`
+
+	parts        []string
+	keysRegex    []*regexp.Regexp
+	valuesRegex  []*regexp.Regexp
+	replaceRegex *regexp.Regexp
+}
+
+// Keys of the fuzzing details added to the events of fuzzed requests.
+const (
+	FuzzingPosition  = "fuzzing_position"
+	FuzzingParameter = "fuzzing_parameter"
+	FuzzingPayload   = "fuzzing_payload"
+)
+
+var fuzzingDSLKeys = []string{FuzzingPosition, FuzzingParameter, FuzzingPayload}
+
+var fuzzingParts = []string{"query", "path", "header", "cookie", "body"}
+
+var fuzzingTypes = map[string]bool{"replace": true, "prefix": true, "postfix": true, "infix": true, "replace-regex": true}
+
+// fuzzingSequence is the request fuzzed when a request has no path or raw.
+var fuzzingSequence = []string{"{{BaseURL}}"}
+
+func (rule *Rule) compile() error {
+	parts := rule.Parts
+	if rule.Part != "" {
+		parts = append([]string{rule.Part}, parts...)
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("fuzzing rule has no part")
+	}
+	rule.parts = nil
+	for _, part := range parts {
+		part = strings.ToLower(part)
+		if part == "request" {
+			rule.parts = append(rule.parts, fuzzingParts...)
+			continue
+		}
+		if !iutils.StringsContains(fuzzingParts, part) {
+			return fmt.Errorf("invalid fuzzing part %s", part)
+		}
+		rule.parts = append(rule.parts, part)
+	}
+
+	if rule.Type == "" {
+		rule.Type = "replace"
+	}
+	if !fuzzingTypes[rule.Type] {
+		return fmt.Errorf("invalid fuzzing type %s", rule.Type)
+	}
+	if rule.Mode == "" {
+		rule.Mode = "single"
+	}
+	if rule.Mode != "single" && rule.Mode != "multiple" {
+		return fmt.Errorf("invalid fuzzing mode %s", rule.Mode)
+	}
+	if len(rule.Fuzz) == 0 {
+		return fmt.Errorf("fuzzing rule has no fuzz values")
+	}
+
+	var err error
+	if rule.Type == "replace-regex" {
+		if rule.ReplaceRegex == "" {
+			return fmt.Errorf("fuzzing type replace-regex requires replace-regex")
+		}
+		if rule.replaceRegex, err = regexp.Compile(rule.ReplaceRegex); err != nil {
+			return fmt.Errorf("invalid fuzzing replace-regex %s: %v", rule.ReplaceRegex, err)
+		}
+	}
+	if rule.keysRegex, err = compileRegexes(rule.KeysRegex); err != nil {
+		return err
+	}
+	if rule.valuesRegex, err = compileRegexes(rule.Values); err != nil {
+		return err
+	}
+	return nil
+}
+
+func compileRegexes(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fuzzing regex %s: %v", pattern, err)
+		}
+		compiled = append(compiled, regex)
+	}
+	return compiled, nil
+}
+
+// matches reports whether the parameter key with value is fuzzed.
+func (rule *Rule) matches(key, value string) bool {
+	if len(rule.Keys) > 0 || len(rule.keysRegex) > 0 {
+		matched := false
+		name := key
+		if index := strings.LastIndexByte(key, '.'); index >= 0 {
+			name = key[index+1:]
+		}
+		for _, k := range rule.Keys {
+			if strings.EqualFold(k, key) || strings.EqualFold(k, name) {
+				matched = true
+				break
+			}
+		}
+		for _, regex := range rule.keysRegex {
+			if matched {
+				break
+			}
+			matched = regex.MatchString(key)
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, regex := range rule.valuesRegex {
+		if regex.MatchString(value) {
+			return true
+		}
+	}
+	return len(rule.valuesRegex) == 0
+}
+
+// inject injects payload into value according to the rule type.
+func (rule *Rule) inject(value, payload string) string {
+	switch rule.Type {
+	case "prefix":
+		return payload + value
+	case "postfix":
+		return value + payload
+	case "infix":
+		runes := []rune(value)
+		return string(runes[:len(runes)/2]) + payload + string(runes[len(runes)/2:])
+	case "replace-regex":
+		return rule.replaceRegex.ReplaceAllString(value, payload)
+	default:
+		return payload
+	}
+}
+
+// fuzzRequest is a request the fuzzing rules mutate.
+type fuzzRequest struct {
+	method string
+	url    *url.URL
+	host   string
+	header http.Header
+	body   []byte
+}
+
+func newFuzzRequest(req *http.Request) (*fuzzRequest, error) {
+	var body []byte
+	if req.GetBody != nil {
+		reader, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		if body, err = ioutil.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	} else if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body = NopCloser(bytes.NewReader(body))
+	}
+	u := *req.URL
+	header := cloneHeader(req.Header)
+	header.Del("Content-Length")
+	return &fuzzRequest{method: req.Method, url: &u, host: req.Host, header: header, body: body}, nil
+}
+
+func (f *fuzzRequest) clone() *fuzzRequest {
+	u := *f.url
+	return &fuzzRequest{method: f.method, url: &u, host: f.host, header: cloneHeader(f.header), body: f.body}
+}
+
+// key identifies the request sent for f: its method, url, host, headers and
+// body.
+func (f *fuzzRequest) key() string {
+	var key bytes.Buffer
+	key.WriteString(f.method + " " + f.url.String() + "\x00" + f.host + "\x00")
+	f.header.Write(&key)
+	key.WriteByte(0)
+	key.Write(f.body)
+	return key.String()
+}
+
+func (f *fuzzRequest) newRequest() (*http.Request, error) {
+	var req *http.Request
+	var err error
+	if len(f.body) > 0 {
+		req, err = http.NewRequest(f.method, f.url.String(), bytes.NewReader(f.body))
+	} else {
+		req, err = http.NewRequest(f.method, f.url.String(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header = cloneHeader(f.header)
+	if f.host != "" {
+		req.Host = f.host
+	}
+	return req, nil
+}
+
+// fuzzPart holds the parameters of a part of a request, rebuild returns the
+// request with the parameters set to values.
+type fuzzPart struct {
+	keys    []string
+	values  []string
+	rebuild func(values []string) (*fuzzRequest, error)
+}
+
+func parseFuzzPart(part string, req *fuzzRequest) (*fuzzPart, error) {
+	switch part {
+	case "query":
+		return parseQueryPart(req), nil
+	case "path":
+		return parsePathPart(req), nil
+	case "header":
+		return parseHeaderPart(req), nil
+	case "cookie":
+		return parseCookiePart(req), nil
+	default:
+		return parseBodyPart(req)
+	}
+}
+
+// pair is a key=value parameter of a query, form or cookie, raw is kept to
+// rebuild the parameters that are not fuzzed as they were.
+type pair struct {
+	raw, key, value string
+}
+
+func parseFormPairs(encoded string) []pair {
+	var pairs []pair
+	for _, raw := range strings.Split(encoded, "&") {
+		if raw == "" {
+			continue
+		}
+		key, value := raw, ""
+		if index := strings.IndexByte(raw, '='); index >= 0 {
+			key, value = raw[:index], raw[index+1:]
+		}
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		pairs = append(pairs, pair{raw: raw, key: key, value: value})
+	}
+	return pairs
+}
+
+func encodeFormPairs(pairs []pair, values []string) string {
+	encoded := make([]string, len(pairs))
+	for i, p := range pairs {
+		if values[i] == p.value {
+			encoded[i] = p.raw
+			continue
+		}
+		encoded[i] = url.QueryEscape(p.key) + "=" + url.QueryEscape(values[i])
+	}
+	return strings.Join(encoded, "&")
+}
+
+func pairsPart(pairs []pair, rebuild func(values []string) (*fuzzRequest, error)) *fuzzPart {
+	part := &fuzzPart{rebuild: rebuild}
+	for _, p := range pairs {
+		part.keys = append(part.keys, p.key)
+		part.values = append(part.values, p.value)
+	}
+	return part
+}
+
+func parseQueryPart(req *fuzzRequest) *fuzzPart {
+	pairs := parseFormPairs(req.url.RawQuery)
+	return pairsPart(pairs, func(values []string) (*fuzzRequest, error) {
+		fuzzed := req.clone()
+		fuzzed.url.RawQuery = encodeFormPairs(pairs, values)
+		return fuzzed, nil
+	})
+}
+
+// parsePathPart makes the path segments parameters, named by their position
+// from 1.
+func parsePathPart(req *fuzzRequest) *fuzzPart {
+	segments := strings.Split(req.url.EscapedPath(), "/")
+	part := &fuzzPart{}
+	var indexes []int
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		value, err := url.PathUnescape(segment)
+		if err != nil {
+			value = segment
+		}
+		indexes = append(indexes, i)
+		part.keys = append(part.keys, strconv.Itoa(len(indexes)))
+		part.values = append(part.values, value)
+	}
+	original := part.values
+	part.rebuild = func(values []string) (*fuzzRequest, error) {
+		fuzzed := req.clone()
+		rawSegments := append([]string{}, segments...)
+		pathSegments := make([]string, len(segments))
+		for i, segment := range segments {
+			pathSegments[i], _ = url.PathUnescape(segment)
+		}
+		for i, index := range indexes {
+			if values[i] != original[i] {
+				// kept as is when it is a valid escaping, so traversal payloads stay raw
+				rawSegments[index] = values[i]
+				pathSegments[index] = values[i]
+			}
+		}
+		fuzzed.url.Path = strings.Join(pathSegments, "/")
+		fuzzed.url.RawPath = strings.Join(rawSegments, "/")
+		return fuzzed, nil
+	}
+	return part
+}
+
+// parseHeaderPart makes the headers parameters, except the ones the cookie
+// part and the transport own.
+func parseHeaderPart(req *fuzzRequest) *fuzzPart {
+	var names []string
+	for name := range req.header {
+		switch http.CanonicalHeaderKey(name) {
+		case "Cookie", "Host", "Content-Length":
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	part := &fuzzPart{keys: names}
+	for _, name := range names {
+		part.values = append(part.values, strings.Join(req.header[name], ", "))
+	}
+	part.rebuild = func(values []string) (*fuzzRequest, error) {
+		fuzzed := req.clone()
+		for i, name := range names {
+			fuzzed.header[name] = []string{values[i]}
+		}
+		return fuzzed, nil
+	}
+	return part
+}
+
+func parseCookiePart(req *fuzzRequest) *fuzzPart {
+	var pairs []pair
+	for _, raw := range strings.Split(req.header.Get("Cookie"), ";") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		key, value := raw, ""
+		if index := strings.IndexByte(raw, '='); index >= 0 {
+			key, value = raw[:index], raw[index+1:]
+		}
+		pairs = append(pairs, pair{raw: raw, key: key, value: value})
+	}
+	return pairsPart(pairs, func(values []string) (*fuzzRequest, error) {
+		fuzzed := req.clone()
+		cookies := make([]string, len(pairs))
+		for i, p := range pairs {
+			cookies[i] = p.key + "=" + values[i]
+		}
+		fuzzed.header.Set("Cookie", strings.Join(cookies, "; "))
+		return fuzzed, nil
+	})
+}
+
+// executeFuzzingRequests sends the requests the fuzzing rules derive from
+// base and runs the operators on each of them.
+func (r *Request) executeFuzzingRequests(input *protocols.ScanContext, generator *requestGenerator, base *generatedRequest, previous map[string]interface{}, callback protocols.OutputEventCallback, reqcount int) error {
+	source := base.request
+	if len(r.Path) == 0 && len(r.Raw) == 0 {
+		if inputRequest := GetInputRequest(input); inputRequest != nil {
+			source = inputRequest
+		}
+	}
+	req, err := newFuzzRequest(source)
+	if err != nil {
+		return err
+	}
+
+	var matched bool
+	eventCallback := func(event *protocols.InternalWrappedEvent) {
+		if event.OperatorsResult != nil && event.OperatorsResult.Matched {
+			matched = true
+		}
+		callback(event)
+	}
+	vars := base.Vars()
+	var requestErr error
+	for ruleIndex, rule := range r.Fuzzing {
+		payloads := make([]string, 0, len(rule.Fuzz))
+		for _, fuzz := range rule.Fuzz {
+			payload, err := common.Evaluate(fuzz, vars)
+			if err != nil {
+				return err
+			}
+			payloads = append(payloads, payload)
+		}
+
+		for _, partName := range rule.parts {
+			part, err := parseFuzzPart(partName, req)
+			if err != nil {
+				common.Debug("could not fuzz %s of %s: %s", partName, req.url, err.Error())
+				continue
+			}
+			var indexes []int
+			for i, key := range part.keys {
+				if rule.matches(key, part.values[i]) {
+					indexes = append(indexes, i)
+				}
+			}
+			if len(indexes) == 0 {
+				continue
+			}
+			groups := [][]int{indexes}
+			if rule.Mode == "single" {
+				groups = groups[:0]
+				for _, index := range indexes {
+					groups = append(groups, []int{index})
+				}
+			}
+
+			for _, payload := range payloads {
+				for _, group := range groups {
+					values := append([]string{}, part.values...)
+					keys := make([]string, len(group))
+					for i, index := range group {
+						values[index] = rule.inject(values[index], payload)
+						keys[i] = part.keys[index]
+					}
+					parameter := strings.Join(keys, ",")
+					fuzzed, err := part.rebuild(values)
+					if err != nil {
+						return err
+					}
+					if !generator.markFuzzed(fmt.Sprintf("%d\x00%s\x00%s\x00%s", ruleIndex, partName, parameter, fuzzed.key())) {
+						continue
+					}
+					httpRequest, err := fuzzed.newRequest()
+					if err != nil {
+						return err
+					}
+					if httpRequest.Header.Get("User-Agent") == "" {
+						httpRequest.Header.Set("User-Agent", ua)
+					}
+					generated := &generatedRequest{
+						request:  httpRequest.WithContext(r.Context()),
+						original: r,
+						meta:     base.meta,
+						dynamicValues: iutils.MergeMaps(base.dynamicValues, map[string]interface{}{
+							FuzzingPosition:  partName,
+							FuzzingParameter: parameter,
+							FuzzingPayload:   payload,
+						}),
+					}
+					if err := r.executeRequest(input, generated, previous, eventCallback, reqcount); err != nil {
+						requestErr = err
+					}
+					if matched && r.StopAtFirstMatch {
+						return requestErr
+					}
+				}
+			}
+		}
+	}
+	return requestErr
+}
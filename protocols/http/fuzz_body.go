@@ -0,0 +1,283 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseBodyPart makes the parameters of the request body, parsed by its
+// content type, or by its first character without one: form fields, json
+// leaves, xml leaf elements or multipart form fields. Nested parameters are
+// named by their dotted path, e.g. user.name.
+func parseBodyPart(req *fuzzRequest) (*fuzzPart, error) {
+	trimmed := bytes.TrimSpace(req.body)
+	if len(trimmed) == 0 {
+		return &fuzzPart{}, nil
+	}
+	mediaType, params, _ := mime.ParseMediaType(req.header.Get("Content-Type"))
+	switch {
+	case mediaType == "multipart/form-data":
+		return parseMultipartBody(req, params["boundary"])
+	case strings.HasSuffix(mediaType, "json") || trimmed[0] == '{' || trimmed[0] == '[':
+		return parseJSONBody(req)
+	case strings.HasSuffix(mediaType, "xml") || trimmed[0] == '<':
+		return parseXMLBody(req)
+	default:
+		return parseFormBody(req), nil
+	}
+}
+
+func withBody(req *fuzzRequest, body []byte) *fuzzRequest {
+	fuzzed := req.clone()
+	fuzzed.body = body
+	return fuzzed
+}
+
+func parseFormBody(req *fuzzRequest) *fuzzPart {
+	pairs := parseFormPairs(string(req.body))
+	return pairsPart(pairs, func(values []string) (*fuzzRequest, error) {
+		return withBody(req, []byte(encodeFormPairs(pairs, values))), nil
+	})
+}
+
+func parseJSONBody(req *fuzzRequest) (*fuzzPart, error) {
+	decoder := json.NewDecoder(bytes.NewReader(req.body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	part := &fuzzPart{}
+	var paths [][]interface{}
+	var walk func(node interface{}, path []interface{}, name string)
+	walk = func(node interface{}, path []interface{}, name string) {
+		join := func(key string) string {
+			if name == "" {
+				return key
+			}
+			return name + "." + key
+		}
+		switch n := node.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(n))
+			for key := range n {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(n[key], append(append([]interface{}{}, path...), key), join(key))
+			}
+			return
+		case []interface{}:
+			for i, item := range n {
+				walk(item, append(append([]interface{}{}, path...), i), join(strconv.Itoa(i)))
+			}
+			return
+		case string:
+			part.values = append(part.values, n)
+		case json.Number:
+			part.values = append(part.values, n.String())
+		case bool:
+			part.values = append(part.values, strconv.FormatBool(n))
+		default:
+			part.values = append(part.values, "")
+		}
+		part.keys = append(part.keys, name)
+		paths = append(paths, path)
+	}
+	walk(document, nil, "")
+
+	original := part.values
+	part.rebuild = func(values []string) (*fuzzRequest, error) {
+		fuzzed := document
+		for i, path := range paths {
+			if values[i] != original[i] {
+				fuzzed = setJSONValue(fuzzed, path, values[i])
+			}
+		}
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(fuzzed); err != nil {
+			return nil, err
+		}
+		return withBody(req, bytes.TrimRight(buf.Bytes(), "\n")), nil
+	}
+	return part, nil
+}
+
+// setJSONValue returns node with the value at path set, copying the objects
+// and arrays on the path so that node is left untouched.
+func setJSONValue(node interface{}, path []interface{}, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(n))
+		for key, item := range n {
+			copied[key] = item
+		}
+		key := path[0].(string)
+		copied[key] = setJSONValue(n[key], path[1:], value)
+		return copied
+	case []interface{}:
+		copied := append([]interface{}{}, n...)
+		index := path[0].(int)
+		copied[index] = setJSONValue(n[index], path[1:], value)
+		return copied
+	}
+	return node
+}
+
+// xmlSpan is the content of a leaf element in the body.
+type xmlSpan struct {
+	start, end int64
+}
+
+// parseXMLBody makes the leaf elements parameters. Their content is replaced
+// in place in the body, so the rest of the document is sent as is.
+func parseXMLBody(req *fuzzRequest) (*fuzzPart, error) {
+	type element struct {
+		name     string
+		start    int64
+		children bool
+		text     bytes.Buffer
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(req.body))
+	decoder.Strict = false
+	part := &fuzzPart{}
+	var spans []xmlSpan
+	var stack []*element
+	for {
+		before := decoder.InputOffset()
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) > 0 {
+				stack[len(stack)-1].children = true
+			}
+			stack = append(stack, &element{name: t.Name.Local, start: decoder.InputOffset()})
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected end element %s", t.Name.Local)
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			// self-closing elements have no content to replace
+			if top.children || (before == top.start && bytes.HasSuffix(req.body[:top.start], []byte("/>"))) {
+				continue
+			}
+			names := make([]string, 0, len(stack)+1)
+			for _, parent := range stack {
+				names = append(names, parent.name)
+			}
+			part.keys = append(part.keys, strings.Join(append(names, top.name), "."))
+			part.values = append(part.values, top.text.String())
+			spans = append(spans, xmlSpan{start: top.start, end: before})
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("unclosed element %s", stack[len(stack)-1].name)
+	}
+
+	original := part.values
+	part.rebuild = func(values []string) (*fuzzRequest, error) {
+		var buf bytes.Buffer
+		var offset int64
+		for i, span := range spans {
+			if values[i] == original[i] {
+				continue
+			}
+			buf.Write(req.body[offset:span.start])
+			if err := xml.EscapeText(&buf, []byte(values[i])); err != nil {
+				return nil, err
+			}
+			offset = span.end
+		}
+		buf.Write(req.body[offset:])
+		return withBody(req, buf.Bytes()), nil
+	}
+	return part, nil
+}
+
+// parseMultipartBody makes the form fields parameters, the files are sent
+// as they are.
+func parseMultipartBody(req *fuzzRequest, boundary string) (*fuzzPart, error) {
+	if boundary == "" {
+		return nil, fmt.Errorf("multipart body without boundary")
+	}
+	type formPart struct {
+		header  textproto.MIMEHeader
+		content []byte
+		field   int
+	}
+	reader := multipart.NewReader(bytes.NewReader(req.body), boundary)
+	part := &fuzzPart{}
+	var formParts []formPart
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(p)
+		if err != nil {
+			return nil, err
+		}
+		field := -1
+		if p.FileName() == "" {
+			field = len(part.keys)
+			part.keys = append(part.keys, p.FormName())
+			part.values = append(part.values, string(content))
+		}
+		formParts = append(formParts, formPart{header: p.Header, content: content, field: field})
+	}
+
+	part.rebuild = func(values []string) (*fuzzRequest, error) {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		if err := writer.SetBoundary(boundary); err != nil {
+			return nil, err
+		}
+		for _, formPart := range formParts {
+			w, err := writer.CreatePart(formPart.header)
+			if err != nil {
+				return nil, err
+			}
+			content := formPart.content
+			if formPart.field >= 0 {
+				content = []byte(values[formPart.field])
+			}
+			if _, err := w.Write(content); err != nil {
+				return nil, err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return withBody(req, buf.Bytes()), nil
+	}
+	return part, nil
+}
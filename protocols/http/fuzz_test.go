@@ -0,0 +1,261 @@
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chainreactors/neutron/operators"
+	"github.com/chainreactors/neutron/protocols"
+	"github.com/stretchr/testify/require"
+)
+
+type fuzzedRequest struct {
+	uri    string
+	header http.Header
+	body   string
+}
+
+func newFuzzServer(t *testing.T) (*httptest.Server, func() []fuzzedRequest) {
+	var mu sync.Mutex
+	var requests []fuzzedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		mu.Lock()
+		requests = append(requests, fuzzedRequest{uri: r.RequestURI, header: r.Header, body: string(body)})
+		mu.Unlock()
+		if strings.Contains(r.RequestURI, "%27") {
+			w.Write([]byte("SQL syntax error"))
+		}
+	}))
+	return server, func() []fuzzedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		fuzzed := requests
+		requests = nil
+		return fuzzed
+	}
+}
+
+func executeFuzzing(t *testing.T, r *Request, input *protocols.ScanContext) []*protocols.InternalWrappedEvent {
+	require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{Timeout: 5}}))
+	var events []*protocols.InternalWrappedEvent
+	require.NoError(t, r.ExecuteWithResults(input, map[string]interface{}{}, map[string]interface{}{}, func(event *protocols.InternalWrappedEvent) {
+		events = append(events, event)
+	}))
+	return events
+}
+
+func fuzzedURIs(requests []fuzzedRequest) []string {
+	uris := make([]string, len(requests))
+	for i, request := range requests {
+		uris[i] = request.uri
+	}
+	return uris
+}
+
+func TestFuzzingURL(t *testing.T) {
+	server, requests := newFuzzServer(t)
+	defer server.Close()
+	input := protocols.NewScanContext(server.URL, nil)
+
+	r := &Request{
+		Path:    []string{"{{BaseURL}}/search?q=a&id=1&page=2"},
+		Method:  "GET",
+		Fuzzing: []*Rule{{Part: "query", Type: "postfix", Keys: []string{"q", "id"}, Fuzz: []string{"'"}}},
+	}
+	r.Matchers = append(r.Matchers, &operators.Matcher{Type: "word", Words: []string{"SQL syntax"}})
+	events := executeFuzzing(t, r, input)
+	require.Equal(t, []string{"/search?q=a%27&id=1&page=2", "/search?q=a&id=1%27&page=2"}, fuzzedURIs(requests()))
+	require.Len(t, events, 2)
+	require.True(t, events[1].OperatorsResult.Matched)
+	require.Equal(t, "id", events[1].InternalEvent[FuzzingParameter])
+	require.Equal(t, "query", events[1].InternalEvent[FuzzingPosition])
+	require.Equal(t, "'", events[1].Results[0].Metadata[FuzzingPayload])
+
+	r = &Request{
+		Path:    []string{"{{BaseURL}}/search?q=abcd&id=1"},
+		Method:  "GET",
+		Fuzzing: []*Rule{{Part: "query", Type: "infix", Mode: "multiple", Fuzz: []string{"x"}}},
+	}
+	executeFuzzing(t, r, input)
+	require.Equal(t, []string{"/search?q=abxcd&id=x1"}, fuzzedURIs(requests()))
+
+	r = &Request{
+		Path:    []string{"{{BaseURL}}/api/users/42/profile"},
+		Method:  "GET",
+		Fuzzing: []*Rule{{Part: "path", Values: []string{`^\d+$`}, Fuzz: []string{"1 OR 1"}}},
+	}
+	executeFuzzing(t, r, input)
+	require.Equal(t, []string{"/api/users/1%20OR%201/profile"}, fuzzedURIs(requests()))
+
+	r = &Request{
+		Path:    []string{"{{BaseURL}}/?token=abc123"},
+		Method:  "GET",
+		Fuzzing: []*Rule{{Part: "query", Type: "replace-regex", ReplaceRegex: `\d+`, Fuzz: []string{"0"}}},
+	}
+	executeFuzzing(t, r, input)
+	require.Equal(t, []string{"/?token=abc0"}, fuzzedURIs(requests()))
+}
+
+func TestFuzzingHeaders(t *testing.T) {
+	server, requests := newFuzzServer(t)
+	defer server.Close()
+
+	r := &Request{
+		Path:    []string{"{{BaseURL}}/"},
+		Method:  "GET",
+		Headers: map[string]string{"X-Api-Key": "key", "Cookie": "a=1; session=abc"},
+		Fuzzing: []*Rule{
+			{Part: "header", Type: "prefix", Keys: []string{"x-api-key"}, Fuzz: []string{"'"}},
+			{Part: "cookie", KeysRegex: []string{"^sess"}, Fuzz: []string{"admin"}},
+		},
+	}
+	executeFuzzing(t, r, protocols.NewScanContext(server.URL, nil))
+	fuzzed := requests()
+	require.Len(t, fuzzed, 2)
+	require.Equal(t, "'key", fuzzed[0].header.Get("X-Api-Key"))
+	require.Equal(t, "a=1; session=abc", fuzzed[0].header.Get("Cookie"))
+	require.Equal(t, "key", fuzzed[1].header.Get("X-Api-Key"))
+	require.Equal(t, "a=1; session=admin", fuzzed[1].header.Get("Cookie"))
+}
+
+func TestFuzzingBody(t *testing.T) {
+	server, requests := newFuzzServer(t)
+	defer server.Close()
+
+	execute := func(contentType, body string, rule *Rule) []fuzzedRequest {
+		input := protocols.NewScanContext(server.URL, nil)
+		req, err := http.NewRequest("POST", server.URL+"/api", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		require.NoError(t, SetInputRequest(input, req))
+		executeFuzzing(t, &Request{Fuzzing: []*Rule{rule}}, input)
+		return requests()
+	}
+
+	fuzzed := execute("application/x-www-form-urlencoded", "a=1&b=hello", &Rule{Part: "body", Keys: []string{"b"}, Fuzz: []string{"x y"}})
+	require.Len(t, fuzzed, 1)
+	require.Equal(t, "/api", fuzzed[0].uri)
+	require.Equal(t, "a=1&b=x+y", fuzzed[0].body)
+
+	fuzzed = execute("application/json", `{"user":{"name":"bob","age":3},"tags":["x"]}`, &Rule{Part: "body", Type: "postfix", Keys: []string{"name", "tags.0"}, Fuzz: []string{"<x>"}})
+	require.Len(t, fuzzed, 2)
+	require.Equal(t, `{"tags":["x<x>"],"user":{"age":3,"name":"bob"}}`, fuzzed[0].body)
+	require.Equal(t, `{"tags":["x"],"user":{"age":3,"name":"bob<x>"}}`, fuzzed[1].body)
+
+	fuzzed = execute("text/xml", `<?xml version="1.0"?><root><user><name>bob</name><id>1</id><empty/></user></root>`, &Rule{Part: "body", Keys: []string{"root.user.id"}, Fuzz: []string{"<1>"}})
+	require.Len(t, fuzzed, 1)
+	require.Equal(t, `<?xml version="1.0"?><root><user><name>bob</name><id>&lt;1&gt;</id><empty/></user></root>`, fuzzed[0].body)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	require.NoError(t, writer.WriteField("name", "bob"))
+	file, err := writer.CreateFormFile("file", "a.txt")
+	require.NoError(t, err)
+	file.Write([]byte("content"))
+	require.NoError(t, writer.Close())
+	fuzzed = execute(writer.FormDataContentType(), body.String(), &Rule{Part: "body", Fuzz: []string{"'"}})
+	require.Len(t, fuzzed, 1)
+	form, err := multipart.NewReader(strings.NewReader(fuzzed[0].body), writer.Boundary()).ReadForm(1 << 20)
+	require.NoError(t, err)
+	require.Equal(t, []string{"'"}, form.Value["name"])
+	require.Equal(t, "a.txt", form.File["file"][0].Filename)
+
+	// without an input request the input url is fuzzed
+	input := protocols.NewScanContext(server.URL+"/?id=1", nil)
+	executeFuzzing(t, &Request{Fuzzing: []*Rule{{Part: "request", Fuzz: []string{"'"}}}}, input)
+	fuzzed = requests()
+	require.Equal(t, []string{"/?id=%27", "/?id=1"}, fuzzedURIs(fuzzed))
+	require.Equal(t, "'", fuzzed[1].header.Get("User-Agent"))
+}
+
+func TestFuzzingPayloads(t *testing.T) {
+	server, requests := newFuzzServer(t)
+	defer server.Close()
+
+	r := &Request{
+		Path:     []string{"{{BaseURL}}/?id=1"},
+		Method:   "GET",
+		Payloads: map[string]interface{}{"injection": []string{"a", "b"}},
+		Fuzzing:  []*Rule{{Part: "query", Fuzz: []string{"'", "{{injection}}"}}},
+	}
+	executeFuzzing(t, r, protocols.NewScanContext(server.URL, nil))
+	require.ElementsMatch(t, []string{"/?id=%27", "/?id=a", "/?id=b"}, fuzzedURIs(requests()))
+
+	r = &Request{
+		Path:             []string{"{{BaseURL}}/?id=1&q=2"},
+		Method:           "GET",
+		StopAtFirstMatch: true,
+		Fuzzing:          []*Rule{{Part: "query", Fuzz: []string{"'", "x"}}},
+	}
+	r.Matchers = append(r.Matchers, &operators.Matcher{Type: "word", Words: []string{"SQL syntax"}})
+	executeFuzzing(t, r, protocols.NewScanContext(server.URL, nil))
+	require.Equal(t, []string{"/?id=%27&q=2"}, fuzzedURIs(requests()))
+}
+
+func TestFuzzingDistinctRequests(t *testing.T) {
+	server, requests := newFuzzServer(t)
+	defer server.Close()
+
+	// raw requests to the same url differ by method and body
+	r := &Request{
+		Raw: []string{
+			"GET /?id=1 HTTP/1.1\r\nHost: {{Hostname}}\r\n\r\n",
+			"POST /?id=1 HTTP/1.1\r\nHost: {{Hostname}}\r\nContent-Type: text/plain\r\n\r\nbody",
+		},
+		Fuzzing: []*Rule{{Part: "query", Fuzz: []string{"'"}}},
+	}
+	executeFuzzing(t, r, protocols.NewScanContext(server.URL, nil))
+	fuzzed := requests()
+	require.Equal(t, []string{"/?id=%27", "/?id=%27"}, fuzzedURIs(fuzzed))
+	require.Equal(t, "body", fuzzed[1].body)
+
+	// the payloads only change the body while the query is fuzzed
+	r = &Request{
+		Path:     []string{"{{BaseURL}}/?id=1"},
+		Method:   "POST",
+		Body:     "user={{u}}",
+		Payloads: map[string]interface{}{"u": []string{"a", "b"}},
+		Fuzzing:  []*Rule{{Part: "query", Fuzz: []string{"'"}}},
+	}
+	executeFuzzing(t, r, protocols.NewScanContext(server.URL, nil))
+	var bodies []string
+	for _, request := range requests() {
+		bodies = append(bodies, request.body)
+	}
+	require.ElementsMatch(t, []string{"user=a", "user=b"}, bodies)
+}
+
+func TestFuzzingCompile(t *testing.T) {
+	rule := &Rule{Part: "request", Fuzz: []string{"'"}}
+	require.NoError(t, rule.compile())
+	require.Equal(t, "replace", rule.Type)
+	require.Equal(t, "single", rule.Mode)
+	require.Equal(t, fuzzingParts, rule.parts)
+
+	for _, rule := range []*Rule{
+		{Fuzz: []string{"'"}},
+		{Part: "fragment", Fuzz: []string{"'"}},
+		{Part: "query", Type: "append", Fuzz: []string{"'"}},
+		{Part: "query", Mode: "all", Fuzz: []string{"'"}},
+		{Part: "query"},
+		{Part: "query", Type: "replace-regex", Fuzz: []string{"'"}},
+		{Part: "query", KeysRegex: []string{"("}, Fuzz: []string{"'"}},
+	} {
+		require.Error(t, rule.compile())
+	}
+
+	r := &Request{
+		Path:    []string{"{{BaseURL}}"},
+		Timing:  &TimingAnalysis{},
+		Fuzzing: []*Rule{{Part: "query", Fuzz: []string{"'"}}},
+	}
+	require.Error(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{Timeout: 5}}))
+}
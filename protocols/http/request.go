@@ -11,10 +11,12 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/chainreactors/neutron/common"
+	"github.com/chainreactors/neutron/common/tlsx"
 	"github.com/chainreactors/utils/iutils"
 	"github.com/chainreactors/neutron/operators"
 	"github.com/chainreactors/neutron/protocols"
@@ -36,13 +38,15 @@ type Request struct {
 	// Name is the name of the request
 	Name string `json:"name,omitempty" yaml:"name,omitempty"`
 	// AttackType is the attack type
-	// Sniper, PitchFork and ClusterBomb. Default is Sniper
+	// Sniper, PitchFork, ClusterBomb and BatteringRam. Default is Sniper
 	AttackType string `json:"attack,omitempty" yaml:"attack,omitempty"`
 	// Method is the request method, whether GET, POST, PUT, etc
 	Method string `json:"method,omitempty" yaml:"method,omitempty"`
 	// Body is an optional parameter which contains the request body for POST methods, etc
 	Body string `json:"body,omitempty" yaml:"body,omitempty"`
-	// Path contains the path/s for the request variables
+	// Payloads contains the values of the request variables, by name: a
+	// list, a file of the template catalog or a generator, see
+	// protocols.NewGenerator
 	Payloads map[string]interface{} `json:"payloads,omitempty" yaml:"payloads,omitempty"`
 	// Headers contains headers to send with the request
 	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
@@ -78,7 +82,14 @@ type Request struct {
 	//   StopAtFirstMatch stops the execution of the requests and template as soon as a match is found.
 	StopAtFirstMatch bool `json:"stop-at-first-match,omitempty" yaml:"stop-at-first-match,omitempty"`
 
-	IterateAll        bool                 `yaml:"iterate-all,omitempty" json:"iterate-all,omitempty"`
+	IterateAll bool `yaml:"iterate-all,omitempty" json:"iterate-all,omitempty"`
+	// Timing confirms time-based injections from the latency of the request
+	// over several injected delays, see TimingAnalysis.
+	Timing *TimingAnalysis `json:"timing,omitempty" yaml:"timing,omitempty"`
+	// Fuzzing are nuclei-style rules injecting the fuzz values into the query,
+	// path, headers, cookies or body of the request, see Rule.
+	Fuzzing []*Rule `json:"fuzzing,omitempty" yaml:"fuzzing,omitempty"`
+
 	generator         *protocols.Generator `json:"-" yaml:"-" jsonschema:"-"`
 	httpClient        *http.Client         `json:"-" yaml:"-" jsonschema:"-"`
 	httpresp          *http.Response       `json:"-" yaml:"-" jsonschema:"-"`
@@ -188,12 +199,31 @@ func (r *Request) MakeResultEventItem(wrapped *protocols.InternalWrappedEvent) *
 
 // requests returns the total number of requests the YAML rule will perform
 func (r *Request) Requests() int {
+	return r.ScanRequests(nil)
+}
+
+// ScanRequests returns the number of requests for input, whose payloads
+// replace the payloads of the template.
+func (r *Request) ScanRequests(input *protocols.ScanContext) int {
 	sequenceCount := len(r.Path)
 	if len(r.Raw) > 0 {
 		sequenceCount = len(r.Raw)
 	}
-	if r.generator != nil {
-		return r.generator.NewIterator().Total() * sequenceCount
+	if sequenceCount == 0 && len(r.Fuzzing) > 0 {
+		sequenceCount = len(fuzzingSequence)
+	}
+	if r.Timing != nil {
+		sequenceCount *= r.Timing.requests()
+	}
+	generator := r.generator
+	if input != nil && len(input.Payloads) > 0 {
+		var err error
+		if generator, err = protocols.NewGenerator(input.Payloads, r.attackType); err != nil {
+			return 0
+		}
+	}
+	if generator != nil {
+		return generator.NewIterator().Total() * sequenceCount
 	}
 	return sequenceCount
 }
@@ -236,6 +266,26 @@ func (r *Request) Compile(options *protocols.ExecuterOptions) error {
 		}
 	}
 
+	for _, rule := range r.Fuzzing {
+		if err := rule.compile(); err != nil {
+			return err
+		}
+	}
+	if r.Timing != nil && len(r.Fuzzing) > 0 {
+		return fmt.Errorf("timing and fuzzing can not be combined")
+	}
+	if r.Timing != nil {
+		if err := r.Timing.compile(); err != nil {
+			return err
+		}
+	} else {
+		for _, matcher := range r.Matchers {
+			if matcher.Type == "timing" {
+				return errTimingMatcher
+			}
+		}
+	}
+
 	// 修改: 只编译一次Matcher
 	if len(r.Matchers) > 0 || len(r.Extractors) > 0 {
 		compiled := &r.Operators
@@ -275,8 +325,11 @@ func (r *Request) Compile(options *protocols.ExecuterOptions) error {
 			}
 		}
 
-		var err error
-		r.generator, err = protocols.NewGenerator(r.Payloads, r.attackType)
+		payloads, err := options.ResolvePayloads(r.Payloads)
+		if err != nil {
+			return err
+		}
+		r.generator, err = protocols.NewGenerator(payloads, r.attackType)
 		if err != nil {
 			return err
 		}
@@ -306,7 +359,12 @@ func (r *Request) ExecuteRequestWithResults(input *protocols.ScanContext, dynami
 	for {
 		// returns two values, error and skip, which skips the execution for the request instance.
 		executeFunc := func(data string, payloads, dynamicValue map[string]interface{}) (bool, error) {
-			generatedHttpRequest, err := generator.Make(input.Input, data, payloads, dynamicValue)
+			requestValues := dynamicValue
+			if r.Timing != nil {
+				// the request the operators run on carries the last delay
+				requestValues = r.Timing.withDelay(dynamicValue, r.Timing.Delays[len(r.Timing.Delays)-1])
+			}
+			generatedHttpRequest, err := generator.Make(input.Input, data, payloads, requestValues)
 			if err != nil {
 				if err == io.EOF || err == errStopExecution {
 					return true, nil
@@ -318,7 +376,7 @@ func (r *Request) ExecuteRequestWithResults(input *protocols.ScanContext, dynami
 				generatedHttpRequest.request.Header.Set("User-Agent", ua)
 			}
 			var gotMatches bool
-			err = r.executeRequest(input, generatedHttpRequest, previous, func(event *protocols.InternalWrappedEvent) {
+			eventCallback := func(event *protocols.InternalWrappedEvent) {
 				// Add the extracts to the dynamic values if any.
 				if event.OperatorsResult != nil {
 					gotMatches = event.OperatorsResult.Matched
@@ -330,7 +388,16 @@ func (r *Request) ExecuteRequestWithResults(input *protocols.ScanContext, dynami
 					}
 				}
 				callback(event)
-			}, requestCount)
+			}
+			if r.Timing != nil {
+				err = r.executeTimingRequest(input, generatedHttpRequest, func(delay float64) (*generatedRequest, error) {
+					return generator.Make(input.Input, data, payloads, r.Timing.withDelay(dynamicValue, delay))
+				}, previous, eventCallback, requestCount)
+			} else if len(r.Fuzzing) > 0 {
+				err = r.executeFuzzingRequests(input, generator, generatedHttpRequest, previous, eventCallback, requestCount)
+			} else {
+				err = r.executeRequest(input, generatedHttpRequest, previous, eventCallback, requestCount)
+			}
 
 			// If a variable is unresolved, skip all further requests
 			if err == errStopExecution {
@@ -383,6 +450,16 @@ func (r *Request) ExecuteRequestWithResults(input *protocols.ScanContext, dynami
 }
 
 func (r *Request) executeRequest(input *protocols.ScanContext, request *generatedRequest, previousEvent map[string]interface{}, callback protocols.OutputEventCallback, reqcount int) error {
+	resp, reqBody, duration, err := r.sendRequest(input, request)
+	if err != nil {
+		return err
+	}
+	return r.handleResponse(input, request, resp, reqBody, duration, previousEvent, callback, reqcount)
+}
+
+// sendRequest sends request and returns the response, the request body it
+// sent and the time to the response headers.
+func (r *Request) sendRequest(input *protocols.ScanContext, request *generatedRequest) (*http.Response, []byte, time.Duration, error) {
 	var reqBody []byte
 	if request.request.Body != nil {
 		reqBody, _ = ioutil.ReadAll(request.request.Body)
@@ -396,9 +473,13 @@ func (r *Request) executeRequest(input *protocols.ScanContext, request *generate
 	common.Dump(request.request)
 	if err != nil {
 		common.Debug("%s nuclei request failed, %s", request.request.URL, err.Error())
-		return err
+		return nil, nil, 0, err
 	}
-	duration := time.Since(timeStart)
+	return resp, reqBody, time.Since(timeStart), nil
+}
+
+// handleResponse builds the event of resp and runs the operators on it.
+func (r *Request) handleResponse(input *protocols.ScanContext, request *generatedRequest, resp *http.Response, reqBody []byte, duration time.Duration, previousEvent map[string]interface{}, callback protocols.OutputEventCallback, reqcount int) error {
 	matchedURL := input.Input
 	if request.request != nil {
 		matchedURL = request.request.URL.String()
@@ -420,28 +501,18 @@ func (r *Request) executeRequest(input *protocols.ScanContext, request *generate
 
 	// Add to history the current request number metadata if asked by the user.
 	if r.NeedsRequestCondition() {
-		requestIndex := reqcount
-		switch offset := request.dynamicValues["__request_index_offset"].(type) {
-		case int:
-			requestIndex += offset
-		case int64:
-			requestIndex += int(offset)
-		case float64:
-			requestIndex += int(offset)
-		}
-		for k, v := range outputEvent {
-			key := fmt.Sprintf("%s_%d", k, requestIndex)
-			previousEvent[key] = v
-			finalEvent[key] = v
-		}
+		protocols.AddRequestHistory(previousEvent, finalEvent, outputEvent, protocols.RequestIndex(request.dynamicValues, reqcount))
 	}
+	protocols.AddProtocolEvent(previousEvent, outputEvent, r.Type(), request.dynamicValues)
 	finalEvent = iutils.MergeMaps(finalEvent, request.Vars())
 	common.Dump(finalEvent)
 
 	event := &protocols.InternalWrappedEvent{InternalEvent: finalEvent}
 	if r.CompiledOperators != nil {
 		var ok bool
-		event.OperatorsResult, ok = r.CompiledOperators.Execute(finalEvent, r.Match, r.Extract)
+		event.OperatorsResult, ok = protocols.ExecuteOperators(input, r, r.CompiledOperators, finalEvent, event, func(part string) (string, bool) {
+			return r.getMatchPart(part, finalEvent)
+		})
 		if ok && event.OperatorsResult != nil {
 			if r.InternalMatchers {
 				event.OperatorsResult.Matched = false
@@ -456,10 +527,10 @@ func (r *Request) executeRequest(input *protocols.ScanContext, request *generate
 			return nil
 		}
 	}
-	if input.TraceAll {
+	if input.TraceAll || event.Explanation != nil {
 		callback(event)
 	}
-	return err
+	return nil
 }
 
 func (r *Request) clientForExecution(input *protocols.ScanContext) *http.Client {
@@ -608,34 +679,84 @@ var (
 	urlWithPortRegex = regexp.MustCompile(`{{BaseURL}}:(\d+)`)
 )
 
-var (
-	// Determines if request condition are needed by detecting the pattern _xxx
-	reRequestCondition = regexp.MustCompile(`(?m)_\d+`)
-)
-
 // NeedsRequestCondition determines if request condition should be enabled
 func (request *Request) NeedsRequestCondition() bool {
-	if request.ReqCondition {
-		return true
+	return request.ReqCondition || protocols.NeedsRequestCondition(&request.Operators)
+}
+
+// responseDSLKeys are the fields responseToDSLMap defines for every response.
+var responseDSLKeys = []string{
+	"host", "type", "matched", "status_code", "duration", "latency",
+	"header", "all_headers", "body", "favicon_hash", "title", "content_length",
+	"response", "raw", "request",
+}
+
+// ResponseDSLScope extends scope with the fields of the responses, which the
+// matchers and extractors can reference. Lowercase names can be normalized
+// response headers or cookies, so they are always accepted.
+func (request *Request) ResponseDSLScope(scope *protocols.DSLScope) *protocols.DSLScope {
+	keys := append(append([]string{}, responseDSLKeys...), tlsx.CertDSLKeys...)
+	if request.Timing != nil {
+		keys = append(keys, operators.TimingDSLKeys...)
 	}
-	for _, matcher := range request.Matchers {
-		if checkRequestConditionExpressions(matcher.DSL...) {
-			return true
+	if len(request.Fuzzing) > 0 {
+		keys = append(keys, fuzzingDSLKeys...)
+	}
+	return scope.With(isResponseHeaderName, keys...)
+}
+
+// CheckDSL statically checks the placeholders and dsl operators of the
+// request; field is its template path, e.g. http[0].
+func (request *Request) CheckDSL(field string, scope *protocols.DSLScope) error {
+	scope = scope.With(nil, payloadNames(request.Payloads)...)
+	for i, path := range request.Path {
+		if err := protocols.CheckPlaceholders(fmt.Sprintf("%s.path[%d]", field, i), path, scope); err != nil {
+			return err
 		}
-		if checkRequestConditionExpressions(matcher.Part) {
-			return true
+	}
+	for i, raw := range request.Raw {
+		if err := protocols.CheckPlaceholders(fmt.Sprintf("%s.raw[%d]", field, i), raw, scope); err != nil {
+			return err
 		}
 	}
-	for _, extractor := range request.Extractors {
-		if checkRequestConditionExpressions(extractor.DSL...) {
-			return true
+	names := make([]string, 0, len(request.Headers))
+	for name := range request.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := protocols.CheckPlaceholders(fmt.Sprintf("%s.headers.%s", field, name), request.Headers[name], scope); err != nil {
+			return err
+		}
+	}
+	if err := protocols.CheckPlaceholders(field+".body", request.Body, scope); err != nil {
+		return err
+	}
+	for i, rule := range request.Fuzzing {
+		for j, fuzz := range rule.Fuzz {
+			if err := protocols.CheckPlaceholders(fmt.Sprintf("%s.fuzzing[%d].fuzz[%d]", field, i, j), fuzz, scope); err != nil {
+				return err
+			}
 		}
-		if checkRequestConditionExpressions(extractor.Part) {
-			return true
+	}
+	return protocols.CheckOperators(field, &request.Operators, request.ResponseDSLScope(scope))
+}
+
+func isResponseHeaderName(name string) bool {
+	for _, ch := range name {
+		if !(ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '_') {
+			return false
 		}
 	}
+	return true
+}
 
-	return false
+func payloadNames(payloads map[string]interface{}) []string {
+	names := make([]string, 0, len(payloads))
+	for name := range payloads {
+		names = append(names, name)
+	}
+	return names
 }
 
 // cloneHeader 复制一份 http.Header（http.Header.Clone 是 go1.13 API，
@@ -659,15 +780,6 @@ func extractHTMLTitle(body string) string {
 	return strings.TrimSpace(html.UnescapeString(match[1]))
 }
 
-func checkRequestConditionExpressions(expressions ...string) bool {
-	for _, expression := range expressions {
-		if reRequestCondition.MatchString(expression) {
-			return true
-		}
-	}
-	return false
-}
-
 var (
 	titleRE = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
 )
@@ -22,6 +22,7 @@ type requestGenerator struct {
 	input            *protocols.ScanContext
 	payloadIterator  *protocols.Iterator
 	rawRequest       *rawRequest
+	fuzzed           map[string]struct{}
 }
 
 // newGenerator creates a NewGenerator request generator instance
@@ -46,6 +47,19 @@ func (r *Request) newGenerator(input *protocols.ScanContext) *requestGenerator {
 	return generator
 }
 
+// markFuzzed records a fuzzed request, it returns false when the request was
+// already sent, e.g. a fuzz value without payloads for another payload set.
+func (r *requestGenerator) markFuzzed(key string) bool {
+	if r.fuzzed == nil {
+		r.fuzzed = make(map[string]struct{})
+	}
+	if _, ok := r.fuzzed[key]; ok {
+		return false
+	}
+	r.fuzzed[key] = struct{}{}
+	return true
+}
+
 // nextValue returns the next path or the next raw request depending on user input
 // It returns false if all the inputs have been exhausted by the generator instance.
 func (r *requestGenerator) nextValue() (value string, payloads map[string]interface{}, result bool) {
@@ -60,6 +74,8 @@ func (r *requestGenerator) nextValue() (value string, payloads map[string]interf
 		sequence = r.request.Path
 	case len(r.request.Raw) > 0:
 		sequence = r.request.Raw
+	case len(r.request.Fuzzing) > 0:
+		sequence = fuzzingSequence
 	default:
 		return "", nil, false
 	}
@@ -0,0 +1,207 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/chainreactors/neutron/operators"
+	"github.com/chainreactors/neutron/protocols"
+	"github.com/chainreactors/utils/iutils"
+)
+
+// TimingAnalysis confirms time-based blind injections statistically instead
+// of with a single `duration >= 5` check. Every generated request is sent
+// Baseline times with a zero delay, then once per delay, the delay in seconds
+// being bound to Variable. The latencies are fitted against the delays and
+// the `timing` matcher confirms when they grow linearly, one second per
+// second, within Tolerance:
+//
+//	timing:
+//	  variable: delay
+//	  baseline: 5
+//	  delays: [2, 4, 6]
+//	  tolerance: 0.3
+//
+// The operators run on the response to the last delay, with the statistics
+// added to the event as timing_* values.
+type TimingAnalysis struct {
+	// Variable is the variable holding the delay injected by the payload,
+	// e.g. SLEEP({{delay}}). Default is delay.
+	Variable string `json:"variable,omitempty" yaml:"variable,omitempty"`
+	// Baseline is the number of samples taken with a zero delay. Default is 3.
+	Baseline int `json:"baseline,omitempty" yaml:"baseline,omitempty"`
+	// Delays are the injected delays in seconds, at least two distinct ones.
+	// Default is 2, 4 and 6.
+	Delays []float64 `json:"delays,omitempty" yaml:"delays,omitempty"`
+	// Tolerance is the relative error accepted on the slope and the
+	// correlation of the fit. Default is 0.3.
+	Tolerance float64 `json:"tolerance,omitempty" yaml:"tolerance,omitempty"`
+}
+
+var errTimingMatcher = errors.New("timing matcher requires a timing block")
+
+func (t *TimingAnalysis) compile() error {
+	if t.Variable == "" {
+		t.Variable = "delay"
+	}
+	if t.Baseline == 0 {
+		t.Baseline = 3
+	}
+	if len(t.Delays) == 0 {
+		t.Delays = []float64{2, 4, 6}
+	}
+	if t.Tolerance == 0 {
+		t.Tolerance = 0.3
+	}
+
+	if t.Baseline < 1 {
+		return fmt.Errorf("invalid timing baseline %d", t.Baseline)
+	}
+	if t.Tolerance < 0 || t.Tolerance >= 1 {
+		return fmt.Errorf("invalid timing tolerance %v, must be between 0 and 1", t.Tolerance)
+	}
+	distinct := make(map[float64]struct{})
+	for _, delay := range t.Delays {
+		if delay <= 0 {
+			return fmt.Errorf("invalid timing delay %v", delay)
+		}
+		distinct[delay] = struct{}{}
+	}
+	if len(distinct) < 2 {
+		return fmt.Errorf("timing needs at least two distinct delays")
+	}
+	return nil
+}
+
+// requests returns the number of requests sent per generated request.
+func (t *TimingAnalysis) requests() int {
+	return t.Baseline + len(t.Delays)
+}
+
+// withDelay returns dynamicValues with the delay bound to the variable.
+func (t *TimingAnalysis) withDelay(dynamicValues map[string]interface{}, delay float64) map[string]interface{} {
+	return iutils.MergeMaps(dynamicValues, map[string]interface{}{t.Variable: strconv.FormatFloat(delay, 'f', -1, 64)})
+}
+
+// executeTimingRequest samples the baseline and the delays with requests
+// built by makeRequest, then sends final, built for the last delay, and runs
+// the operators on its response with the statistics.
+func (r *Request) executeTimingRequest(input *protocols.ScanContext, final *generatedRequest, makeRequest func(delay float64) (*generatedRequest, error), previousEvent map[string]interface{}, callback protocols.OutputEventCallback, reqcount int) error {
+	timing := r.Timing
+	measure := func(delay float64) (float64, error) {
+		request, err := makeRequest(delay)
+		if err != nil {
+			return 0, err
+		}
+		resp, _, duration, err := r.sendRequest(input, r.withTimingContext(request, delay))
+		if err != nil {
+			return 0, err
+		}
+		// drain the body so that the connection is reused for the next sample
+		_, _ = readResponseBody(resp)
+		return duration.Seconds(), nil
+	}
+
+	stats := &timingStats{delays: timing.Delays}
+	for i := 0; i < timing.Baseline; i++ {
+		latency, err := measure(0)
+		if err != nil {
+			return err
+		}
+		stats.baseline = append(stats.baseline, latency)
+	}
+	last := len(timing.Delays) - 1
+	for _, delay := range timing.Delays[:last] {
+		latency, err := measure(delay)
+		if err != nil {
+			return err
+		}
+		stats.samples = append(stats.samples, latency)
+	}
+
+	resp, reqBody, duration, err := r.sendRequest(input, r.withTimingContext(final, timing.Delays[last]))
+	if err != nil {
+		return err
+	}
+	stats.samples = append(stats.samples, duration.Seconds())
+	final.dynamicValues = iutils.MergeMaps(final.dynamicValues, stats.event(timing.Tolerance))
+	return r.handleResponse(input, final, resp, reqBody, duration, previousEvent, callback, reqcount)
+}
+
+// withTimingContext gives request the request timeout on top of its delay, so
+// the delayed requests do not time out.
+func (r *Request) withTimingContext(request *generatedRequest, delay float64) *generatedRequest {
+	timeout := time.Duration(delay * float64(time.Second))
+	if r.options != nil {
+		timeout += time.Duration(r.options.Options.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	go func() { <-ctx.Done(); cancel() }()
+	request.request = request.request.WithContext(ctx)
+	return request
+}
+
+// timingStats are the latencies of a timing analysis, in seconds.
+type timingStats struct {
+	baseline []float64
+	delays   []float64
+	samples  []float64
+}
+
+// event returns the statistics as event values, see operators.TimingDSLKeys.
+func (s *timingStats) event(tolerance float64) map[string]interface{} {
+	mean, stddev := meanStddev(s.baseline)
+	slope, intercept, correlation := linearFit(s.delays, s.samples)
+	return map[string]interface{}{
+		operators.TimingBaseline:       s.baseline,
+		operators.TimingBaselineMean:   mean,
+		operators.TimingBaselineStddev: stddev,
+		operators.TimingDelays:         s.delays,
+		operators.TimingSamples:        s.samples,
+		operators.TimingSlope:          slope,
+		operators.TimingIntercept:      intercept,
+		operators.TimingCorrelation:    correlation,
+		operators.TimingTolerance:      tolerance,
+	}
+}
+
+func meanStddev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+	var variance float64
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+// linearFit fits y = slope*x + intercept by least squares and returns the
+// Pearson correlation of x and y, 0 when either does not vary.
+func linearFit(x, y []float64) (slope, intercept, correlation float64) {
+	meanX, stddevX := meanStddev(x)
+	meanY, stddevY := meanStddev(y)
+	var covariance float64
+	for i := range x {
+		covariance += (x[i] - meanX) * (y[i] - meanY)
+	}
+	covariance /= float64(len(x))
+	if stddevX == 0 {
+		return 0, meanY, 0
+	}
+	slope = covariance / (stddevX * stddevX)
+	intercept = meanY - slope*meanX
+	if stddevY != 0 {
+		correlation = covariance / (stddevX * stddevY)
+	}
+	return slope, intercept, correlation
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chainreactors/neutron/operators"
+	"github.com/chainreactors/neutron/protocols"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimingAnalysis(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/vulnerable":
+			delay, _ := strconv.ParseFloat(r.URL.Query().Get("sleep"), 64)
+			time.Sleep(time.Duration(delay * float64(time.Second)))
+		case "/slow":
+			time.Sleep(350 * time.Millisecond)
+		}
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	execute := func(path string) *protocols.InternalWrappedEvent {
+		r := &Request{
+			Path:   []string{"{{BaseURL}}" + path + "?sleep={{delay}}"},
+			Method: "GET",
+			Timing: &TimingAnalysis{Baseline: 2, Delays: []float64{0.1, 0.2, 0.3}},
+		}
+		r.Matchers = append(r.Matchers, &operators.Matcher{Type: "timing"})
+		require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{Timeout: 5}}))
+		require.Equal(t, 5, r.Requests())
+
+		var captured *protocols.InternalWrappedEvent
+		input := protocols.NewScanContext(server.URL, nil)
+		input.TraceAll = true
+		require.NoError(t, r.ExecuteWithResults(input, map[string]interface{}{}, map[string]interface{}{}, func(event *protocols.InternalWrappedEvent) {
+			captured = event
+		}))
+		require.NotNil(t, captured)
+		return captured
+	}
+
+	event := execute("/vulnerable")
+	require.EqualValues(t, 5, atomic.LoadInt32(&requests))
+	require.NotNil(t, event.OperatorsResult)
+	require.True(t, event.OperatorsResult.Matched)
+	require.Equal(t, "0.3", event.InternalEvent["delay"])
+	require.Len(t, event.InternalEvent[operators.TimingBaseline], 2)
+	require.Equal(t, []float64{0.1, 0.2, 0.3}, event.InternalEvent[operators.TimingDelays])
+	require.InDelta(t, 1, event.InternalEvent[operators.TimingSlope], 0.3)
+	require.Contains(t, event.Results[0].Metadata, operators.TimingCorrelation)
+
+	event = execute("/fast")
+	require.True(t, event.OperatorsResult == nil || !event.OperatorsResult.Matched)
+	require.InDelta(t, 0, event.InternalEvent[operators.TimingSlope], 0.3)
+
+	event = execute("/slow")
+	require.True(t, event.OperatorsResult == nil || !event.OperatorsResult.Matched)
+}
+
+func TestTimingAnalysisCompile(t *testing.T) {
+	r := &Request{Path: []string{"{{BaseURL}}"}}
+	r.Matchers = append(r.Matchers, &operators.Matcher{Type: "timing"})
+	require.Equal(t, errTimingMatcher, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{Timeout: 5}}))
+
+	timing := &TimingAnalysis{}
+	require.NoError(t, timing.compile())
+	require.Equal(t, &TimingAnalysis{Variable: "delay", Baseline: 3, Delays: []float64{2, 4, 6}, Tolerance: 0.3}, timing)
+
+	for _, timing := range []*TimingAnalysis{
+		{Delays: []float64{2, 2}},
+		{Delays: []float64{0, 2}},
+		{Baseline: -1},
+		{Tolerance: 1.5},
+	} {
+		require.Error(t, timing.compile())
+	}
+}
+
+func TestLinearFit(t *testing.T) {
+	slope, intercept, correlation := linearFit([]float64{2, 4, 6}, []float64{2.1, 4.1, 6.1})
+	require.InDelta(t, 1, slope, 1e-9)
+	require.InDelta(t, 0.1, intercept, 1e-9)
+	require.InDelta(t, 1, correlation, 1e-9)
+
+	slope, intercept, correlation = linearFit([]float64{2, 4, 6}, []float64{0.5, 0.5, 0.5})
+	require.Equal(t, float64(0), slope)
+	require.InDelta(t, 0.5, intercept, 1e-9)
+	require.Equal(t, float64(0), correlation)
+}
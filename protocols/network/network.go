@@ -1,10 +1,18 @@
 package network
 
 import (
-	"github.com/chainreactors/neutron/operators"
-	protocols "github.com/chainreactors/neutron/protocols"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
 	"net"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/chainreactors/neutron/common/tlsx"
+	"github.com/chainreactors/neutron/operators"
+	protocols "github.com/chainreactors/neutron/protocols"
 )
 
 // Request contains a Network protocol request to be made from a template
@@ -12,13 +20,24 @@ type Request struct {
 	ID string `json:"id,omitempty" yaml:"id,omitempty"`
 
 	// Address is the address to send requests to (host:port:tls combos generally)
-	Address   []string `json:"host,omitempty" yaml:"host,omitempty"`
+	Address   []string    `json:"host,omitempty" yaml:"host,omitempty"`
 	addresses []addressKV `json:"-" yaml:"-" jsonschema:"-"`
 
+	// Port lists the ports to probe when the input has no port, e.g.
+	// `22,2222` or `8000-8010`. Each port produces its own event.
+	Port Ports `json:"port,omitempty" yaml:"port,omitempty"`
+	// ExcludePorts lists ports that are never probed, even when the input
+	// carries them explicitly.
+	ExcludePorts  Ports               `json:"exclude-ports,omitempty" yaml:"exclude-ports,omitempty"`
+	ports         []string            `json:"-" yaml:"-" jsonschema:"-"`
+	excludedPorts map[string]struct{} `json:"-" yaml:"-" jsonschema:"-"`
+
 	// AttackType is the attack type
-	// Sniper, PitchFork and ClusterBomb. Default is Sniper
+	// Sniper, PitchFork, ClusterBomb and BatteringRam. Default is Sniper
 	AttackType string `json:"attack,omitempty" yaml:"attack,omitempty"`
-	// Path contains the path/s for the request variables
+	// Payloads contains the values of the request variables, by name: a
+	// list, a file of the template catalog or a generator, see
+	// protocols.NewGenerator
 	Payloads map[string]interface{} `json:"payloads,omitempty" yaml:"payloads,omitempty"`
 
 	// Payload is the payload to send for the network request
@@ -28,10 +47,35 @@ type Request struct {
 
 	ReadAll bool `json:"read-all,omitempty" yaml:"read-all,omitempty"`
 
+	// SNI, MinVersion, ALPN, ClientCert/ClientKey and Verify configure the
+	// handshake of tls:// addresses. SNI defaults to the target host and may
+	// use template variables; ClientCert/ClientKey take inline PEM or a file
+	// path, resolved through the catalog of the template like payload files
+	// (the key may live in the ClientCert PEM). Verification is off unless
+	// Verify is set.
+	SNI        string   `json:"sni,omitempty" yaml:"sni,omitempty"`
+	MinVersion string   `json:"min_version,omitempty" yaml:"min_version,omitempty"`
+	ALPN       []string `json:"alpn,omitempty" yaml:"alpn,omitempty"`
+	ClientCert string   `json:"client_cert,omitempty" yaml:"client_cert,omitempty"`
+	ClientKey  string   `json:"client_key,omitempty" yaml:"client_key,omitempty"`
+	Verify     bool     `json:"verify,omitempty" yaml:"verify,omitempty"`
+
+	// ReqCondition numbers the exchanges of the template and exposes each
+	// one's fields as `<field>_<index>` (data_1, data_2) to later matchers.
+	// It is enabled implicitly when operators reference such fields.
+	ReqCondition bool `json:"req-condition,omitempty" yaml:"req-condition,omitempty"`
+
+	// DetectService fingerprints the response against the probe catalog and
+	// exposes service, product and version to matchers and as extract events.
+	// Without inputs, the catalog probes are tried in turn until one matches,
+	// or the service sends a banner; data is then the first response read.
+	DetectService bool `json:"detect-service,omitempty" yaml:"detect-service,omitempty"`
+
 	operators.Operators `json:",inline,omitempty" yaml:",inline,omitempty"`
 	// Operators for the current request go here.
 	CompiledOperators *operators.Operators `json:"-" yaml:"-" jsonschema:"-"`
 	dialer            *net.Dialer          `json:"-" yaml:"-" jsonschema:"-"`
+	tlsConfig         *tls.Config          `json:"-" yaml:"-" jsonschema:"-"`
 	generator         *protocols.Generator `json:"-" yaml:"-" jsonschema:"-"`
 	attackType        protocols.Type       `json:"-" yaml:"-" jsonschema:"-"`
 	// cache any variables that may be needed for operation.
@@ -54,6 +98,58 @@ type Input struct {
 	Read int `json:"read,omitempty"`
 	// Name is the optional name of the input to provide matching on
 	Name string `json:"name,omitempty"`
+	// Probe sends the payload of a named catalog probe instead of Data.
+	Probe string `json:"probe,omitempty"`
+	// ReadUntil keeps reading until the delimiter is received, Read bytes
+	// (when set) have been read or the read times out.
+	ReadUntil string `json:"read-until,omitempty" yaml:"read-until,omitempty"`
+	// ReadUntilType is the encoding of ReadUntil - text, hex or regex.
+	ReadUntilType string `json:"read-until-type,omitempty" yaml:"read-until-type,omitempty"`
+	// ReadTimeout bounds the read of this input, e.g. 500ms or 3 (seconds).
+	ReadTimeout string `json:"read-timeout,omitempty" yaml:"read-timeout,omitempty"`
+
+	probe       *Probe
+	until       []byte
+	untilRegex  *regexp.Regexp
+	readTimeout time.Duration
+}
+
+// compile resolves the probe, the read-until delimiter and the read timeout.
+func (input *Input) compile() error {
+	var err error
+	if input.Probe != "" {
+		if input.probe, err = GetProbe(input.Probe); err != nil {
+			return err
+		}
+	}
+	if input.ReadUntil != "" {
+		switch strings.ToLower(input.ReadUntilType) {
+		case "", "text":
+			input.until = []byte(input.ReadUntil)
+		case "hex":
+			if input.until, err = hex.DecodeString(input.ReadUntil); err != nil {
+				return fmt.Errorf("invalid read-until hex %q: %v", input.ReadUntil, err)
+			}
+		case "regex":
+			if input.untilRegex, err = regexp.Compile(input.ReadUntil); err != nil {
+				return fmt.Errorf("invalid read-until regex %q: %v", input.ReadUntil, err)
+			}
+		default:
+			return fmt.Errorf("unknown read-until-type %q", input.ReadUntilType)
+		}
+	}
+	if input.ReadTimeout != "" {
+		if seconds, convErr := strconv.Atoi(input.ReadTimeout); convErr == nil {
+			input.readTimeout = time.Duration(seconds) * time.Second
+		} else if input.readTimeout, err = time.ParseDuration(input.ReadTimeout); err != nil {
+			return fmt.Errorf("invalid read-timeout %q: %v", input.ReadTimeout, err)
+		}
+	}
+	return nil
+}
+
+func (input *Input) hasReadUntil() bool {
+	return input.until != nil || input.untilRegex != nil
 }
 
 // GetID returns the unique ID of the request if any.
@@ -63,10 +159,13 @@ func (r *Request) GetID() string {
 
 // Compile compiles the protocol request for further execution.
 func (r *Request) Compile(options *protocols.ExecuterOptions) error {
-	var shouldUseTLS bool
 	var err error
 	r.options = options
+	if r.ports, r.excludedPorts, err = parsePorts(r.Port, r.ExcludePorts); err != nil {
+		return err
+	}
 	for _, address := range r.Address {
+		var shouldUseTLS bool
 		// check if the connection should be encrypted
 		if strings.HasPrefix(address, "tls://") {
 			shouldUseTLS = true
@@ -74,10 +173,21 @@ func (r *Request) Compile(options *protocols.ExecuterOptions) error {
 		}
 		r.addresses = append(r.addresses, addressKV{address: address, tls: shouldUseTLS})
 	}
+	for _, kv := range r.addresses {
+		if kv.tls {
+			if err = r.compileTLS(); err != nil {
+				return err
+			}
+			break
+		}
+	}
 	// Pre-compile any input dsl functions before executing the request.
-	for _, input := range r.Inputs {
-		if input.Type != "" {
-			continue
+	for i, input := range r.Inputs {
+		if input == nil {
+			return fmt.Errorf("network input at index %d is nil", i)
+		}
+		if err = input.compile(); err != nil {
+			return err
 		}
 	}
 
@@ -89,17 +199,11 @@ func (r *Request) Compile(options *protocols.ExecuterOptions) error {
 		r.attackType = protocols.StringToType[attackType]
 
 		// Resolve payload paths if they are files.
-		//for name, payload := range r.Payloads {
-		//	payloadStr, ok := payload.(string)
-		//	if ok {
-		//		final, resolveErr := options.Catalog.ResolvePath(payloadStr, options.TemplatePath)
-		//		if resolveErr != nil {
-		//			return err
-		//		}
-		//		r.Payloads[name] = final
-		//	}
-		//}
-		r.generator, err = protocols.NewGenerator(r.Payloads, r.attackType)
+		payloads, err := options.ResolvePayloads(r.Payloads)
+		if err != nil {
+			return err
+		}
+		r.generator, err = protocols.NewGenerator(payloads, r.attackType)
 		if err != nil {
 			return err
 		}
@@ -125,5 +229,73 @@ func (r *Request) Compile(options *protocols.ExecuterOptions) error {
 
 // Requests returns the total number of requests the YAML rule will perform
 func (r *Request) Requests() int {
-	return len(r.Address)
+	return r.ScanRequests(nil)
+}
+
+// ScanRequests returns the number of requests for input, whose payloads
+// replace the payloads of the template.
+func (r *Request) ScanRequests(input *protocols.ScanContext) int {
+	count := len(r.Address)
+	if len(r.ports) > 0 {
+		count *= len(r.ports)
+	}
+	generator := r.generator
+	if input != nil && input.Payloads != nil {
+		var err error
+		if generator, err = protocols.NewGenerator(input.Payloads, r.attackType); err != nil {
+			return 0
+		}
+	}
+	if generator != nil {
+		count *= generator.NewIterator().Total()
+	}
+	return count
+}
+
+// NeedsRequestCondition determines if request condition should be enabled
+func (r *Request) NeedsRequestCondition() bool {
+	return r.ReqCondition || protocols.NeedsRequestCondition(&r.Operators)
+}
+
+// responseDSLKeys are the fields every network response may define, next to
+// the named inputs and the certificate fields of tls:// addresses.
+var responseDSLKeys = []string{
+	"data", "matched", "host", "port", "alpn", "service", "product", "version",
+}
+
+// ResponseDSLScope extends scope with the fields of the responses, which the
+// matchers and extractors can reference.
+func (r *Request) ResponseDSLScope(scope *protocols.DSLScope) *protocols.DSLScope {
+	names := append(append([]string{}, responseDSLKeys...), tlsx.CertDSLKeys...)
+	for _, input := range r.Inputs {
+		if input != nil && input.Name != "" {
+			names = append(names, input.Name)
+		}
+	}
+	return scope.With(nil, names...)
+}
+
+// CheckDSL statically checks the placeholders and dsl operators of the
+// request; field is its template path, e.g. network[0].
+func (r *Request) CheckDSL(field string, scope *protocols.DSLScope) error {
+	names := make([]string, 0, len(r.Payloads))
+	for name := range r.Payloads {
+		names = append(names, name)
+	}
+	scope = scope.With(nil, names...)
+
+	for i, address := range r.Address {
+		if err := protocols.CheckPlaceholders(fmt.Sprintf("%s.host[%d]", field, i), address, scope); err != nil {
+			return err
+		}
+	}
+	for i, input := range r.Inputs {
+		if input == nil || input.Type == "hex" {
+			continue
+		}
+		if err := protocols.CheckPlaceholders(fmt.Sprintf("%s.inputs[%d].data", field, i), input.Data, scope); err != nil {
+			return err
+		}
+	}
+	return protocols.CheckOperators(field, &r.Operators, r.ResponseDSLScope(scope))
 }
@@ -0,0 +1,153 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Ports is a port specification. It accepts nuclei's comma separated form
+// (`port: 22,2222,8000-8010`) as well as a YAML/JSON list of ports and ranges.
+// An entry prefixed with `!` excludes that port or range.
+type Ports []string
+
+// UnmarshalYAML accepts a scalar or a sequence of scalars.
+func (p *Ports) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*p = splitPorts(list...)
+		return nil
+	}
+	var single string
+	if err := unmarshal(&single); err != nil {
+		return err
+	}
+	*p = splitPorts(single)
+	return nil
+}
+
+// UnmarshalJSON accepts a string, a number or a list of either.
+func (p *Ports) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case nil:
+		*p = nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		*p = splitPorts(list...)
+	default:
+		*p = splitPorts(fmt.Sprint(v))
+	}
+	return nil
+}
+
+func splitPorts(values ...string) Ports {
+	var ports Ports
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				ports = append(ports, item)
+			}
+		}
+	}
+	return ports
+}
+
+// parsePorts expands ranges, drops duplicates and removes both `!` entries and
+// the exclude list. The returned slice keeps declaration order.
+func parsePorts(include, exclude Ports) ([]string, map[string]struct{}, error) {
+	excluded := make(map[string]struct{})
+	var candidates []string
+	for _, item := range include {
+		if strings.HasPrefix(item, "!") {
+			if err := expandPortRange(strings.TrimPrefix(item, "!"), func(port string) { excluded[port] = struct{}{} }); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err := expandPortRange(item, func(port string) { candidates = append(candidates, port) }); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, item := range exclude {
+		if err := expandPortRange(strings.TrimPrefix(item, "!"), func(port string) { excluded[port] = struct{}{} }); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	seen := make(map[string]struct{}, len(candidates))
+	ports := make([]string, 0, len(candidates))
+	for _, port := range candidates {
+		if _, ok := excluded[port]; ok {
+			continue
+		}
+		if _, ok := seen[port]; ok {
+			continue
+		}
+		seen[port] = struct{}{}
+		ports = append(ports, port)
+	}
+	return ports, excluded, nil
+}
+
+func expandPortRange(item string, yield func(port string)) error {
+	item = strings.TrimSpace(item)
+	start, end := item, item
+	if i := strings.Index(item, "-"); i >= 0 {
+		start, end = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+	}
+	from, err := parsePortNumber(start)
+	if err != nil {
+		return fmt.Errorf("invalid port %q: %v", item, err)
+	}
+	to, err := parsePortNumber(end)
+	if err != nil {
+		return fmt.Errorf("invalid port %q: %v", item, err)
+	}
+	if from > to {
+		return fmt.Errorf("invalid port range %q", item)
+	}
+	for port := from; port <= to; port++ {
+		yield(strconv.Itoa(port))
+	}
+	return nil
+}
+
+func parsePortNumber(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port out of range")
+	}
+	return port, nil
+}
+
+// expandTargets applies the template ports to an input without a port. An
+// input that already carries a port is used as-is unless that port is excluded.
+func (r *Request) expandTargets(address string) []string {
+	if host, port, err := net.SplitHostPort(address); err == nil && host != "" {
+		if _, ok := r.excludedPorts[port]; ok {
+			return nil
+		}
+		return []string{address}
+	}
+	if len(r.ports) == 0 {
+		return []string{address}
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	targets := make([]string, 0, len(r.ports))
+	for _, port := range r.ports {
+		targets = append(targets, net.JoinHostPort(host, port))
+	}
+	return targets
+}
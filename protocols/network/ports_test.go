@@ -0,0 +1,122 @@
+package network
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/chainreactors/neutron/operators"
+	"github.com/chainreactors/neutron/protocols"
+	"github.com/chainreactors/utils/iutils"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParsePorts(t *testing.T) {
+	ports, excluded, err := parsePorts(Ports{"22", "8000-8003", "!8001", "22"}, Ports{"8003"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"22", "8000", "8002"}, ports)
+	require.Contains(t, excluded, "8001")
+	require.Contains(t, excluded, "8003")
+
+	_, _, err = parsePorts(Ports{"70000"}, nil)
+	require.Error(t, err)
+	_, _, err = parsePorts(Ports{"90-80"}, nil)
+	require.Error(t, err)
+}
+
+func TestPortsUnmarshal(t *testing.T) {
+	var r Request
+	require.NoError(t, yaml.Unmarshal([]byte("port: 22,2222\nexclude-ports: 2222\n"), &r))
+	require.Equal(t, Ports{"22", "2222"}, r.Port)
+	require.Equal(t, Ports{"2222"}, r.ExcludePorts)
+
+	require.NoError(t, yaml.Unmarshal([]byte("port: [80, 8000-8080]\n"), &r))
+	require.Equal(t, Ports{"80", "8000-8080"}, r.Port)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"port": 6379}`), &r))
+	require.Equal(t, Ports{"6379"}, r.Port)
+}
+
+func TestExpandTargets(t *testing.T) {
+	r := &Request{Port: Ports{"22", "2222"}, ExcludePorts: Ports{"23"}}
+	require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{}}))
+
+	require.Equal(t, []string{"10.0.0.1:22", "10.0.0.1:2222"}, r.expandTargets("10.0.0.1"))
+	require.Equal(t, []string{"[::1]:22", "[::1]:2222"}, r.expandTargets("::1"))
+	require.Equal(t, []string{"10.0.0.1:8080"}, r.expandTargets("10.0.0.1:8080"))
+	require.Empty(t, r.expandTargets("10.0.0.1:23"))
+}
+
+func TestExecuteEmitsEventPerPort(t *testing.T) {
+	var ports []string
+	for _, banner := range []string{"alpha", "beta"} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+		go func(ln net.Listener, banner string) {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				conn.Write([]byte(banner))
+				conn.Close()
+			}
+		}(ln, banner)
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		ports = append(ports, port)
+	}
+
+	r := &Request{Address: []string{"{{Hostname}}"}, Port: Ports(ports)}
+	r.Operators = operators.Operators{Matchers: []*operators.Matcher{{Type: "dsl", DSL: []string{`len(data) > 0 && port != ""`}}}}
+	require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{}}))
+
+	var seen []string
+	err := r.ExecuteWithResults(protocols.NewScanContext("127.0.0.1", nil), map[string]interface{}{}, map[string]interface{}{}, func(e *protocols.InternalWrappedEvent) {
+		if e.OperatorsResult != nil && e.OperatorsResult.Matched {
+			seen = append(seen, iutils.ToString(e.InternalEvent["port"])+"="+iutils.ToString(e.InternalEvent["data"]))
+		}
+	})
+	require.NoError(t, err)
+	expected := []string{ports[0] + "=alpha", ports[1] + "=beta"}
+	sort.Strings(expected)
+	sort.Strings(seen)
+	require.Equal(t, expected, seen)
+}
+
+func TestExecuteWithScanPayloads(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 64)
+			n, _ := conn.Read(buf)
+			conn.Write(buf[:n])
+			conn.Close()
+		}
+	}()
+
+	r := &Request{Address: []string{"{{Hostname}}"}, Inputs: []*Input{{Data: "{{user}}"}}}
+	r.Operators = operators.Operators{Matchers: []*operators.Matcher{{Type: "dsl", DSL: []string{`len(data) > 0`}}}}
+	require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{}}))
+
+	var seen []string
+	input := protocols.NewScanContext(ln.Addr().String(), map[string]interface{}{"user": []string{"root", "admin"}})
+	err = r.ExecuteWithResults(input, map[string]interface{}{}, map[string]interface{}{}, func(e *protocols.InternalWrappedEvent) {
+		if e.OperatorsResult != nil && e.OperatorsResult.Matched {
+			seen = append(seen, iutils.ToString(e.InternalEvent["data"]))
+		}
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"root", "admin"}, seen)
+	// the payloads of the scan are counted for the request index offset
+	require.Equal(t, 1, r.Requests())
+	require.Equal(t, 2, protocols.ScanRequests(r, input))
+}
@@ -0,0 +1,224 @@
+package network
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Probe is a named service probe, modeled after nmap-service-probes. Data is
+// written verbatim on connect (the NULL probe writes nothing and only waits for
+// a banner); Matches are tried in order against whatever the service answers.
+type Probe struct {
+	// Name identifies the probe in templates, e.g. `inputs: [{probe: redis}]`.
+	// Lookups are case-insensitive.
+	Name string
+	// Data is the raw payload sent to the service. Empty for banner probes.
+	Data []byte
+	// Matches are the fingerprint rules applied to the probe response.
+	Matches []*ProbeMatch
+}
+
+// ProbeMatch is a single fingerprint rule. Pattern is matched against the
+// response with every byte mapped to the rune of the same value, so `\xff` in
+// a pattern matches the byte 0xff exactly as in nmap-service-probes. Product
+// and Version may reference capture groups with $1, ${2}, ...
+type ProbeMatch struct {
+	Service string
+	Pattern string
+	Product string
+	Version string
+
+	re *regexp.Regexp
+}
+
+// Fingerprint is the service identification produced by a ProbeMatch.
+type Fingerprint struct {
+	Probe   string
+	Service string
+	Product string
+	Version string
+}
+
+// probes holds the registered probes in registration order. Like the
+// operators registrar, registration is expected from init() only.
+var (
+	probes      []*Probe
+	probesIndex = map[string]*Probe{}
+)
+
+// RegisterProbe adds a probe to the catalog, replacing any probe with the same
+// name. It panics on an invalid match pattern, since the catalog is static.
+func RegisterProbe(probe *Probe) {
+	for _, m := range probe.Matches {
+		if m.re == nil {
+			m.re = regexp.MustCompile(m.Pattern)
+		}
+	}
+	key := strings.ToLower(probe.Name)
+	if old, ok := probesIndex[key]; ok {
+		for i, p := range probes {
+			if p == old {
+				probes[i] = probe
+			}
+		}
+	} else {
+		probes = append(probes, probe)
+	}
+	probesIndex[key] = probe
+}
+
+// GetProbe returns the registered probe with the given name.
+func GetProbe(name string) (*Probe, error) {
+	probe, ok := probesIndex[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown network probe %q", name)
+	}
+	return probe, nil
+}
+
+// Probes returns the registered probes in registration order.
+func Probes() []*Probe {
+	return append([]*Probe(nil), probes...)
+}
+
+// Match runs the probe's rules against a response and returns the first hit.
+func (p *Probe) Match(data []byte) *Fingerprint {
+	if len(data) == 0 {
+		return nil
+	}
+	corpus := latin1(data)
+	for _, m := range p.Matches {
+		if fp := m.match(corpus); fp != nil {
+			fp.Probe = p.Name
+			return fp
+		}
+	}
+	return nil
+}
+
+func (m *ProbeMatch) match(corpus string) *Fingerprint {
+	idx := m.re.FindStringSubmatchIndex(corpus)
+	if idx == nil {
+		return nil
+	}
+	expand := func(tmpl string) string {
+		if tmpl == "" {
+			return ""
+		}
+		return strings.TrimSpace(string(m.re.ExpandString(nil, tmpl, corpus, idx)))
+	}
+	return &Fingerprint{
+		Service: m.Service,
+		Product: expand(m.Product),
+		Version: expand(m.Version),
+	}
+}
+
+// MatchService fingerprints a response. The preferred probes (normally the
+// ones that produced the response) are tried first, then the rest of the
+// catalog, since a banner often answers any probe.
+func MatchService(data []byte, preferred ...string) *Fingerprint {
+	tried := make(map[*Probe]struct{}, len(probes))
+	for _, name := range preferred {
+		probe, ok := probesIndex[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		tried[probe] = struct{}{}
+		if fp := probe.Match(data); fp != nil {
+			return fp
+		}
+	}
+	for _, probe := range probes {
+		if _, ok := tried[probe]; ok {
+			continue
+		}
+		if fp := probe.Match(data); fp != nil {
+			return fp
+		}
+	}
+	return nil
+}
+
+// latin1 maps each byte to the rune with the same value so regexp can address
+// binary responses byte by byte.
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+var mysqlMatches = []*ProbeMatch{
+	{Service: "mysql", Pattern: `(?s)^...\x00\x0a(?:5\.5\.5-)?([\d.]+)-MariaDB`, Product: "MariaDB", Version: "$1"},
+	{Service: "mysql", Pattern: `(?s)^...\x00\x0a([\d.]+[\w.-]*)\x00`, Product: "MySQL", Version: "$1"},
+	{Service: "mysql", Pattern: `(?s)^...\x00\xff..Host .* is not allowed to connect to this (MySQL|MariaDB) server`, Product: "$1"},
+}
+
+func init() {
+	RegisterProbe(&Probe{
+		Name: "NULL",
+		Matches: append([]*ProbeMatch{
+			{Service: "ssh", Pattern: `^SSH-([\d.]+)-OpenSSH_([\w.-]+)`, Product: "OpenSSH", Version: "$2"},
+			{Service: "ssh", Pattern: `^SSH-([\d.]+)-([^\s\r\n]+)`, Product: "$2"},
+			{Service: "ftp", Pattern: `^220 \(vsFTPd ([\w.-]+)\)`, Product: "vsftpd", Version: "$1"},
+			{Service: "ftp", Pattern: `^220[ -]ProFTPD ([\w.-]+)`, Product: "ProFTPD", Version: "$1"},
+			{Service: "ftp", Pattern: `^220[ -][^\r\n]*FileZilla Server(?: version)? ?([\w.-]*)`, Product: "FileZilla ftpd", Version: "$1"},
+			{Service: "ftp", Pattern: `(?i)^220[ -][^\r\n]*ftp`},
+			{Service: "smtp", Pattern: `^220[ -]([\w.-]+) ESMTP Postfix`, Product: "Postfix smtpd"},
+			{Service: "smtp", Pattern: `^220[ -]([\w.-]+) ESMTP Exim ([\w.]+)`, Product: "Exim smtpd", Version: "$2"},
+			{Service: "smtp", Pattern: `(?i)^220[ -][^\r\n]*smtp`},
+			{Service: "pop3", Pattern: `^\+OK`},
+			{Service: "imap", Pattern: `^\* OK`},
+			{Service: "vnc", Pattern: `^RFB (\d{3}\.\d{3})\n`, Product: "VNC", Version: "$1"},
+		}, mysqlMatches...),
+	})
+	RegisterProbe(&Probe{
+		Name: "GetRequest",
+		Data: []byte("GET / HTTP/1.0\r\n\r\n"),
+		Matches: []*ProbeMatch{
+			{Service: "http", Pattern: `(?s)^HTTP/1\.[01] \d\d\d.*?\r\nServer: nginx/?([\d.]*)`, Product: "nginx", Version: "$1"},
+			{Service: "http", Pattern: `(?s)^HTTP/1\.[01] \d\d\d.*?\r\nServer: Apache/?([\d.]*)`, Product: "Apache httpd", Version: "$1"},
+			{Service: "http", Pattern: `(?s)^HTTP/1\.[01] \d\d\d.*?\r\nServer: Microsoft-IIS/([\d.]+)`, Product: "Microsoft IIS httpd", Version: "$1"},
+			{Service: "http", Pattern: `(?s)^HTTP/1\.[01] \d\d\d.*?\r\nServer: ([^\r\n]+)`, Product: "$1"},
+			{Service: "http", Pattern: `^HTTP/1\.[01] \d\d\d`},
+		},
+	})
+	RegisterProbe(&Probe{
+		Name: "Redis",
+		Data: []byte("*1\r\n$4\r\nPING\r\n"),
+		Matches: []*ProbeMatch{
+			{Service: "redis", Pattern: `^\+PONG\r\n`, Product: "Redis key-value store"},
+			{Service: "redis", Pattern: `^-NOAUTH `, Product: "Redis key-value store"},
+			{Service: "redis", Pattern: `^-DENIED Redis`, Product: "Redis key-value store"},
+		},
+	})
+	RegisterProbe(&Probe{
+		Name:    "MySQL",
+		Matches: mysqlMatches,
+	})
+	RegisterProbe(&Probe{
+		// TPKT + X.224 connection request carrying an RDP negotiation request,
+		// identical to nmap's TerminalServerCookie probe.
+		Name: "RDP",
+		Data: []byte("\x03\x00\x00\x2a\x25\xe0\x00\x00\x00\x00\x00Cookie: mstshash=nmap\r\n\x01\x00\x08\x00\x03\x00\x00\x00"),
+		Matches: []*ProbeMatch{
+			{Service: "ms-wbt-server", Pattern: `(?s)^\x03\x00\x00[\x0b\x13]\x0e\xd0`, Product: "Microsoft Terminal Services"},
+		},
+	})
+	RegisterProbe(&Probe{
+		// SMB1 negotiate offering NT LM 0.12 and the SMB2 dialects, so both
+		// SMB1-only and SMB2+ servers answer.
+		Name: "SMB",
+		Data: []byte("\x00\x00\x00\x47" +
+			"\xffSMB\x72\x00\x00\x00\x00\x18\x01\x28\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x2f\x4b\x00\x00\xc5\x5e" +
+			"\x00\x24\x00" +
+			"\x02NT LM 0.12\x00\x02SMB 2.002\x00\x02SMB 2.???\x00"),
+		Matches: []*ProbeMatch{
+			{Service: "microsoft-ds", Pattern: `(?s)^\x00...\xfeSMB`, Product: "SMB", Version: "2+"},
+			{Service: "microsoft-ds", Pattern: `(?s)^\x00...\xffSMBr`, Product: "SMB", Version: "1"},
+		},
+	})
+}
@@ -0,0 +1,153 @@
+package network
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chainreactors/neutron/operators"
+	"github.com/chainreactors/neutron/protocols"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchServiceBanners(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		probe    string
+		expected Fingerprint
+	}{
+		{"openssh", "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3\r\n", "NULL", Fingerprint{Probe: "NULL", Service: "ssh", Product: "OpenSSH", Version: "8.9p1"}},
+		{"vsftpd", "220 (vsFTPd 3.0.3)\r\n", "NULL", Fingerprint{Probe: "NULL", Service: "ftp", Product: "vsftpd", Version: "3.0.3"}},
+		{"redis pong", "+PONG\r\n", "redis", Fingerprint{Probe: "Redis", Service: "redis", Product: "Redis key-value store"}},
+		{"nginx", "HTTP/1.1 200 OK\r\nDate: x\r\nServer: nginx/1.24.0\r\n\r\n", "GetRequest", Fingerprint{Probe: "GetRequest", Service: "http", Product: "nginx", Version: "1.24.0"}},
+		{"mysql greeting", "\x4a\x00\x00\x00\x0a8.0.36\x00\x08\x00\x00\x00", "mysql", Fingerprint{Probe: "MySQL", Service: "mysql", Product: "MySQL", Version: "8.0.36"}},
+		{"mariadb greeting", "\x59\x00\x00\x00\x0a5.5.5-10.6.12-MariaDB-log\x00", "mysql", Fingerprint{Probe: "MySQL", Service: "mysql", Product: "MariaDB", Version: "10.6.12"}},
+		{"rdp", "\x03\x00\x00\x13\x0e\xd0\x00\x00\x12\x34\x00\x02\x1f\x08\x00\x02\x00\x00\x00", "rdp", Fingerprint{Probe: "RDP", Service: "ms-wbt-server", Product: "Microsoft Terminal Services"}},
+		{"smb2", "\x00\x00\x00\xf8\xfeSMB\x40\x00", "smb", Fingerprint{Probe: "SMB", Service: "microsoft-ds", Product: "SMB", Version: "2+"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := MatchService([]byte(tt.data), tt.probe)
+			require.NotNil(t, fp)
+			require.Equal(t, tt.expected, *fp)
+		})
+	}
+
+	require.Nil(t, MatchService([]byte("\x00\x01garbage")))
+}
+
+func TestMatchServiceFallsBackToCatalog(t *testing.T) {
+	// a banner read after a redis probe is still recognised through NULL
+	fp := MatchService([]byte("SSH-2.0-dropbear_2022.83\r\n"), "redis")
+	require.NotNil(t, fp)
+	require.Equal(t, "ssh", fp.Service)
+	require.Equal(t, "dropbear_2022.83", fp.Product)
+}
+
+func TestCompileRejectsUnknownProbe(t *testing.T) {
+	r := &Request{Address: []string{"{{Hostname}}"}, Inputs: []*Input{{Probe: "gopher"}}}
+	err := r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unknown network probe "gopher"`)
+}
+
+func TestDetectServiceWithProbeInput(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 64)
+			n, _ := conn.Read(buf)
+			if string(buf[:n]) == "*1\r\n$4\r\nPING\r\n" {
+				conn.Write([]byte("+PONG\r\n"))
+			}
+			conn.Close()
+		}
+	}()
+
+	r := &Request{
+		Address:       []string{"{{Hostname}}"},
+		Inputs:        []*Input{{Probe: "redis"}},
+		DetectService: true,
+	}
+	r.Operators = operators.Operators{Matchers: []*operators.Matcher{
+		{Type: "dsl", DSL: []string{`service == "redis"`}},
+	}}
+	require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{}}))
+
+	var got *operators.Result
+	err = r.ExecuteWithResults(protocols.NewScanContext(ln.Addr().String(), nil), map[string]interface{}{}, map[string]interface{}{}, func(e *protocols.InternalWrappedEvent) {
+		if e.OperatorsResult != nil {
+			got = e.OperatorsResult
+		}
+	})
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	require.True(t, got.Matched)
+	require.Equal(t, []string{"redis"}, got.ExtractsByName()["service"])
+	require.Equal(t, []string{"Redis key-value store"}, got.ExtractsByName()["product"])
+}
+
+// serveProbes accepts connections on a local listener, counting them, and
+// lets handle talk to each one.
+func serveProbes(t *testing.T, handle func(conn net.Conn)) (string, *int32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	var accepted int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			handle(conn)
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), &accepted
+}
+
+func detectService(t *testing.T, address string) map[string]interface{} {
+	r := &Request{Address: []string{"{{Hostname}}"}, DetectService: true}
+	require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{}}))
+	var event map[string]interface{}
+	err := r.ExecuteWithResults(protocols.NewScanContext(address, nil), map[string]interface{}{}, map[string]interface{}{}, func(e *protocols.InternalWrappedEvent) {
+		event = e.InternalEvent
+	})
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	return event
+}
+
+func TestDetectServiceStopsAtBanner(t *testing.T) {
+	address, accepted := serveProbes(t, func(conn net.Conn) {
+		conn.Write([]byte("200 unknown service ready\r\n"))
+	})
+
+	event := detectService(t, address)
+	require.Equal(t, "200 unknown service ready\r\n", event["data"])
+	require.Nil(t, event["service"])
+	require.Equal(t, int32(1), atomic.LoadInt32(accepted))
+}
+
+func TestDetectServiceKeepsFirstResponse(t *testing.T) {
+	// silent on connect, answering every probe with an unknown reply
+	address, _ := serveProbes(t, func(conn net.Conn) {
+		buf := make([]byte, 256)
+		if n, _ := conn.Read(buf); n >= 3 {
+			conn.Write(append([]byte("unknown reply to "), buf[:3]...))
+		}
+	})
+
+	event := detectService(t, address)
+	require.Equal(t, "unknown reply to GET", event["data"])
+	require.Nil(t, event["service"])
+}
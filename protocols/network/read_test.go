@@ -0,0 +1,154 @@
+package network
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chainreactors/neutron/operators"
+	"github.com/chainreactors/neutron/protocols"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputCompileReadUntil(t *testing.T) {
+	input := &Input{ReadUntil: "0d0a", ReadUntilType: "hex", ReadTimeout: "250ms"}
+	require.NoError(t, input.compile())
+	require.Equal(t, []byte("\r\n"), input.until)
+	require.Equal(t, 250*time.Millisecond, input.readTimeout)
+
+	input = &Input{ReadUntil: `(?m)^250 `, ReadUntilType: "regex", ReadTimeout: "3"}
+	require.NoError(t, input.compile())
+	require.True(t, input.untilReached([]byte("250-PIPELINING\r\n250 OK\r\n")))
+	require.False(t, input.untilReached([]byte("250-PIPELINING\r\n")))
+	require.Equal(t, 3*time.Second, input.readTimeout)
+
+	require.Error(t, (&Input{ReadUntil: "zz", ReadUntilType: "hex"}).compile())
+	require.Error(t, (&Input{ReadUntil: "x", ReadUntilType: "binary"}).compile())
+	require.Error(t, (&Input{ReadTimeout: "soon"}).compile())
+}
+
+func TestReadUntilNamedInputs(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("220 mail.example.com ESMTP\r\n"))
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		if line == "EHLO neutron\r\n" {
+			conn.Write([]byte("250-mail.example.com\r\n"))
+			time.Sleep(50 * time.Millisecond)
+			conn.Write([]byte("250-AUTH PLAIN LOGIN\r\n250 OK\r\n"))
+		}
+		// keep the session open like a real server waiting for a command
+		time.Sleep(3 * time.Second)
+	}()
+
+	r := &Request{
+		Address: []string{"{{Hostname}}"},
+		Inputs: []*Input{
+			{Name: "greeting", ReadUntil: "\r\n"},
+			{Name: "ehlo_reply", Data: "EHLO neutron\r\n", ReadUntil: `(?m)^250 [^\r\n]*\r\n`, ReadUntilType: "regex", ReadTimeout: "1s"},
+		},
+	}
+	r.Operators = operators.Operators{
+		MatchersCondition: "and",
+		Matchers: []*operators.Matcher{
+			{Type: "word", Part: "greeting", Words: []string{"ESMTP"}},
+			{Type: "word", Part: "ehlo_reply", Words: []string{"AUTH PLAIN"}},
+			{Type: "dsl", DSL: []string{`!contains(greeting, "AUTH")`}},
+		},
+	}
+	require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{}}))
+
+	start := time.Now()
+	var got *operators.Result
+	err = r.ExecuteWithResults(protocols.NewScanContext(ln.Addr().String(), nil), map[string]interface{}{}, map[string]interface{}{}, func(e *protocols.InternalWrappedEvent) {
+		got = e.OperatorsResult
+	})
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	require.True(t, got.Matched)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestReadTimeoutIsPerInput(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("ready\r\n"))
+		// slower than the read-timeout of the first input
+		time.Sleep(300 * time.Millisecond)
+		conn.Write([]byte("done\r\n"))
+	}()
+
+	r := &Request{
+		Address: []string{"{{Hostname}}"},
+		Inputs: []*Input{
+			{Name: "first", ReadUntil: "\r\n", ReadTimeout: "100ms"},
+			{Name: "second", ReadUntil: "\r\n"},
+		},
+	}
+	r.Operators = operators.Operators{
+		Matchers: []*operators.Matcher{{Type: "word", Part: "second", Words: []string{"done"}}},
+	}
+	require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{}}))
+
+	var got *operators.Result
+	err = r.ExecuteWithResults(protocols.NewScanContext(ln.Addr().String(), nil), map[string]interface{}{}, map[string]interface{}{}, func(e *protocols.InternalWrappedEvent) {
+		got = e.OperatorsResult
+	})
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	require.True(t, got.Matched)
+}
+
+func TestPackedInputAndExtractor(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 6)
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "\x00\x04ping" {
+			return
+		}
+		conn.Write([]byte("\x00\x04pong\xff"))
+	}()
+
+	r := &Request{
+		Address:  []string{"{{Hostname}}"},
+		Inputs:   []*Input{{Data: `{{len_prefix(">H", "ping")}}`}},
+		ReadSize: 7,
+	}
+	r.Operators = operators.Operators{
+		Extractors: []*operators.Extractor{
+			{Type: "dsl", Name: "reply", DSL: []string{`bytes_at(data, 2, u16be(data))`}},
+		},
+	}
+	require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{}}))
+
+	var got *operators.Result
+	err = r.ExecuteWithResults(protocols.NewScanContext(ln.Addr().String(), nil), map[string]interface{}{}, map[string]interface{}{}, func(e *protocols.InternalWrappedEvent) {
+		got = e.OperatorsResult
+	})
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	require.Equal(t, []string{"pong"}, got.ExtractsByName()["reply"])
+}
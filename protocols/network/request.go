@@ -1,13 +1,15 @@
 package network
 
 import (
-	"context"
+	"bytes"
+	"crypto/tls"
 	"encoding/hex"
 	"errors"
 	"github.com/chainreactors/neutron/common"
-	"github.com/chainreactors/utils/iutils"
+	"github.com/chainreactors/neutron/common/tlsx"
 	"github.com/chainreactors/neutron/operators"
 	protocols "github.com/chainreactors/neutron/protocols"
+	"github.com/chainreactors/utils/iutils"
 	"io"
 	"net"
 	"net/url"
@@ -19,7 +21,7 @@ var _ protocols.Request = &Request{}
 
 // Type returns the type of the protocol request
 func (r *Request) Type() protocols.ProtocolType {
-	return protocols.FileProtocol
+	return protocols.NetworkProtocol
 }
 
 func (r *Request) getMatchPart(part string, data protocols.InternalEvent) (string, bool) {
@@ -67,6 +69,19 @@ func (r *Request) ExecuteWithResults(input *protocols.ScanContext, dynamicValues
 	if err != nil {
 		return err
 	}
+	if previous == nil {
+		previous = make(map[string]interface{})
+	}
+	requestCount := 0
+	for _, target := range r.expandTargets(address) {
+		r.executeTarget(input, target, dynamicValues, previous, &requestCount, callback)
+	}
+	return nil
+}
+
+// executeTarget runs every address of the request against one host:port.
+func (r *Request) executeTarget(input *protocols.ScanContext, address string, dynamicValues, previous map[string]interface{}, requestCount *int, callback protocols.OutputEventCallback) {
+	var err error
 	targetValues := generateNetworkVariables(address)
 	var globalVars map[string]interface{}
 	if input != nil {
@@ -84,16 +99,15 @@ func (r *Request) ExecuteWithResults(input *protocols.ScanContext, dynamicValues
 	dynamicValues = iutils.MergeMaps(dynamicValues, targetValues)
 	for _, kv := range r.addresses {
 		actualAddress := common.Replace(kv.address, targetValues)
-		err = r.executeAddress(input, targetValues, actualAddress, address, kv.tls, dynamicValues, callback)
+		err = r.executeAddress(input, targetValues, actualAddress, address, kv.tls, dynamicValues, previous, requestCount, callback)
 		if err != nil {
 			continue
 		}
 	}
-	return nil
 }
 
 // executeAddress executes the request for an address
-func (r *Request) executeAddress(input *protocols.ScanContext, variables map[string]interface{}, actualAddress, address string, shouldUseTLS bool, dynamicValues map[string]interface{}, callback protocols.OutputEventCallback) error {
+func (r *Request) executeAddress(input *protocols.ScanContext, variables map[string]interface{}, actualAddress, address string, shouldUseTLS bool, dynamicValues, previous map[string]interface{}, requestCount *int, callback protocols.OutputEventCallback) error {
 	var err error
 	if !strings.Contains(actualAddress, ":") {
 		err = errors.New("no port provided in network protocol request")
@@ -112,7 +126,7 @@ func (r *Request) executeAddress(input *protocols.ScanContext, variables map[str
 		generator = r.generator
 	}
 	if generator != nil {
-		iterator := r.generator.NewIterator()
+		iterator := generator.NewIterator()
 
 		for {
 			value, ok := iterator.Value()
@@ -120,21 +134,137 @@ func (r *Request) executeAddress(input *protocols.ScanContext, variables map[str
 				break
 			}
 			value = iutils.MergeMaps(value, payloads)
-			if err := r.executeRequestWithPayloads(variables, actualAddress, address, input.Input, shouldUseTLS, value, dynamicValues, callback); err != nil {
+			if err := r.executeRequestWithPayloads(input, variables, actualAddress, address, shouldUseTLS, value, dynamicValues, previous, requestCount, callback); err != nil {
 				return err
 			}
 		}
 	} else {
 		value := protocols.CopyMap(payloads)
 
-		if err := r.executeRequestWithPayloads(variables, actualAddress, address, input.Input, shouldUseTLS, value, dynamicValues, callback); err != nil {
+		if err := r.executeRequestWithPayloads(input, variables, actualAddress, address, shouldUseTLS, value, dynamicValues, previous, requestCount, callback); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (r *Request) executeRequestWithPayloads(variables map[string]interface{}, actualAddress, address, input string, shouldUseTLS bool, payloads map[string]interface{}, dynamicValues map[string]interface{}, callback protocols.OutputEventCallback) error {
+func (r *Request) executeRequestWithPayloads(input *protocols.ScanContext, variables map[string]interface{}, actualAddress, address string, shouldUseTLS bool, payloads map[string]interface{}, dynamicValues, previous map[string]interface{}, requestCount *int, callback protocols.OutputEventCallback) error {
+	var (
+		exchanged   *exchangeResult
+		fingerprint *Fingerprint
+		err         error
+	)
+	*requestCount++
+	requestIndex := protocols.RequestIndex(dynamicValues, *requestCount)
+	if r.DetectService && len(r.Inputs) == 0 {
+		// detect-service without inputs walks the catalog, one connection per
+		// probe, until a probe response is fingerprinted. A service sending a
+		// banner is only read once, it would send it again to every probe.
+		// Unfingerprinted, the response is the first one read, the banner.
+		for _, probe := range probes {
+			probed, probeErr := r.exchange(actualAddress, shouldUseTLS, variables, []*Input{{probe: probe}}, payloads)
+			if probeErr != nil {
+				err = probeErr
+				continue
+			}
+			if exchanged == nil {
+				exchanged = probed
+			}
+			if fingerprint = MatchService([]byte(probed.response), probe.Name); fingerprint != nil {
+				exchanged = probed
+				break
+			}
+			if len(probe.Data) == 0 && probed.response != "" {
+				break
+			}
+		}
+		if exchanged == nil {
+			return err
+		}
+	} else {
+		exchanged, err = r.exchange(actualAddress, shouldUseTLS, variables, r.Inputs, payloads)
+		if err != nil {
+			return err
+		}
+		if r.DetectService {
+			fingerprint = MatchService([]byte(exchanged.response), r.probeNames()...)
+		}
+	}
+
+	//outputEvent := r.responseToDSLMap(reqBuilder.String(), string(final[:n]), responseBuilder.String(), input, actualAddress)
+	//outputEvent["ip"] = r.dialer.GetDialedIP(hostname)
+	//for k, v := range dynamicValues {
+	//	outputEvent[k] = v
+	//}
+	//for k, v := range payloads {
+	//	outputEvent[k] = v
+	//}
+	//for k, v := range inputEvents {
+	//	outputEvent[k] = v
+	//}
+	outputEvent := map[string]interface{}{
+		"data":    exchanged.response,
+		"matched": actualAddress,
+	}
+	for _, key := range []string{"Host", "Port"} {
+		if v, ok := variables[key]; ok {
+			outputEvent[strings.ToLower(key)] = v
+		}
+	}
+	// every named input is its own part, so matchers can target one step
+	for k, v := range exchanged.inputs {
+		outputEvent[k] = v
+	}
+	if exchanged.tls != nil {
+		tlsx.FillCertDSL(outputEvent, exchanged.tls, exchanged.tls.ServerName)
+		outputEvent["alpn"] = exchanged.tls.NegotiatedProtocol
+	}
+	if fingerprint != nil {
+		outputEvent["service"] = fingerprint.Service
+		outputEvent["product"] = fingerprint.Product
+		outputEvent["version"] = fingerprint.Version
+	}
+	finalEvent := iutils.MergeMaps(previous, outputEvent)
+	// Add to history the current request number metadata if asked by the user.
+	if r.NeedsRequestCondition() {
+		protocols.AddRequestHistory(previous, finalEvent, outputEvent, requestIndex)
+	}
+	protocols.AddProtocolEvent(previous, outputEvent, r.Type(), dynamicValues)
+	event := &protocols.InternalWrappedEvent{InternalEvent: iutils.MergeMaps(dynamicValues, finalEvent)}
+	if r.CompiledOperators != nil {
+		result, ok := protocols.ExecuteOperators(input, r, r.CompiledOperators, finalEvent, event, func(part string) (string, bool) {
+			return r.getMatchPart(part, finalEvent)
+		})
+		if ok && result != nil {
+			event.OperatorsResult = result
+			event.OperatorsResult.PayloadValues = payloads
+			//event.Results = r.MakeResultEvent(event)
+		}
+	}
+	if fingerprint != nil && (r.CompiledOperators == nil || event.OperatorsResult != nil) {
+		if event.OperatorsResult == nil {
+			event.OperatorsResult = &operators.Result{}
+			event.OperatorsResult.PayloadValues = payloads
+		}
+		appendFingerprintEvents(event.OperatorsResult, fingerprint)
+	}
+	callback(event)
+
+	//event := &output.InternalWrappedEvent{InternalEvent: outputEvent}
+
+	return nil
+}
+
+// exchangeResult is what one connection produced: the accumulated response,
+// the per-input named reads and, for tls:// addresses, the handshake state.
+type exchangeResult struct {
+	response string
+	inputs   map[string]interface{}
+	tls      *tls.ConnectionState
+}
+
+// exchange dials the address, plays the inputs and collects the responses.
+func (r *Request) exchange(actualAddress string, shouldUseTLS bool, variables map[string]interface{}, inputs []*Input, payloads map[string]interface{}) (*exchangeResult, error) {
 	var (
 		//hostname string
 		conn net.Conn
@@ -145,41 +275,50 @@ func (r *Request) executeRequestWithPayloads(variables map[string]interface{}, a
 	//	hostname = host
 	//}
 
+	result := &exchangeResult{}
 	if shouldUseTLS {
-		//conn, err = r.dialer.DialTLS(context.Background(), "tcp", actualAddress)
-	} else if r.options != nil && r.options.Options != nil && r.options.Options.DialContext != nil {
-		// 经注入的拨号器（可为代理）建连，保持与 http 协议一致的实例级行为。
-		conn, err = r.options.Options.DialContext(context.Background(), "tcp", actualAddress)
+		var tlsConn *tls.Conn
+		if tlsConn, err = r.dialTLS(actualAddress, variables); err == nil {
+			state := tlsConn.ConnectionState()
+			result.tls = &state
+			conn = tlsConn
+		}
 	} else {
-		conn, err = r.dialer.Dial("tcp", actualAddress)
+		conn, err = r.dial(actualAddress)
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer conn.Close()
-	_ = conn.SetReadDeadline(time.Now().Add(time.Duration(2) * time.Second))
+	_ = conn.SetReadDeadline(time.Now().Add(defaultReadTimeout))
 
 	responseBuilder := &strings.Builder{}
 	//reqBuilder := &strings.Builder{}
 
 	inputEvents := make(map[string]interface{})
-	for _, input := range r.Inputs {
+	for _, input := range inputs {
 		var data []byte
 
-		switch input.Type {
-		case "hex":
+		switch {
+		case input.probe != nil:
+			data = input.probe.Data
+		case input.Type == "hex":
 			data, err = hex.DecodeString(input.Data)
 		default:
 			data = []byte(input.Data)
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 		//reqBuilder.Grow(len(input.Data))
 
-		finalData, err := common.Evaluate(string(data), payloads)
-		if err != nil {
-			return err
+		finalData := string(data)
+		if input.probe == nil {
+			// probe payloads are raw bytes and never carry template expressions
+			finalData, err = common.Evaluate(finalData, payloads)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		//if dataErr != nil {
@@ -189,20 +328,25 @@ func (r *Request) executeRequestWithPayloads(variables map[string]interface{}, a
 		//}
 		//reqBuilder.Write(finalData)
 
-		_, err = conn.Write([]byte(finalData))
-		if err != nil {
-			return err
+		if len(finalData) > 0 {
+			_, err = conn.Write([]byte(finalData))
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		if input.Read > 0 {
-			buffer := make([]byte, input.Read)
-			n, err := conn.Read(buffer)
+		if input.Read > 0 || input.hasReadUntil() {
+			buffer, err := input.read(conn)
 			if err != nil {
-				return err
+				return nil, err
 			}
-			responseBuilder.Write(buffer[:n])
+			if input.readTimeout > 0 {
+				// the following reads are bounded by the default deadline again
+				_ = conn.SetReadDeadline(time.Now().Add(defaultReadTimeout))
+			}
+			responseBuilder.Write(buffer)
 
-			bufferStr := string(buffer[:n])
+			bufferStr := string(buffer)
 			if input.Name != "" {
 				inputEvents[input.Name] = bufferStr
 			}
@@ -227,6 +371,12 @@ func (r *Request) executeRequestWithPayloads(variables map[string]interface{}, a
 		final []byte
 		n     int
 	)
+	if len(inputs) > 0 && inputs[len(inputs)-1].hasReadUntil() && r.ReadSize == 0 && !r.ReadAll {
+		// the last exchange step already consumed its reply up to the
+		// delimiter; a trailing read would only wait for the deadline.
+		result.response, result.inputs = responseBuilder.String(), inputEvents
+		return result, nil
+	}
 	if r.ReadAll {
 		readInterval := time.NewTimer(time.Second * 1)
 		// stop the timer and drain the channel
@@ -248,7 +398,7 @@ func (r *Request) executeRequestWithPayloads(variables map[string]interface{}, a
 					if err == io.EOF {
 						break readSocket
 					} else {
-						return err
+						return nil, err
 					}
 				}
 				responseBuilder.Write(buf[:nBuf])
@@ -258,39 +408,96 @@ func (r *Request) executeRequestWithPayloads(variables map[string]interface{}, a
 		}
 	} else {
 		final = make([]byte, bufferSize)
-		time.Sleep(1000 * time.Millisecond)
+		// a probe reply is read as soon as it arrives, within the deadline;
+		// other exchanges give the peer a second to answer
+		if len(inputs) == 0 || inputs[len(inputs)-1].probe == nil {
+			time.Sleep(1000 * time.Millisecond)
+		}
 		n, err = conn.Read(final)
 		if err != nil && err != io.EOF {
-			return err
+			return nil, err
 		}
 		responseBuilder.Write(final[:n])
 	}
+	result.response, result.inputs = responseBuilder.String(), inputEvents
+	return result, nil
+}
 
-	//outputEvent := r.responseToDSLMap(reqBuilder.String(), string(final[:n]), responseBuilder.String(), input, actualAddress)
-	//outputEvent["ip"] = r.dialer.GetDialedIP(hostname)
-	//for k, v := range dynamicValues {
-	//	outputEvent[k] = v
-	//}
-	//for k, v := range payloads {
-	//	outputEvent[k] = v
-	//}
-	//for k, v := range inputEvents {
-	//	outputEvent[k] = v
-	//}
-	event := &protocols.InternalWrappedEvent{InternalEvent: dynamicValues}
-	if r.CompiledOperators != nil {
-		result, ok := r.CompiledOperators.Execute(map[string]interface{}{"data": responseBuilder.String()}, r.Match, r.Extract)
-		if ok && result != nil {
-			event.OperatorsResult = result
-			event.OperatorsResult.PayloadValues = payloads
-			//event.Results = r.MakeResultEvent(event)
+// defaultReadTimeout bounds the reads of an exchange whose inputs set no
+// read-timeout.
+const defaultReadTimeout = 2 * time.Second
+
+// read performs the read configured on the input: a single read of Read
+// bytes, or with read-until a loop that stops at the delimiter, at Read bytes
+// or when the peer stops sending.
+func (input *Input) read(conn net.Conn) ([]byte, error) {
+	if input.readTimeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(input.readTimeout))
+	}
+	if !input.hasReadUntil() {
+		buffer := make([]byte, input.Read)
+		n, err := conn.Read(buffer)
+		return buffer[:n], err
+	}
+
+	var response []byte
+	for {
+		size := 1024
+		if input.Read > 0 && input.Read-len(response) < size {
+			size = input.Read - len(response)
+		}
+		chunk := make([]byte, size)
+		n, err := conn.Read(chunk)
+		response = append(response, chunk[:n]...)
+		if input.untilReached(response) || (input.Read > 0 && len(response) >= input.Read) {
+			return response, nil
+		}
+		if err != nil {
+			if len(response) > 0 && (err == io.EOF || isTimeout(err)) {
+				return response, nil
+			}
+			return response, err
 		}
 	}
-	callback(event)
+}
 
-	//event := &output.InternalWrappedEvent{InternalEvent: outputEvent}
+func (input *Input) untilReached(response []byte) bool {
+	if input.untilRegex != nil {
+		return input.untilRegex.Match(response)
+	}
+	return bytes.Contains(response, input.until)
+}
 
-	return nil
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// probeNames returns the catalog probes referenced by the inputs, in order.
+func (r *Request) probeNames() []string {
+	var names []string
+	for _, input := range r.Inputs {
+		if input.probe != nil {
+			names = append(names, input.probe.Name)
+		}
+	}
+	return names
+}
+
+// appendFingerprintEvents records a service fingerprint as extract events so
+// detect-service results surface through OutputExtracts/ExtractsByName.
+func appendFingerprintEvents(result *operators.Result, fingerprint *Fingerprint) {
+	for _, kv := range [][2]string{
+		{"service", fingerprint.Service},
+		{"product", fingerprint.Product},
+		{"version", fingerprint.Version},
+	} {
+		if kv[1] == "" {
+			continue
+		}
+		result.Events = append(result.Events, operators.TemplateEvent{Type: "extract", Name: kv[0], Value: kv[1]})
+	}
+	result.Extracted = true
 }
 
 // getAddress returns the address of the host to make request to
@@ -0,0 +1,97 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/chainreactors/neutron/common"
+	"github.com/chainreactors/neutron/common/tlsx"
+)
+
+// compileTLS builds the base client config for tls:// addresses. The server
+// name is filled per connection, since SNI may reference target variables.
+func (r *Request) compileTLS() error {
+	cfg := &tls.Config{
+		InsecureSkipVerify: !r.Verify,
+		NextProtos:         r.ALPN,
+	}
+	if r.MinVersion != "" {
+		if cfg.MinVersion = tlsx.TLSVersionValue(r.MinVersion); cfg.MinVersion == 0 {
+			return fmt.Errorf("unsupported tls min_version %q", r.MinVersion)
+		}
+	}
+	if r.ClientCert != "" {
+		certPEM, err := r.readPEM(r.ClientCert)
+		if err != nil {
+			return fmt.Errorf("could not read client_cert: %v", err)
+		}
+		keyPEM := certPEM
+		if r.ClientKey != "" {
+			if keyPEM, err = r.readPEM(r.ClientKey); err != nil {
+				return fmt.Errorf("could not read client_key: %v", err)
+			}
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return fmt.Errorf("could not load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	r.tlsConfig = cfg
+	return nil
+}
+
+// readPEM accepts inline PEM data or a path to a PEM file, opened from the
+// catalog next to the template, then from the root of the catalog. Paths the
+// catalog does not resolve, or every path without a catalog, are read from
+// the file system.
+func (r *Request) readPEM(value string) ([]byte, error) {
+	if strings.Contains(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+	if name, ok := r.options.ResolvePath(value); ok {
+		file, err := r.options.Catalog.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return ioutil.ReadAll(file)
+	}
+	return ioutil.ReadFile(value)
+}
+
+// dialTLS performs the handshake on top of the regular (possibly injected)
+// dialer. sni defaults to the host part of the address.
+func (r *Request) dialTLS(actualAddress string, variables map[string]interface{}) (*tls.Conn, error) {
+	raw, err := r.dial(actualAddress)
+	if err != nil {
+		return nil, err
+	}
+	cfg := r.tlsConfig.Clone()
+	if r.SNI != "" {
+		cfg.ServerName = common.Replace(r.SNI, variables)
+	} else if host, _, splitErr := net.SplitHostPort(actualAddress); splitErr == nil {
+		cfg.ServerName = host
+	}
+	conn := tls.Client(raw, cfg)
+	_ = conn.SetDeadline(time.Now().Add(r.dialer.Timeout))
+	if err := conn.Handshake(); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func (r *Request) dial(actualAddress string) (net.Conn, error) {
+	if r.options != nil && r.options.Options != nil && r.options.Options.DialContext != nil {
+		// 经注入的拨号器（可为代理）建连，保持与 http 协议一致的实例级行为。
+		return r.options.Options.DialContext(context.Background(), "tcp", actualAddress)
+	}
+	return r.dialer.Dial("tcp", actualAddress)
+}
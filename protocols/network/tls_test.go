@@ -0,0 +1,120 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chainreactors/neutron/operators"
+	"github.com/chainreactors/neutron/protocols"
+	"github.com/stretchr/testify/require"
+)
+
+func clientCertPEM(t *testing.T, cn string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})) +
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestTLSAddressFillsCertFields(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.PeerCertificates) > 0 {
+			w.Write([]byte("client=" + req.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	r := &Request{
+		Address:    []string{"tls://{{Hostname}}"},
+		Inputs:     []*Input{{Data: "GET / HTTP/1.0\r\n\r\n"}},
+		SNI:        "neutron.test",
+		MinVersion: "tls12",
+		ALPN:       []string{"http/1.1"},
+		ClientCert: clientCertPEM(t, "neutron-client"),
+	}
+	r.Operators = operators.Operators{
+		MatchersCondition: "and",
+		Matchers: []*operators.Matcher{
+			{Type: "dsl", DSL: []string{`contains(subject_org, "Acme")`, `sni == "neutron.test"`, `alpn == "http/1.1"`}, Condition: "and"},
+			{Type: "word", Words: []string{"client=neutron-client"}},
+		},
+	}
+	require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{}}))
+
+	var got *operators.Result
+	err := r.ExecuteWithResults(protocols.NewScanContext(strings.TrimPrefix(server.URL, "https://"), nil), map[string]interface{}{}, map[string]interface{}{}, func(e *protocols.InternalWrappedEvent) {
+		got = e.OperatorsResult
+	})
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	require.True(t, got.Matched)
+}
+
+func TestCompileTLSOptionErrors(t *testing.T) {
+	opts := &protocols.ExecuterOptions{Options: &protocols.Options{}}
+	err := (&Request{Address: []string{"tls://{{Hostname}}"}, MinVersion: "tls9"}).Compile(opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "min_version")
+
+	err = (&Request{Address: []string{"tls://{{Hostname}}"}, ClientCert: "-----BEGIN CERTIFICATE-----\nbroken\n-----END CERTIFICATE-----\n"}).Compile(opts)
+	require.Error(t, err)
+
+	// options are only validated when a tls:// address uses them
+	require.NoError(t, (&Request{Address: []string{"{{Hostname}}"}, MinVersion: "tls9"}).Compile(opts))
+}
+
+func TestClientCertFromCatalog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "neutron-catalog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "network"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "network", "client.pem"), []byte(clientCertPEM(t, "neutron-client")), 0644))
+
+	opts := &protocols.ExecuterOptions{
+		Options:      &protocols.Options{},
+		Catalog:      protocols.DirCatalog(dir),
+		TemplatePath: "network/ldaps.yaml",
+	}
+	r := &Request{Address: []string{"tls://{{Hostname}}"}, ClientCert: "client.pem"}
+	require.NoError(t, r.Compile(opts))
+	require.Len(t, r.tlsConfig.Certificates, 1)
+
+	err = (&Request{Address: []string{"tls://{{Hostname}}"}, ClientCert: "missing.pem"}).Compile(opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "client_cert")
+}
+
+func TestCompileTLSIsPerAddress(t *testing.T) {
+	r := &Request{Address: []string{"tls://{{Hostname}}", "{{Hostname}}"}}
+	require.NoError(t, r.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{}}))
+	require.True(t, r.addresses[0].tls)
+	require.False(t, r.addresses[1].tls)
+}
@@ -47,8 +47,11 @@ func DefaultPartResolver(data map[string]interface{}) PartResolver {
 // with a custom part scheme (ssl's body/all→response fold) doesn't have to
 // duplicate the type-switch.
 func MakeDefaultMatchFunc(data map[string]interface{}, matcher *operators.Matcher, partResolver PartResolver) (bool, []operators.MatchHit) {
-	if matcher.GetType() == operators.DSLMatcher {
+	switch matcher.GetType() {
+	case operators.DSLMatcher:
 		return matcher.Result(matcher.MatchDSL(data)), nil
+	case operators.TimingMatcher:
+		return matcher.Result(matcher.MatchTiming(data)), nil
 	}
 	itemStr, ok := partResolver(matcher.Part)
 	if !ok {
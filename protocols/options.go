@@ -11,6 +11,17 @@ type Options struct {
 	Opsec       bool
 	Timeout     int
 	TextOnly    bool
+	// Vars override the template variables and constants of the same name,
+	// e.g. from a -var key=value flag; the other names are defined as
+	// variables of every template.
+	Vars map[string]interface{}
+	// ExternalVariables are names only supplied at execution time, e.g. the
+	// payloads passed to Execute or the values forwarded by a parent chain.
+	// The compile-time DSL checks treat them as defined.
+	ExternalVariables []string
+	// StrictDSL fails compilation on the variables the compile-time DSL
+	// checks cannot find; by default they are Template.Warnings.
+	StrictDSL bool
 	// DialContext 非 nil 时用于建立出站连接（http 与 network 协议），
 	// 使每个 ExecuterOptions 携带各自的拨号器（可为代理），从而并发安全、
 	// 无需改写任何全局 transport。由上层（如 SDK 经 proxyclient）注入。
@@ -0,0 +1,293 @@
+package protocols
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chainreactors/neutron/common"
+	"github.com/chainreactors/utils/iutils"
+)
+
+// payloadSource is a payload list. Generated payloads compute their values on
+// demand, so that large spaces are never held in memory.
+type payloadSource interface {
+	Len() int
+	Value(index int) string
+}
+
+// maxPayloadSpace bounds the size of a generated payload list, so that its
+// length fits an int everywhere.
+const maxPayloadSpace = 1<<31 - 1
+
+var errPayloadSpace = fmt.Errorf("generates more than %d payloads", maxPayloadSpace)
+
+type listSource []string
+
+func (l listSource) Len() int { return len(l) }
+
+func (l listSource) Value(index int) string { return l[index] }
+
+var payloadGeneratorRegex = regexp.MustCompile(`^\s*(range|brute|daterange|dsl)\((.*)\)\s*$`)
+
+// parsePayloadGenerator parses a generated payload definition:
+//
+//	range(start, end[, step[, width]])       integers from start to end included, zero padded to width
+//	brute(charset, min, max)                 every string of min to max characters of charset
+//	daterange(start, end[, layout[, days]])  dates from start to end included, as YYYY-MM-DD
+//	dsl(expression)                          the list returned by a dsl expression, e.g. split("a,b", ",")
+//
+// The brute charset can be digits, lower, upper, alpha, alnum or hex. The
+// daterange layout is a go time layout, default 2006-01-02. ok is false when
+// payload is not a generator.
+func parsePayloadGenerator(payload string) (source payloadSource, ok bool, err error) {
+	matches := payloadGeneratorRegex.FindStringSubmatch(payload)
+	if matches == nil {
+		return nil, false, nil
+	}
+	if matches[1] == "dsl" {
+		source, err = newDSLSource(matches[2])
+		return source, true, err
+	}
+
+	args := splitGeneratorArgs(matches[2])
+	switch matches[1] {
+	case "range":
+		source, err = newRangeSource(args)
+	case "brute":
+		source, err = newBruteSource(args)
+	case "daterange":
+		source, err = newDateSource(args)
+	}
+	return source, true, err
+}
+
+// splitGeneratorArgs splits comma separated arguments, which can be quoted
+// to hold commas.
+func splitGeneratorArgs(args string) []string {
+	var split []string
+	var current strings.Builder
+	var quote rune
+	for _, ch := range args {
+		switch {
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote == 0 && (ch == '"' || ch == '\''):
+			quote = ch
+		case quote == 0 && ch == ',':
+			split = append(split, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteRune(ch)
+		}
+	}
+	return append(split, strings.TrimSpace(current.String()))
+}
+
+func parseGeneratorInts(name string, args []string) ([]int64, error) {
+	ints := make([]int64, len(args))
+	for i, arg := range args {
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s argument %q", name, arg)
+		}
+		ints[i] = n
+	}
+	return ints, nil
+}
+
+type rangeSource struct {
+	start, step int64
+	count       int
+	width       int
+}
+
+func newRangeSource(args []string) (*rangeSource, error) {
+	if len(args) < 2 || len(args) > 4 {
+		return nil, errors.New("range expects start, end[, step[, width]]")
+	}
+	ints, err := parseGeneratorInts("range", args)
+	if err != nil {
+		return nil, err
+	}
+	start, end := ints[0], ints[1]
+	step := int64(1)
+	if end < start {
+		step = -1
+	}
+	if len(ints) > 2 {
+		step = ints[2]
+	}
+	if step == 0 || (end-start)*step < 0 {
+		return nil, fmt.Errorf("range step %d never reaches %d from %d", step, end, start)
+	}
+	count := (end-start)/step + 1
+	if count > maxPayloadSpace {
+		return nil, errPayloadSpace
+	}
+	source := &rangeSource{start: start, step: step, count: int(count)}
+	if len(ints) > 3 {
+		source.width = int(ints[3])
+	}
+	return source, nil
+}
+
+func (r *rangeSource) Len() int { return r.count }
+
+func (r *rangeSource) Value(index int) string {
+	return fmt.Sprintf("%0*d", r.width, r.start+int64(index)*r.step)
+}
+
+var bruteCharsets = map[string]string{
+	"digits": "0123456789",
+	"lower":  "abcdefghijklmnopqrstuvwxyz",
+	"upper":  "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"alpha":  "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"alnum":  "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"hex":    "0123456789abcdef",
+}
+
+// bruteSource enumerates the strings by length then in charset order, e.g.
+// a, b, aa, ab, ba, bb for the charset ab.
+type bruteSource struct {
+	charset []rune
+	min     int
+	// counts are the number of strings of each length from min
+	counts []int
+}
+
+func newBruteSource(args []string) (*bruteSource, error) {
+	if len(args) != 3 {
+		return nil, errors.New("brute expects charset, min, max")
+	}
+	charset := args[0]
+	if alias, ok := bruteCharsets[charset]; ok {
+		charset = alias
+	}
+	if charset == "" {
+		return nil, errors.New("brute charset is empty")
+	}
+	ints, err := parseGeneratorInts("brute", args[1:])
+	if err != nil {
+		return nil, err
+	}
+	min, max := ints[0], ints[1]
+	if min < 1 || max < min {
+		return nil, fmt.Errorf("invalid brute lengths %d to %d", min, max)
+	}
+
+	source := &bruteSource{charset: []rune(charset), min: int(min)}
+	n := int64(len(source.charset))
+	count, total := int64(1), int64(0)
+	for length := int64(1); length <= max; length++ {
+		count *= n
+		if count > maxPayloadSpace {
+			return nil, errPayloadSpace
+		}
+		if length >= min {
+			total += count
+			if total > maxPayloadSpace {
+				return nil, errPayloadSpace
+			}
+			source.counts = append(source.counts, int(count))
+		}
+	}
+	return source, nil
+}
+
+func (b *bruteSource) Len() int {
+	total := 0
+	for _, count := range b.counts {
+		total += count
+	}
+	return total
+}
+
+func (b *bruteSource) Value(index int) string {
+	length := b.min
+	for _, count := range b.counts {
+		if index < count {
+			break
+		}
+		index -= count
+		length++
+	}
+	value := make([]rune, length)
+	n := len(b.charset)
+	for i := length - 1; i >= 0; i-- {
+		value[i] = b.charset[index%n]
+		index /= n
+	}
+	return string(value)
+}
+
+type dateSource struct {
+	start  time.Time
+	days   int
+	count  int
+	layout string
+}
+
+func newDateSource(args []string) (*dateSource, error) {
+	if len(args) < 2 || len(args) > 4 {
+		return nil, errors.New("daterange expects start, end[, layout[, days]]")
+	}
+	start, err := time.Parse("2006-01-02", args[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid daterange start %q", args[0])
+	}
+	end, err := time.Parse("2006-01-02", args[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid daterange end %q", args[1])
+	}
+	source := &dateSource{start: start, days: 1, layout: "2006-01-02"}
+	if len(args) > 2 && args[2] != "" {
+		source.layout = args[2]
+	}
+	if len(args) > 3 {
+		ints, err := parseGeneratorInts("daterange", args[3:])
+		if err != nil {
+			return nil, err
+		}
+		if ints[0] < 1 {
+			return nil, fmt.Errorf("invalid daterange step %d", ints[0])
+		}
+		source.days = int(ints[0])
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("daterange end %s is before start %s", args[1], args[0])
+	}
+	source.count = int(end.Sub(start).Hours()/24)/source.days + 1
+	return source, nil
+}
+
+func (d *dateSource) Len() int { return d.count }
+
+func (d *dateSource) Value(index int) string {
+	return d.start.AddDate(0, 0, index*d.days).Format(d.layout)
+}
+
+// newDSLSource evaluates expression once, dsl results being lists already.
+func newDSLSource(expression string) (listSource, error) {
+	result, err := common.Eval(expression, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	switch r := result.(type) {
+	case []string:
+		return listSource(r), nil
+	case []interface{}:
+		values := make([]string, len(r))
+		for i, v := range r {
+			values[i] = iutils.ToString(v)
+		}
+		return listSource(values), nil
+	case string:
+		return listSource(strings.Split(r, "\n")), nil
+	default:
+		return listSource{iutils.ToString(r)}, nil
+	}
+}
@@ -14,6 +14,14 @@ type ExecuterOptions struct {
 	Variables    Variable
 	varsPayloads map[string]interface{}
 	Options      *Options
+	// Constants are the template constants, evaluated once at compile time.
+	Constants map[string]interface{}
+	// Catalog opens the files the template references, e.g. payload
+	// wordlists. Nil disables payload files.
+	Catalog Catalog
+	// TemplatePath is the path of the template in Catalog, relative payload
+	// files resolve against its directory first.
+	TemplatePath string
 }
 
 // Executer is an interface implemented any protocol based request executer.
@@ -95,6 +103,9 @@ type InternalWrappedEvent struct {
 	InternalEvent   InternalEvent
 	Results         []*ResultEvent
 	OperatorsResult *operators.Result
+	// Explanation tells how the matchers evaluated the event, it is only
+	// recorded when the scan context is in explain mode.
+	Explanation *operators.Explanation
 }
 
 type OutputEventCallback func(result *InternalWrappedEvent)
@@ -16,6 +16,10 @@ type ScanContext struct {
 	OnError  func(error)
 	OnResult func(e *InternalWrappedEvent)
 	TraceAll bool
+	// Explain records how every matcher evaluated each event, see
+	// operators.Explanation. Events that did not match are reported as well
+	// and every result carries its explanation under the ExplainKey metadata.
+	Explain bool
 	// GlobalVars holds pre-computed stable variable values for this execution.
 	// Random/static variables (e.g. rand_base()) and bare {{randstr}}/{{randnum}}
 	// are evaluated once here so they stay identical across request blocks within
@@ -74,13 +74,16 @@ func (r *Request) ExecuteWithResults(input *protocols.ScanContext, dynamicValues
 		scanInput = input.Input
 	}
 
+	if previous == nil {
+		previous = make(map[string]interface{})
+	}
 	target := r.resolveTarget(scanInput, iutils.MergeMaps(globalVars, dynamicValues))
 	if err := r.executeTarget(input, target, dynamicValues, previous, callback); err != nil {
 		// Emit a probe_status=false event so the executer sees something for
 		// this sub-request — matchers/extractors that key off probe_status
 		// can still fire, and the next sub-request gets a chance to run.
 		host, port := splitHostPort(target)
-		data := map[string]interface{}{
+		outputEvent := map[string]interface{}{
 			"host":         host,
 			"port":         port,
 			"matched":      target,
@@ -88,12 +91,6 @@ func (r *Request) ExecuteWithResults(input *protocols.ScanContext, dynamicValues
 			"probe_status": false,
 			"error":        err.Error(),
 		}
-		for k, v := range previous {
-			data[k] = v
-		}
-		for k, v := range dynamicValues {
-			data[k] = v
-		}
 		if encoded, marshalErr := json.Marshal(map[string]interface{}{
 			"host":         host,
 			"port":         port,
@@ -101,11 +98,14 @@ func (r *Request) ExecuteWithResults(input *protocols.ScanContext, dynamicValues
 			"probe_status": false,
 			"error":        err.Error(),
 		}); marshalErr == nil {
-			data["response"] = string(encoded)
+			outputEvent["response"] = string(encoded)
 		}
+		data := r.finalEvent(outputEvent, dynamicValues, previous)
 		event := &protocols.InternalWrappedEvent{InternalEvent: data}
 		if r.CompiledOperators != nil {
-			result, ok := r.CompiledOperators.Execute(data, r.Match, r.Extract)
+			result, ok := protocols.ExecuteOperators(input, r, r.CompiledOperators, data, event, func(part string) (string, bool) {
+				return r.getMatchPart(part, data)
+			})
 			if ok && result != nil {
 				result.PayloadValues = dynamicValues
 				event.OperatorsResult = result
@@ -146,10 +146,10 @@ func (r *Request) executeTarget(input *protocols.ScanContext, target string, dyn
 		InsecureSkipVerify: true,
 		ServerName:         host,
 	}
-	if v := tlsVersionValue(r.MinVersion); v != 0 {
+	if v := tlsx.TLSVersionValue(r.MinVersion); v != 0 {
 		cfg.MinVersion = v
 	}
-	if v := tlsVersionValue(r.MaxVersion); v != 0 {
+	if v := tlsx.TLSVersionValue(r.MaxVersion); v != 0 {
 		cfg.MaxVersion = v
 	}
 	// When the template explicitly pins a TLS version, widen the cipher list.
@@ -180,18 +180,15 @@ func (r *Request) executeTarget(input *protocols.ScanContext, target string, dyn
 		return fmt.Errorf("no peer certificates presented by %s", target)
 	}
 
-	data := make(map[string]interface{})
-	for k, v := range previous {
-		data[k] = v
-	}
-	for k, v := range dynamicValues {
-		data[k] = v
-	}
-	r.responseToDSLMap(data, target, conn, &state)
+	outputEvent := make(map[string]interface{})
+	r.responseToDSLMap(outputEvent, target, conn, &state)
+	data := r.finalEvent(outputEvent, dynamicValues, previous)
 
 	event := &protocols.InternalWrappedEvent{InternalEvent: data}
 	if r.CompiledOperators != nil {
-		result, ok := r.CompiledOperators.Execute(data, r.Match, r.Extract)
+		result, ok := protocols.ExecuteOperators(input, r, r.CompiledOperators, data, event, func(part string) (string, bool) {
+			return r.getMatchPart(part, data)
+		})
 		if ok && result != nil {
 			result.PayloadValues = dynamicValues
 			event.OperatorsResult = result
@@ -202,6 +199,26 @@ func (r *Request) executeTarget(input *protocols.ScanContext, target string, dyn
 	return nil
 }
 
+// finalEvent layers the probe output over the previous events and dynamic
+// values, recording the probe in the request history when asked to.
+func (r *Request) finalEvent(outputEvent, dynamicValues, previous map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{}, len(previous)+len(dynamicValues)+len(outputEvent))
+	for k, v := range previous {
+		data[k] = v
+	}
+	for k, v := range dynamicValues {
+		data[k] = v
+	}
+	for k, v := range outputEvent {
+		data[k] = v
+	}
+	if r.NeedsRequestCondition() {
+		protocols.AddRequestHistory(previous, data, outputEvent, protocols.RequestIndex(dynamicValues, 1))
+	}
+	protocols.AddProtocolEvent(previous, outputEvent, r.Type(), dynamicValues)
+	return data
+}
+
 func (r *Request) dialTLS(target string, cfg *tls.Config) (*tls.Conn, error) {
 	// Honour an injected dialer (e.g. proxy) by dialing TCP first, then doing
 	// the TLS handshake on top of it.
@@ -357,24 +374,6 @@ func defaultPortForScheme(scheme string) string {
 // `fingerprint_hash` DSL value has a stable, package-local name.
 type certificateFingerprintHash = tlsx.FingerprintHash
 
-// tlsVersionValue maps a textual version to the crypto/tls constant. Literal
-// hex values keep this go1.11-safe (tls.VersionTLS13 was added in go1.12).
-func tlsVersionValue(name string) uint16 {
-	switch strings.ToLower(strings.TrimSpace(name)) {
-	case "sslv3", "ssl30":
-		return 0x0300
-	case "tls10", "tls1.0":
-		return 0x0301
-	case "tls11", "tls1.1":
-		return 0x0302
-	case "tls12", "tls1.2":
-		return 0x0303
-	case "tls13", "tls1.3":
-		return 0x0304
-	}
-	return 0
-}
-
 func parseCipherSuiteIDs(names []string) ([]uint16, error) {
 	ids := make([]uint16, 0, len(names))
 	seen := map[uint16]struct{}{}
@@ -22,6 +22,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/chainreactors/neutron/common/tlsx"
 	"github.com/chainreactors/neutron/operators"
 	"github.com/chainreactors/neutron/protocols"
 )
@@ -52,6 +53,11 @@ type Request struct {
 	TLSCipherEnum  bool   `json:"tls_cipher_enum,omitempty" yaml:"tls_cipher_enum,omitempty"`
 	TLSCipherTypes bool   `json:"tls_cipher_types,omitempty" yaml:"tls_cipher_types,omitempty"`
 
+	// ReqCondition exposes the probe's fields as `<field>_<index>`
+	// (subject_cn_1, tls_version_2) to the operators of later requests. It is
+	// enabled implicitly when operators reference such fields.
+	ReqCondition bool `json:"req-condition,omitempty" yaml:"req-condition,omitempty"`
+
 	operators.Operators `json:",inline,omitempty" yaml:",inline,omitempty"`
 
 	CompiledOperators *operators.Operators       `json:"-" yaml:"-" jsonschema:"-"`
@@ -123,6 +129,32 @@ func (r *Request) Requests() int {
 	return 1
 }
 
+// NeedsRequestCondition determines if request condition should be enabled.
+func (r *Request) NeedsRequestCondition() bool {
+	return r.ReqCondition || protocols.NeedsRequestCondition(&r.Operators)
+}
+
+// responseDSLKeys are the connection fields of every ssl probe, next to the
+// certificate fields.
+var responseDSLKeys = []string{
+	"host", "port", "matched", "type", "ip", "response", "error",
+}
+
+// ResponseDSLScope extends scope with the fields of the probes, which the
+// matchers and extractors can reference.
+func (r *Request) ResponseDSLScope(scope *protocols.DSLScope) *protocols.DSLScope {
+	return scope.With(nil, append(append([]string{}, responseDSLKeys...), tlsx.CertDSLKeys...)...)
+}
+
+// CheckDSL statically checks the address and dsl operators of the request;
+// field is its template path, e.g. ssl[0].
+func (r *Request) CheckDSL(field string, scope *protocols.DSLScope) error {
+	if err := protocols.CheckPlaceholders(field+".address", r.Address, scope); err != nil {
+		return err
+	}
+	return protocols.CheckOperators(field, &r.Operators, r.ResponseDSLScope(scope))
+}
+
 // GetID returns the unique ID of the request if any.
 func (r *Request) GetID() string {
 	return r.ID
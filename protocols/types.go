@@ -35,3 +35,17 @@ var protocolMappings = map[ProtocolType]string{
 func (t ProtocolType) String() string {
 	return protocolMappings[t]
 }
+
+// RegisterProtocolType returns the ProtocolType named name, allocating a new
+// one for the protocols implemented outside neutron. Like the other
+// registrars, it is intended to be called from init().
+func RegisterProtocolType(name string) ProtocolType {
+	for t, registered := range protocolMappings {
+		if registered == name {
+			return t
+		}
+	}
+	t := InvalidProtocol + ProtocolType(len(protocolMappings))
+	protocolMappings[t] = name
+	return t
+}
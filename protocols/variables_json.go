@@ -7,8 +7,8 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/Knetic/govaluate"
 	"github.com/chainreactors/neutron/common"
+	"github.com/chainreactors/neutron/common/dsl"
 	"github.com/chainreactors/utils/iutils"
 )
 
@@ -51,6 +51,26 @@ func (variables *Variable) StableValues() map[string]interface{} {
 	return frozen
 }
 
+// ForEach calls fn for every variable, in key order.
+func (variables *Variable) ForEach(fn func(key string, data interface{})) {
+	for _, key := range variables.sortedKeys() {
+		fn(key, (*variables)[key])
+	}
+}
+
+// Override returns a copy of the variables with the definitions of the names
+// in values replaced by their value.
+func (variables *Variable) Override(values map[string]interface{}) Variable {
+	overridden := make(Variable, len(*variables))
+	for key, value := range *variables {
+		if override, ok := values[key]; ok {
+			value = override
+		}
+		overridden[key] = value
+	}
+	return overridden
+}
+
 func (variables *Variable) sortedKeys() []string {
 	keys := make([]string, 0, len(*variables))
 	for key := range *variables {
@@ -103,7 +123,7 @@ func expressionDependencies(expression string) []string {
 	seen := make(map[string]struct{})
 	var deps []string
 	for _, expr := range expressions {
-		compiled, err := govaluate.NewEvaluableExpressionWithFunctions(expr, common.GetHelperFunctions())
+		compiled, err := dsl.CompileExpression(expr)
 		if err == nil {
 			for _, dep := range compiled.Vars() {
 				if _, ok := seen[dep]; ok {
@@ -7,8 +7,8 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/Knetic/govaluate"
 	"github.com/chainreactors/neutron/common"
+	"github.com/chainreactors/neutron/common/dsl"
 	"github.com/chainreactors/utils/iutils"
 	"gopkg.in/yaml.v3"
 )
@@ -104,6 +104,19 @@ func (variables *Variable) StableValues() map[string]interface{} {
 	return frozen
 }
 
+// Override returns a copy of the variables with the definitions of the names
+// in values replaced by their value, keeping the evaluation order.
+func (variables *Variable) Override(values map[string]interface{}) Variable {
+	overridden := Variable{InsertionOrderedStringMap: *NewEmptyInsertionOrderedStringMap(variables.Len())}
+	variables.ForEach(func(key string, value interface{}) {
+		if override, ok := values[key]; ok {
+			value = override
+		}
+		overridden.Set(key, value)
+	})
+	return overridden
+}
+
 func (variables *Variable) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	variables.InsertionOrderedStringMap = InsertionOrderedStringMap{}
 	return unmarshal(&variables.InsertionOrderedStringMap)
@@ -152,7 +165,7 @@ func expressionDependencies(expression string) []string {
 	seen := make(map[string]struct{})
 	var deps []string
 	for _, expr := range expressions {
-		compiled, err := govaluate.NewEvaluableExpressionWithFunctions(expr, common.GetHelperFunctions())
+		compiled, err := dsl.CompileExpression(expr)
 		if err == nil {
 			for _, dep := range compiled.Vars() {
 				if _, ok := seen[dep]; ok {
@@ -1,5 +1,13 @@
 package templates
 
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chainreactors/neutron/operators"
+)
+
 // ChainConfig controls chain execution behavior.
 type ChainConfig struct {
 	// DepthFirst uses recursive DFS (execute chains immediately after parent).
@@ -7,6 +15,12 @@ type ChainConfig struct {
 	DepthFirst bool
 	// PassVariables enables forwarding extracted values from parent to child templates.
 	PassVariables bool
+	// Concurrency bounds the templates of a BFS round executed at once, 0 or
+	// 1 executes them one by one. DFS walks are always sequential.
+	Concurrency int
+	// TargetConcurrency bounds the targets ExecuteTargets walks at once, 0 or
+	// 1 walks them one by one.
+	TargetConcurrency int
 }
 
 // ChainResult is returned by the execute callback to signal success.
@@ -14,44 +28,257 @@ type ChainConfig struct {
 type ChainResult struct {
 	// Vars holds values to forward to chained templates when PassVariables is enabled.
 	Vars map[string]interface{}
+	// Matches holds the names of the matchers that fired, which gate the
+	// edges added with matcher names, see ChainEdge.
+	Matches []string
+}
+
+// NewChainResult returns the ChainResult of a template execution, nil when
+// the template did not match. The extracted values become its Vars.
+func NewChainResult(result *operators.Result) *ChainResult {
+	if result == nil || !result.Matched {
+		return nil
+	}
+	chainResult := &ChainResult{Vars: make(map[string]interface{}, len(result.DynamicValues))}
+	for k, v := range result.DynamicValues {
+		chainResult.Vars[k] = v
+	}
+	for name := range result.MatchesByName() {
+		if name != "" {
+			chainResult.Matches = append(chainResult.Matches, name)
+		}
+	}
+	sort.Strings(chainResult.Matches)
+	return chainResult
+}
+
+// ChainEdge is a chain reference to the template Target. With Matchers, the
+// edge is only followed when the named matchers of the parent fired: any of
+// them, or all of them when Condition is "and". With Extracts, it is only
+// followed when the parent extracted every key, i.e. its Vars holds them.
+type ChainEdge struct {
+	Target    string
+	Matchers  []string
+	Condition string
+	Extracts  []string
+}
+
+// follows reports whether the edge is taken after the parent returned result.
+func (c ChainEdge) follows(result *ChainResult) bool {
+	for _, key := range c.Extracts {
+		if _, ok := result.Vars[key]; !ok {
+			return false
+		}
+	}
+	if len(c.Matchers) == 0 {
+		return true
+	}
+	matched := make(map[string]bool, len(result.Matches))
+	for _, name := range result.Matches {
+		matched[name] = true
+	}
+	for _, name := range c.Matchers {
+		if matched[name] && c.Condition != "and" {
+			return true
+		}
+		if !matched[name] && c.Condition == "and" {
+			return false
+		}
+	}
+	return c.Condition == "and"
+}
+
+// ChainCycleError reports a chain reference closing a cycle. Path starts and
+// ends with the same ID, e.g. [a b a].
+type ChainCycleError struct {
+	Path []string
+}
+
+func (c *ChainCycleError) Error() string {
+	return "chain cycle: " + strings.Join(c.Path, " -> ")
 }
 
 // ExecuteFunc is called for each template during chain walking.
 // id is the template ID; vars carries forwarded values from the parent
 // (nil when PassVariables is false or for entry-point templates).
 // Return a non-nil ChainResult to continue into this template's chains.
+// With Concurrency, it is called from several goroutines at once.
 type ExecuteFunc func(id string, vars map[string]interface{}) *ChainResult
 
+// TargetExecuteFunc is the ExecuteFunc of the walks of ExecuteTargets, target
+// being the walked target.
+type TargetExecuteFunc func(target, id string, vars map[string]interface{}) *ChainResult
+
+// ChainState is the state of the walk of one target: the templates executed
+// and the results they returned. It is safe for concurrent use.
+type ChainState struct {
+	Target string
+
+	mu       sync.Mutex
+	executed map[string]bool
+	order    []string
+	results  map[string]*ChainResult
+}
+
+// NewChainState creates the state of a walk of target.
+func NewChainState(target string) *ChainState {
+	return &ChainState{
+		Target:   target,
+		executed: make(map[string]bool),
+		results:  make(map[string]*ChainResult),
+	}
+}
+
+// claim marks id as executed, false when it already was.
+func (s *ChainState) claim(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.executed[id] {
+		return false
+	}
+	s.executed[id] = true
+	s.order = append(s.order, id)
+	return true
+}
+
+func (s *ChainState) has(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.executed[id]
+}
+
+func (s *ChainState) record(id string, result *ChainResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[id] = result
+}
+
+// Executed returns the IDs of the templates executed, in the order their
+// execution started.
+func (s *ChainState) Executed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.order...)
+}
+
+// Result returns the result of the template id, nil when it did not match or
+// was not executed.
+func (s *ChainState) Result(id string) *ChainResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.results[id]
+}
+
 // ChainExecutor walks a directed graph of templates connected by chain references.
 // Templates are registered by ID; the executor determines entry points (templates
 // not referenced as a chain target) and walks chains with deduplication.
+// Registration is not safe for concurrent use, walks are once the graph is built.
 type ChainExecutor struct {
-	chains       map[string][]string
+	chains       map[string][]ChainEdge
 	chainTargets map[string]bool
 	order        []string
+	cycles       [][]string
 	config       ChainConfig
 }
 
 // NewChainExecutor creates a ChainExecutor with the given config.
 func NewChainExecutor(config ChainConfig) *ChainExecutor {
 	return &ChainExecutor{
-		chains:       make(map[string][]string),
+		chains:       make(map[string][]ChainEdge),
 		chainTargets: make(map[string]bool),
 		config:       config,
 	}
 }
 
 // Add registers a template by its ID and the IDs it chains to.
+// A *ChainCycleError is returned when a chain closes a cycle; the chains are
+// registered anyway, as walks never execute a template twice.
 // Safe to call on a nil receiver (no-op).
-func (e *ChainExecutor) Add(id string, chainIDs []string) {
+func (e *ChainExecutor) Add(id string, chainIDs []string) error {
 	if e == nil {
-		return
+		return nil
 	}
-	e.chains[id] = chainIDs
-	e.order = append(e.order, id)
-	for _, cid := range chainIDs {
+	edges := make([]ChainEdge, len(chainIDs))
+	for i, cid := range chainIDs {
+		edges[i] = ChainEdge{Target: cid}
 		e.chainTargets[cid] = true
 	}
+	e.chains[id] = edges
+	e.order = append(e.order, id)
+	return e.checkCycles(id, edges)
+}
+
+// AddEdges registers a template by its ID, unless already registered, and
+// appends edges to its chains. Cycles are reported like Add does.
+// Safe to call on a nil receiver (no-op).
+func (e *ChainExecutor) AddEdges(id string, edges ...ChainEdge) error {
+	if e == nil {
+		return nil
+	}
+	if !e.Has(id) {
+		e.order = append(e.order, id)
+	}
+	e.chains[id] = append(e.chains[id], edges...)
+	for _, edge := range edges {
+		e.chainTargets[edge.Target] = true
+	}
+	return e.checkCycles(id, edges)
+}
+
+// checkCycles records the cycles closed by the edges of id, returning the
+// first one.
+func (e *ChainExecutor) checkCycles(id string, edges []ChainEdge) error {
+	var err error
+	for _, edge := range edges {
+		path := e.path(edge.Target, id)
+		if path == nil {
+			continue
+		}
+		cycle := append([]string{id}, path...)
+		e.cycles = append(e.cycles, cycle)
+		if err == nil {
+			err = &ChainCycleError{Path: cycle}
+		}
+	}
+	return err
+}
+
+// path returns the IDs of a chain path from one template to another, both
+// included, nil when there is none.
+func (e *ChainExecutor) path(from, to string) []string {
+	parents := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == to {
+			var path []string
+			for ; id != from; id = parents[id] {
+				path = append([]string{id}, path...)
+			}
+			return append([]string{from}, path...)
+		}
+		for _, edge := range e.chains[id] {
+			if _, ok := parents[edge.Target]; !ok {
+				parents[edge.Target] = id
+				queue = append(queue, edge.Target)
+			}
+		}
+	}
+	return nil
+}
+
+// Cycles returns the cycles reported while registering templates, each as a
+// path starting and ending with the same ID.
+func (e *ChainExecutor) Cycles() [][]string {
+	if e == nil {
+		return nil
+	}
+	cycles := make([][]string, len(e.cycles))
+	for i, cycle := range e.cycles {
+		cycles[i] = append([]string(nil), cycle...)
+	}
+	return cycles
 }
 
 // Has reports whether a template with the given ID has been registered.
@@ -90,32 +317,82 @@ func (e *ChainExecutor) Entrypoints() []string {
 // Use Entrypoints() as startIDs to run only non-chain-target templates.
 // Safe to call on a nil receiver (no-op).
 func (e *ChainExecutor) Execute(startIDs []string, fn ExecuteFunc) {
+	e.Walk(NewChainState(""), startIDs, fn)
+}
+
+// Walk walks the chain graph starting from startIDs, recording the executed
+// templates and their results in state. Walks with distinct states can run
+// concurrently. Safe to call on a nil receiver (no-op).
+func (e *ChainExecutor) Walk(state *ChainState, startIDs []string, fn ExecuteFunc) {
 	if e == nil {
 		return
 	}
-	executed := make(map[string]bool)
 	if e.config.DepthFirst {
 		for _, id := range startIDs {
-			e.executeDFS(id, nil, fn, executed)
+			e.executeDFS(id, nil, fn, state)
 		}
 	} else {
-		e.executeBFS(startIDs, fn, executed)
+		e.executeBFS(startIDs, fn, state)
 	}
 }
 
-func (e *ChainExecutor) executeDFS(id string, vars map[string]interface{}, fn ExecuteFunc, executed map[string]bool) {
-	if executed[id] || !e.Has(id) {
+// ExecuteTargets walks the chain graph for each target, up to
+// TargetConcurrency targets at once, and returns their states in the order
+// of targets.
+func (e *ChainExecutor) ExecuteTargets(targets, startIDs []string, fn TargetExecuteFunc) []*ChainState {
+	states := make([]*ChainState, len(targets))
+	for i, target := range targets {
+		states[i] = NewChainState(target)
+	}
+	if e == nil {
+		return states
+	}
+	runConcurrently(len(targets), e.config.TargetConcurrency, func(i int) {
+		target := targets[i]
+		e.Walk(states[i], startIDs, func(id string, vars map[string]interface{}) *ChainResult {
+			return fn(target, id, vars)
+		})
+	})
+	return states
+}
+
+// runConcurrently calls fn for 0 to n-1, limit calls at once.
+func runConcurrently(n, limit int, fn func(i int)) {
+	if limit <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (e *ChainExecutor) executeDFS(id string, vars map[string]interface{}, fn ExecuteFunc, state *ChainState) {
+	if !e.Has(id) || !state.claim(id) {
 		return
 	}
-	executed[id] = true
 
 	result := fn(id, vars)
+	state.record(id, result)
 	if result == nil {
 		return
 	}
 
-	chainIDs := e.chains[id]
-	if len(chainIDs) == 0 {
+	edges := e.chains[id]
+	if len(edges) == 0 {
 		return
 	}
 
@@ -123,8 +400,10 @@ func (e *ChainExecutor) executeDFS(id string, vars map[string]interface{}, fn Ex
 	if e.config.PassVariables {
 		chainVars = result.Vars
 	}
-	for _, cid := range chainIDs {
-		e.executeDFS(cid, chainVars, fn, executed)
+	for _, edge := range edges {
+		if edge.follows(result) {
+			e.executeDFS(edge.Target, chainVars, fn, state)
+		}
 	}
 }
 
@@ -133,25 +412,35 @@ type bfsItem struct {
 	vars map[string]interface{}
 }
 
-func (e *ChainExecutor) executeBFS(startIDs []string, fn ExecuteFunc, executed map[string]bool) {
+func (e *ChainExecutor) executeBFS(startIDs []string, fn ExecuteFunc, state *ChainState) {
 	current := make([]bfsItem, len(startIDs))
 	for i, id := range startIDs {
 		current[i] = bfsItem{id: id}
 	}
 
 	for len(current) > 0 {
-		var next []bfsItem
+		// every template of the round runs once, with the vars of the first
+		// parent that chained to it
+		var round []bfsItem
 		for _, it := range current {
-			if executed[it.id] || !e.Has(it.id) {
-				continue
+			if e.Has(it.id) && state.claim(it.id) {
+				round = append(round, it)
 			}
-			executed[it.id] = true
+		}
 
+		results := make([]*ChainResult, len(round))
+		runConcurrently(len(round), e.config.Concurrency, func(i int) {
 			var vars map[string]interface{}
 			if e.config.PassVariables {
-				vars = it.vars
+				vars = round[i].vars
 			}
-			result := fn(it.id, vars)
+			results[i] = fn(round[i].id, vars)
+			state.record(round[i].id, results[i])
+		})
+
+		var next []bfsItem
+		for i, it := range round {
+			result := results[i]
 			if result == nil {
 				continue
 			}
@@ -160,9 +449,9 @@ func (e *ChainExecutor) executeBFS(startIDs []string, fn ExecuteFunc, executed m
 			if e.config.PassVariables {
 				chainVars = result.Vars
 			}
-			for _, cid := range e.chains[it.id] {
-				if !executed[cid] {
-					next = append(next, bfsItem{id: cid, vars: chainVars})
+			for _, edge := range e.chains[it.id] {
+				if !state.has(edge.Target) && edge.follows(result) {
+					next = append(next, bfsItem{id: edge.Target, vars: chainVars})
 				}
 			}
 		}
@@ -2,7 +2,10 @@ package templates
 
 import (
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestChainExecutor_Entrypoints(t *testing.T) {
@@ -298,3 +301,193 @@ func TestChainExecutor_BFS_CycleProtection(t *testing.T) {
 		t.Fatalf("BFS cycle order = %v, want %v", order, want)
 	}
 }
+
+func TestChainExecutor_MatcherEdges(t *testing.T) {
+	for _, df := range []bool{true, false} {
+		e := NewChainExecutor(ChainConfig{DepthFirst: df})
+		e.AddEdges("detect",
+			ChainEdge{Target: "wordpress", Matchers: []string{"wordpress"}},
+			ChainEdge{Target: "joomla", Matchers: []string{"joomla"}},
+			ChainEdge{Target: "php-wordpress", Matchers: []string{"php", "wordpress"}, Condition: "and"},
+			ChainEdge{Target: "php-nginx", Matchers: []string{"php", "nginx"}, Condition: "and"},
+			ChainEdge{Target: "always"},
+		)
+		e.AddEdges("detect", ChainEdge{Target: "appended"})
+		for _, id := range []string{"wordpress", "joomla", "php-wordpress", "php-nginx", "always", "appended"} {
+			e.AddEdges(id)
+		}
+
+		want := []string{"detect"}
+		if got := e.Entrypoints(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Entrypoints() = %v, want %v", got, want)
+		}
+
+		var order []string
+		e.Execute(e.Entrypoints(), func(id string, vars map[string]interface{}) *ChainResult {
+			order = append(order, id)
+			return &ChainResult{Matches: []string{"php", "wordpress"}}
+		})
+
+		want = []string{"detect", "wordpress", "php-wordpress", "always", "appended"}
+		if !reflect.DeepEqual(order, want) {
+			t.Fatalf("matcher edges order (depth first %v) = %v, want %v", df, order, want)
+		}
+	}
+}
+
+func TestChainExecutor_CycleDetection(t *testing.T) {
+	e := NewChainExecutor(ChainConfig{})
+	if err := e.Add("a", []string{"b"}); err != nil {
+		t.Fatalf("Add(a) = %v, want nil", err)
+	}
+	if err := e.Add("b", []string{"c"}); err != nil {
+		t.Fatalf("Add(b) = %v, want nil", err)
+	}
+	err := e.Add("c", []string{"a", "d"})
+	cycle, ok := err.(*ChainCycleError)
+	if !ok {
+		t.Fatalf("Add(c) = %v, want a *ChainCycleError", err)
+	}
+	want := []string{"c", "a", "b", "c"}
+	if !reflect.DeepEqual(cycle.Path, want) {
+		t.Fatalf("cycle path = %v, want %v", cycle.Path, want)
+	}
+	if err.Error() != "chain cycle: c -> a -> b -> c" {
+		t.Fatalf("cycle error = %q", err.Error())
+	}
+	if err := e.AddEdges("d", ChainEdge{Target: "d"}); err == nil {
+		t.Fatal("AddEdges(d -> d) = nil, want a cycle")
+	}
+
+	wantCycles := [][]string{{"c", "a", "b", "c"}, {"d", "d"}}
+	if got := e.Cycles(); !reflect.DeepEqual(got, wantCycles) {
+		t.Fatalf("Cycles() = %v, want %v", got, wantCycles)
+	}
+
+	// the cycle is registered and still walked once per template
+	var order []string
+	e.Execute([]string{"a"}, func(id string, vars map[string]interface{}) *ChainResult {
+		order = append(order, id)
+		return &ChainResult{}
+	})
+	want = []string{"a", "b", "c", "d"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("cycle order = %v, want %v", order, want)
+	}
+}
+
+func TestChainExecutor_ExtractEdges(t *testing.T) {
+	e := NewChainExecutor(ChainConfig{PassVariables: true})
+	e.AddEdges("detect",
+		ChainEdge{Target: "versioned", Extracts: []string{"version"}},
+		ChainEdge{Target: "authenticated", Extracts: []string{"version", "token"}},
+		ChainEdge{Target: "wordpress-versioned", Matchers: []string{"wordpress"}, Extracts: []string{"version"}},
+		ChainEdge{Target: "joomla-versioned", Matchers: []string{"joomla"}, Extracts: []string{"version"}},
+	)
+	for _, id := range []string{"versioned", "authenticated", "wordpress-versioned", "joomla-versioned"} {
+		e.AddEdges(id)
+	}
+
+	var order []string
+	e.Execute(e.Entrypoints(), func(id string, vars map[string]interface{}) *ChainResult {
+		order = append(order, id)
+		return &ChainResult{Vars: map[string]interface{}{"version": "6.4"}, Matches: []string{"wordpress"}}
+	})
+	want := []string{"detect", "versioned", "wordpress-versioned"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("extract edges order = %v, want %v", order, want)
+	}
+}
+
+func TestChainExecutor_ParallelBFS(t *testing.T) {
+	const children, limit = 8, 4
+	e := NewChainExecutor(ChainConfig{Concurrency: limit})
+	var ids []string
+	for i := 0; i < children; i++ {
+		id := string(rune('a' + i))
+		ids = append(ids, id)
+		e.Add(id, []string{"leaf"})
+	}
+	e.Add("root", ids)
+	e.Add("leaf", nil)
+
+	var running, peak int32
+	count := make(map[string]int)
+	var mu sync.Mutex
+	start := time.Now()
+	state := NewChainState("target")
+	e.Walk(state, []string{"root"}, func(id string, vars map[string]interface{}) *ChainResult {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		mu.Lock()
+		count[id]++
+		mu.Unlock()
+		return &ChainResult{}
+	})
+
+	if elapsed := time.Since(start); elapsed >= (children+2)*50*time.Millisecond {
+		t.Fatalf("parallel walk took %v, want less than a serial walk", elapsed)
+	}
+	if peak > limit || peak < 2 {
+		t.Fatalf("peak concurrency = %d, want 2 to %d", peak, limit)
+	}
+	if len(count) != children+2 {
+		t.Fatalf("executed %d templates, want %d", len(count), children+2)
+	}
+	for id, n := range count {
+		if n != 1 {
+			t.Errorf("%s executed %d times, want 1", id, n)
+		}
+	}
+	want := append(append([]string{"root"}, ids...), "leaf")
+	if got := state.Executed(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Executed() = %v, want %v", got, want)
+	}
+}
+
+func TestChainExecutor_ExecuteTargets(t *testing.T) {
+	for _, df := range []bool{true, false} {
+		e := NewChainExecutor(ChainConfig{DepthFirst: df, PassVariables: true, Concurrency: 2, TargetConcurrency: 3})
+		e.Add("finger", []string{"poc"})
+		e.Add("poc", nil)
+
+		targets := []string{"http://a", "http://b", "http://c"}
+		states := e.ExecuteTargets(targets, e.Entrypoints(), func(target, id string, vars map[string]interface{}) *ChainResult {
+			switch {
+			case id == "finger" && target != "http://b":
+				return &ChainResult{Vars: map[string]interface{}{"target": target}}
+			case id == "poc" && vars["target"] == target:
+				return &ChainResult{}
+			}
+			return nil
+		})
+
+		if len(states) != len(targets) {
+			t.Fatalf("ExecuteTargets() returned %d states, want %d", len(states), len(targets))
+		}
+		for i, state := range states {
+			if state.Target != targets[i] {
+				t.Fatalf("states[%d].Target = %s, want %s", i, state.Target, targets[i])
+			}
+			want := []string{"finger", "poc"}
+			if state.Target == "http://b" {
+				want = []string{"finger"}
+				if state.Result("finger") != nil {
+					t.Errorf("%s: finger result = %v, want nil", state.Target, state.Result("finger"))
+				}
+			} else if state.Result("poc") == nil {
+				t.Errorf("%s: poc did not match", state.Target)
+			}
+			if got := state.Executed(); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: Executed() = %v, want %v", state.Target, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package templates
+
+import (
+	"fmt"
+
+	"github.com/chainreactors/neutron/operators"
+	"github.com/chainreactors/neutron/protocols"
+	"github.com/chainreactors/neutron/protocols/network"
+	"github.com/chainreactors/neutron/protocols/ssl"
+	"github.com/chainreactors/utils/iutils"
+)
+
+// dslChecker is implemented by the requests whose DSL expressions can be
+// checked at compile time.
+type dslChecker interface {
+	ResponseDSLScope(scope *protocols.DSLScope) *protocols.DSLScope
+	CheckDSL(field string, scope *protocols.DSLScope) error
+}
+
+// CheckDSL statically checks every DSL expression of the template: the
+// variables, the request placeholders and the dsl matchers and extractors.
+// Unknown helper functions and wrong argument counts are reported with the
+// template field they were found in, e.g.
+// `http[0].matchers[1].dsl[0]: undefined function contians`. Variables that
+// nothing defines are errors with Options.StrictDSL, Warnings otherwise.
+func (t *Template) CheckDSL(options *protocols.ExecuterOptions) error {
+	blocks := t.dslBlocks()
+
+	t.Warnings = nil
+	scope := protocols.NewDSLScope(protocols.BuiltinVariables...)
+	if options == nil || options.Options == nil || !options.Options.StrictDSL {
+		seen := make(map[string]bool)
+		scope = scope.WithWarnings(func(warning string) {
+			if !seen[warning] {
+				seen[warning] = true
+				t.Warnings = append(t.Warnings, warning)
+			}
+		})
+	}
+	t.Variables.ForEach(func(key string, _ interface{}) {
+		scope.Add(key)
+	})
+	for name := range t.Constants {
+		scope.Add(name)
+	}
+	if options != nil && options.Options != nil {
+		for name := range options.Options.VarsPayload {
+			scope.Add(name)
+		}
+		for name := range options.Options.Vars {
+			scope.Add(name)
+		}
+		scope.Add(options.Options.ExternalVariables...)
+	}
+	for _, block := range blocks {
+		scope.Add(block.extractors...)
+	}
+	// request history is template wide: any block may use `<field>_<n>`
+	// of the responses of every other block
+	responses := make([]*protocols.DSLScope, len(blocks))
+	protocolResponses := make(map[string][]*protocols.DSLScope)
+	for i, block := range blocks {
+		if block.request != nil {
+			responses[i] = block.request.ResponseDSLScope(protocols.NewDSLScope())
+		} else {
+			responses[i] = protocols.NewDSLScope()
+		}
+		protocolResponses[block.protocol] = append(protocolResponses[block.protocol], responses[i])
+	}
+	// the executer also publishes each event as `<protocol>_<field>` and
+	// `<protocol>_<n>_<field>` for the blocks that follow
+	scope = scope.WithHistory(responses...).WithProtocols(protocolResponses)
+
+	// variables are evaluated per request, with the payloads of any block
+	variableScope := scope.With(nil)
+	for _, block := range blocks {
+		variableScope.Add(block.payloads...)
+	}
+
+	var err error
+	t.Variables.ForEach(func(key string, value interface{}) {
+		if err == nil {
+			err = protocols.CheckPlaceholders("variables."+key, iutils.ToString(value), variableScope)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if block.request == nil {
+			continue
+		}
+		if err := block.request.CheckDSL(block.field, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dslBlock is a request block, request is nil for the requests of the
+// registered protocols that cannot be checked.
+type dslBlock struct {
+	field      string
+	protocol   string
+	request    dslChecker
+	extractors []string
+	payloads   []string
+}
+
+// dslBlocks lists the request blocks of the template under the field they
+// were written in.
+func (t *Template) dslBlocks() []dslBlock {
+	var blocks []dslBlock
+	add := func(field string, i int, request protocols.Request, ops *operators.Operators, payloads map[string]interface{}) {
+		block := dslBlock{
+			field:      fmt.Sprintf("%s[%d]", field, i),
+			protocol:   request.Type().String(),
+			request:    request.(dslChecker),
+			extractors: protocols.ExtractorNames(ops),
+		}
+		for name := range payloads {
+			block.payloads = append(block.payloads, name)
+		}
+		blocks = append(blocks, block)
+	}
+	for i, req := range t.RequestsHTTP {
+		if req != nil {
+			add("http", i, req, &req.Operators, req.Payloads)
+		}
+	}
+	for i, req := range t.Requests {
+		if req != nil {
+			add("requests", i, req, &req.Operators, req.Payloads)
+		}
+	}
+	networkFields := []struct {
+		field    string
+		requests []*network.Request
+	}{{"network", t.RequestsNetwork}, {"tcp", t.RequestsTCP}, {"udp", t.RequestsUDP}}
+	for _, f := range networkFields {
+		for i, req := range f.requests {
+			if req != nil {
+				add(f.field, i, req, &req.Operators, req.Payloads)
+			}
+		}
+	}
+	sslFields := []struct {
+		field    string
+		requests []*ssl.Request
+	}{{"ssl", t.RequestsSSL}, {"tls", t.RequestsTLS}}
+	for _, f := range sslFields {
+		for i, req := range f.requests {
+			if req != nil {
+				add(f.field, i, req, &req.Operators, nil)
+			}
+		}
+	}
+	for _, key := range t.protocolOrder() {
+		for i, req := range t.Protocols[key] {
+			if req == nil {
+				continue
+			}
+			block := dslBlock{field: fmt.Sprintf("%s[%d]", key, i), protocol: req.Type().String()}
+			block.request, _ = req.(dslChecker)
+			for _, ops := range req.GetCompiledOperators() {
+				block.extractors = append(block.extractors, protocols.ExtractorNames(ops)...)
+			}
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
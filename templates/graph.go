@@ -0,0 +1,177 @@
+package templates
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// chainGraph is the chain graph of a ChainExecutor as exported by WriteDOT
+// and WriteMermaid.
+type chainGraph struct {
+	// nodes are the registered templates in registration order, followed by
+	// the dangling chain targets
+	nodes    []string
+	entry    map[string]bool
+	dangling map[string]bool
+	cyclic   map[string]bool
+	edges    []chainGraphEdge
+}
+
+type chainGraphEdge struct {
+	from, to string
+	label    string
+	cycle    bool
+}
+
+func (e *ChainExecutor) graph() *chainGraph {
+	g := &chainGraph{
+		entry:    make(map[string]bool),
+		dangling: make(map[string]bool),
+		cyclic:   make(map[string]bool),
+	}
+	if e == nil {
+		return g
+	}
+	seen := make(map[string]bool)
+	for _, id := range e.order {
+		if !seen[id] {
+			seen[id] = true
+			g.nodes = append(g.nodes, id)
+			g.entry[id] = e.IsEntrypoint(id)
+		}
+	}
+	for _, id := range g.nodes {
+		for _, edge := range e.chains[id] {
+			if !e.Has(edge.Target) && !seen[edge.Target] {
+				seen[edge.Target] = true
+				g.nodes = append(g.nodes, edge.Target)
+				g.dangling[edge.Target] = true
+			}
+			// an edge is part of a cycle when its target leads back to it
+			cycle := e.path(edge.Target, id) != nil
+			if cycle {
+				g.cyclic[id], g.cyclic[edge.Target] = true, true
+			}
+			g.edges = append(g.edges, chainGraphEdge{from: id, to: edge.Target, label: edgeLabel(edge), cycle: cycle})
+		}
+	}
+	return g
+}
+
+// edgeLabel describes the conditions of an edge, e.g. `php & mysql`.
+func edgeLabel(edge ChainEdge) string {
+	var conditions []string
+	if len(edge.Matchers) > 0 {
+		separator := " | "
+		if edge.Condition == "and" {
+			separator = " & "
+		}
+		conditions = append(conditions, strings.Join(edge.Matchers, separator))
+	}
+	if len(edge.Extracts) > 0 {
+		conditions = append(conditions, "extracts "+strings.Join(edge.Extracts, ", "))
+	}
+	return strings.Join(conditions, "; ")
+}
+
+// WriteDOT writes the chain graph in Graphviz DOT. Entry points are filled
+// green, dangling chain targets, referenced but not registered, are dashed
+// and cycles are red. Edges are labelled with their conditions.
+func (e *ChainExecutor) WriteDOT(w io.Writer) error {
+	g := e.graph()
+	b := bufio.NewWriter(w)
+	b.WriteString("digraph chains {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, id := range g.nodes {
+		var attrs []string
+		switch {
+		case g.dangling[id]:
+			attrs = append(attrs, "style=dashed")
+		case g.entry[id]:
+			attrs = append(attrs, "style=filled", `fillcolor="#d4f7d4"`)
+		}
+		if g.cyclic[id] {
+			attrs = append(attrs, "color=red")
+		}
+		b.WriteString("\t" + strconv.Quote(id))
+		if len(attrs) > 0 {
+			b.WriteString(" [" + strings.Join(attrs, ", ") + "]")
+		}
+		b.WriteString(";\n")
+	}
+	for _, edge := range g.edges {
+		var attrs []string
+		if edge.label != "" {
+			attrs = append(attrs, "label="+strconv.Quote(edge.label))
+		}
+		if edge.cycle {
+			attrs = append(attrs, "color=red")
+		}
+		b.WriteString("\t" + strconv.Quote(edge.from) + " -> " + strconv.Quote(edge.to))
+		if len(attrs) > 0 {
+			b.WriteString(" [" + strings.Join(attrs, ", ") + "]")
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	return b.Flush()
+}
+
+// WriteMermaid writes the chain graph as a Mermaid flowchart, highlighting
+// entry points, dangling chain targets and cycles like WriteDOT.
+func (e *ChainExecutor) WriteMermaid(w io.Writer) error {
+	g := e.graph()
+	names := make(map[string]string, len(g.nodes))
+	var entry, dangling, cyclic []string
+	b := bufio.NewWriter(w)
+	b.WriteString("flowchart LR\n")
+	for i, id := range g.nodes {
+		name := fmt.Sprintf("n%d", i)
+		names[id] = name
+		fmt.Fprintf(b, "    %s[\"%s\"]\n", name, mermaidEscape(id))
+		switch {
+		case g.dangling[id]:
+			dangling = append(dangling, name)
+		case g.entry[id]:
+			entry = append(entry, name)
+		}
+		if g.cyclic[id] {
+			cyclic = append(cyclic, name)
+		}
+	}
+	var cycleEdges []string
+	for i, edge := range g.edges {
+		if edge.label != "" {
+			fmt.Fprintf(b, "    %s -->|\"%s\"| %s\n", names[edge.from], mermaidEscape(edge.label), names[edge.to])
+		} else {
+			fmt.Fprintf(b, "    %s --> %s\n", names[edge.from], names[edge.to])
+		}
+		if edge.cycle {
+			cycleEdges = append(cycleEdges, strconv.Itoa(i))
+		}
+	}
+	b.WriteString("    classDef entry fill:#d4f7d4\n")
+	b.WriteString("    classDef dangling stroke-dasharray:5 5\n")
+	b.WriteString("    classDef cycle stroke:#e00\n")
+	for _, class := range []struct {
+		name  string
+		nodes []string
+	}{{"entry", entry}, {"dangling", dangling}, {"cycle", cyclic}} {
+		if len(class.nodes) > 0 {
+			fmt.Fprintf(b, "    class %s %s\n", strings.Join(class.nodes, ","), class.name)
+		}
+	}
+	if len(cycleEdges) > 0 {
+		fmt.Fprintf(b, "    linkStyle %s stroke:#e00\n", strings.Join(cycleEdges, ","))
+	}
+	return b.Flush()
+}
+
+// mermaidEscape escapes the quotes of a quoted mermaid label.
+func mermaidEscape(s string) string {
+	return strings.Replace(s, `"`, "#quot;", -1)
+}
@@ -0,0 +1,77 @@
+package templates
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newGraphExecutor() *ChainExecutor {
+	e := NewChainExecutor(ChainConfig{})
+	e.Add("root", []string{"a"})
+	e.AddEdges("a",
+		ChainEdge{Target: "b", Matchers: []string{"php", "mysql"}, Condition: "and"},
+		ChainEdge{Target: "missing"},
+	)
+	e.AddEdges("b", ChainEdge{Target: "a", Extracts: []string{"version"}})
+	return e
+}
+
+func TestChainExecutor_WriteDOT(t *testing.T) {
+	var b bytes.Buffer
+	if err := newGraphExecutor().WriteDOT(&b); err != nil {
+		t.Fatalf("WriteDOT() = %v", err)
+	}
+	want := `digraph chains {
+	rankdir=LR;
+	node [shape=box];
+	"root" [style=filled, fillcolor="#d4f7d4"];
+	"a" [color=red];
+	"b" [color=red];
+	"missing" [style=dashed];
+	"root" -> "a";
+	"a" -> "b" [label="php & mysql", color=red];
+	"a" -> "missing";
+	"b" -> "a" [label="extracts version", color=red];
+}
+`
+	if b.String() != want {
+		t.Fatalf("WriteDOT() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestChainExecutor_WriteMermaid(t *testing.T) {
+	var b bytes.Buffer
+	if err := newGraphExecutor().WriteMermaid(&b); err != nil {
+		t.Fatalf("WriteMermaid() = %v", err)
+	}
+	want := `flowchart LR
+    n0["root"]
+    n1["a"]
+    n2["b"]
+    n3["missing"]
+    n0 --> n1
+    n1 -->|"php & mysql"| n2
+    n1 --> n3
+    n2 -->|"extracts version"| n1
+    classDef entry fill:#d4f7d4
+    classDef dangling stroke-dasharray:5 5
+    classDef cycle stroke:#e00
+    class n0 entry
+    class n3 dangling
+    class n1,n2 cycle
+    linkStyle 1,3 stroke:#e00
+`
+	if b.String() != want {
+		t.Fatalf("WriteMermaid() =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	e := NewChainExecutor(ChainConfig{})
+	e.Add(`say "hi"`, nil)
+	if err := e.WriteMermaid(&b); err != nil {
+		t.Fatalf("WriteMermaid() = %v", err)
+	}
+	if !bytes.Contains(b.Bytes(), []byte(`n0["say #quot;hi#quot;"]`)) {
+		t.Fatalf("WriteMermaid() did not escape quotes:\n%s", b.String())
+	}
+}
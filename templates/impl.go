@@ -3,12 +3,14 @@ package templates
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/chainreactors/neutron/common"
 	"github.com/chainreactors/neutron/operators"
 	"github.com/chainreactors/neutron/protocols"
 	"github.com/chainreactors/neutron/protocols/executer"
+	"github.com/chainreactors/neutron/protocols/http"
 	"github.com/chainreactors/neutron/protocols/network"
 	"github.com/chainreactors/neutron/protocols/ssl"
 )
@@ -25,10 +27,38 @@ func (t *Template) Compile(options *protocols.ExecuterOptions) error {
 	if t == nil {
 		return errors.New("template is nil")
 	}
-	var requests []protocols.Request
 	options = templateExecuterOptions(options, t.Variables)
 	t.TotalRequests = 0
+	constants, err := t.evaluateConstants(options.Options.Vars)
+	if err != nil {
+		return err
+	}
+	options.Constants = constants
+	if err := t.CheckDSL(options); err != nil {
+		return err
+	}
+
+	requests, err := t.compileRequests()
+	if err != nil {
+		return err
+	}
+	if len(requests) == 0 {
+		return errors.New("cannot compiled any executor")
+	}
+	t.Executor = executer.NewExecuter(requests, options)
+	if err := t.Executor.Compile(); err != nil {
+		return err
+	}
+	t.TotalRequests = t.Executor.Requests()
+	return nil
+}
 
+// compileRequests lists the requests of the template, the blocks in the
+// order they are declared.
+func (t *Template) compileRequests() ([]protocols.Request, error) {
+	// the network and ssl blocks keep their own requests in declaration order,
+	// the aliases are merged into them for the callers reading them
+	declaredNetwork, declaredSSL := t.RequestsNetwork, t.RequestsSSL
 	// Merge tcp and udp fields into RequestsNetwork (aliases support)
 	// FingerprintHub and other tools may use 'tcp' or 'udp' instead of 'network'
 	if len(t.RequestsTCP) > 0 {
@@ -37,47 +67,95 @@ func (t *Template) Compile(options *protocols.ExecuterOptions) error {
 	if len(t.RequestsUDP) > 0 {
 		t.RequestsNetwork = appendMissingNetworkRequests(t.RequestsNetwork, t.RequestsUDP)
 	}
+	if len(t.RequestsTLS) > 0 {
+		t.RequestsSSL = appendMissingSSLRequests(t.RequestsSSL, t.RequestsTLS)
+	}
 
-	if requestHTTP := t.GetRequests(); len(requestHTTP) > 0 {
-		for i, req := range requestHTTP {
+	var requests []protocols.Request
+	seen := make(map[protocols.Request]struct{})
+	add := func(name string, i int, req protocols.Request) error {
+		if req == nil {
+			return fmt.Errorf("%s request at index %d is nil", name, i)
+		}
+		if _, ok := seen[req]; !ok {
+			seen[req] = struct{}{}
+			requests = append(requests, req)
+		}
+		return nil
+	}
+	addHTTP := func(block []*http.Request) error {
+		for i, req := range block {
 			if req == nil {
-				return fmt.Errorf("http request at index %d is nil", i)
+				return add("http", i, nil)
 			}
 			if req.Unsafe {
 				return fmt.Errorf("not impl unsafe request %s", req.Name)
 			}
-			requests = append(requests, req)
+			if err := add("http", i, req); err != nil {
+				return err
+			}
 		}
+		return nil
 	}
-	if len(t.RequestsNetwork) > 0 {
-		for i, req := range t.RequestsNetwork {
+	addNetwork := func(block []*network.Request) error {
+		for i, req := range block {
 			if req == nil {
-				return fmt.Errorf("network request at index %d is nil", i)
+				return add("network", i, nil)
+			}
+			if err := add("network", i, req); err != nil {
+				return err
 			}
-			requests = append(requests, req)
 		}
+		return nil
 	}
-	if len(t.RequestsTLS) > 0 {
-		t.RequestsSSL = appendMissingSSLRequests(t.RequestsSSL, t.RequestsTLS)
-	}
-	if len(t.RequestsSSL) > 0 {
-		for i, req := range t.RequestsSSL {
+	addSSL := func(block []*ssl.Request) error {
+		for i, req := range block {
 			if req == nil {
-				return fmt.Errorf("ssl request at index %d is nil", i)
+				return add("ssl", i, nil)
+			}
+			if err := add("ssl", i, req); err != nil {
+				return err
 			}
-			requests = append(requests, req)
 		}
+		return nil
 	}
 
-	if len(requests) == 0 {
-		return errors.New("cannot compiled any executor")
-	}
-	t.Executor = executer.NewExecuter(requests, options)
-	if err := t.Executor.Compile(); err != nil {
-		return err
+	for _, key := range t.protocolOrder() {
+		var err error
+		switch key {
+		case "http":
+			err = addHTTP(t.RequestsHTTP)
+		case "requests":
+			// the legacy block is ignored next to an http block, see GetRequests
+			if len(t.RequestsHTTP) == 0 {
+				err = addHTTP(t.Requests)
+			}
+		case "network":
+			err = addNetwork(declaredNetwork)
+		case "tcp":
+			err = addNetwork(t.RequestsTCP)
+		case "udp":
+			err = addNetwork(t.RequestsUDP)
+		case "ssl":
+			err = addSSL(declaredSSL)
+		case "tls":
+			err = addSSL(t.RequestsTLS)
+		default:
+			protocol := registeredProtocols[key]
+			for i, req := range t.Protocols[key] {
+				if err = add(key, i, req); err != nil {
+					break
+				}
+				if protocol != nil && req.Type() != protocol.typ {
+					return nil, fmt.Errorf("%s request at index %d has protocol %s, registered as %s", key, i, req.Type(), protocol.typ)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
-	t.TotalRequests = t.Executor.Requests()
-	return nil
+	return requests, nil
 }
 
 func appendMissingNetworkRequests(dst, src []*network.Request) []*network.Request {
@@ -134,9 +212,95 @@ func templateExecuterOptions(options *protocols.ExecuterOptions, variables proto
 		templateOptions.Options = &protocols.Options{Timeout: 5}
 	}
 	templateOptions.Variables = variables
+	if len(templateOptions.Options.Vars) > 0 {
+		templateOptions.Variables = variables.Override(templateOptions.Options.Vars)
+	}
 	return &templateOptions
 }
 
+// evaluateConstants evaluates the constants once, each one after the
+// constants it references. A constant in overrides takes its value instead.
+// Placeholders naming no constant, e.g. {{BaseURL}}, are left for the
+// requests to resolve; constants referencing each other are an error.
+func (t *Template) evaluateConstants(overrides map[string]interface{}) (map[string]interface{}, error) {
+	if len(t.Constants) == 0 {
+		return nil, nil
+	}
+	constants := make(map[string]interface{}, len(t.Constants))
+	pending := make(map[string]string, len(t.Constants))
+	for name, value := range t.Constants {
+		if override, ok := overrides[name]; ok {
+			constants[name] = override
+		} else if s, ok := value.(string); ok {
+			pending[name] = s
+		} else {
+			constants[name] = value
+		}
+	}
+
+	for len(pending) > 0 {
+		// evaluate, in name order, every constant whose references are all
+		// evaluated; none being ready means the rest reference each other
+		var ready []string
+		for name, value := range pending {
+			if !referencesAny(value, pending) {
+				ready = append(ready, name)
+			}
+		}
+		if len(ready) == 0 {
+			names := make([]string, 0, len(pending))
+			for name := range pending {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("constants.%s: cyclic reference between %s", names[0], strings.Join(names, ", "))
+		}
+		sort.Strings(ready)
+		for _, name := range ready {
+			evaluated, err := common.Evaluate(pending[name], constants)
+			if err != nil {
+				return nil, fmt.Errorf("constants.%s: %v", name, err)
+			}
+			constants[name] = evaluated
+			delete(pending, name)
+		}
+	}
+	return constants, nil
+}
+
+// referencesAny reports whether value names one of the constants in names.
+func referencesAny(value string, names map[string]string) bool {
+	if !strings.Contains(value, common.ParenthesisOpen) && !strings.Contains(value, common.General) {
+		return false
+	}
+	for name := range names {
+		if containsIdentifier(value, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsIdentifier reports whether name appears in value as a whole
+// identifier, not as part of a longer one.
+func containsIdentifier(value, name string) bool {
+	for i := 0; ; {
+		j := strings.Index(value[i:], name)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(name)
+		if (start == 0 || !isIdentifierByte(value[start-1])) && (end == len(value) || !isIdentifierByte(value[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
 func (t *Template) Execute(input string, payload map[string]interface{}) (*operators.Result, error) {
 	if t.Executor.Options().Options.Opsec && t.Opsec {
 		common.Debug("(opsec!!!) skip template %s", t.Id)
@@ -187,3 +351,21 @@ func (t *Template) ExecuteWithEvents(input string, payload map[string]interface{
 	}
 	return result, ctx.GenerateResult(), nil
 }
+
+// ExecuteWithExplanation executes the template like ExecuteWithEvents in
+// explain mode: every event is returned, matched or not, with the
+// *operators.Explanation of its matchers under the protocols.ExplainKey
+// metadata.
+func (t *Template) ExecuteWithExplanation(input string, payload map[string]interface{}) (*operators.Result, []*protocols.ResultEvent, error) {
+	if t.Executor.Options().Options.Opsec && t.Opsec {
+		common.Debug("(opsec!!!) skip template %s", t.Id)
+		return nil, nil, protocols.OpsecError
+	}
+	ctx := protocols.NewScanContext(input, payload)
+	ctx.Explain = true
+	result, err := t.Executor.Execute(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, ctx.GenerateResult(), nil
+}
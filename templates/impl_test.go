@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/chainreactors/neutron/operators"
 	"github.com/chainreactors/neutron/protocols"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -1429,3 +1431,369 @@ func containsAll(s string, substrs ...string) bool {
 	}
 	return true
 }
+
+func TestExecuteRequestConditionAcrossProtocols(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/banner" {
+			fmt.Fprint(w, "network-step")
+			return
+		}
+		fmt.Fprint(w, "http-step")
+	}))
+	defer server.Close()
+
+	yamlContent := `
+id: req-condition-mixed
+info:
+  name: Request condition across protocols
+  author: test
+  severity: info
+
+http:
+  - method: GET
+    path:
+      - "{{BaseURL}}/http"
+    req-condition: true
+
+network:
+  - host:
+      - "{{Hostname}}"
+    inputs:
+      - data: "GET /banner HTTP/1.0\r\n\r\n"
+    matchers:
+      - type: dsl
+        dsl:
+          - contains(body_1, "http-step") && contains(data_2, "network-step")
+`
+	var tmpl Template
+	require.NoError(t, yaml.Unmarshal([]byte(yamlContent), &tmpl))
+	require.NoError(t, tmpl.Compile(nil))
+
+	result, err := tmpl.Execute(server.URL, nil)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	require.True(t, result.Matched)
+}
+
+func TestExecuteProtocolPrefixedValues(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/banner" {
+			fmt.Fprint(w, "network-step")
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, "http-step")
+	}))
+	defer server.Close()
+
+	yamlContent := `
+id: protocol-prefixed-values
+info:
+  name: Protocol prefixed values
+  author: test
+  severity: info
+
+network:
+  - host:
+      - "{{Hostname}}"
+    inputs:
+      - data: "GET /banner HTTP/1.0\r\n\r\n"
+
+http:
+  - method: GET
+    path:
+      - "{{BaseURL}}/first"
+  - method: GET
+    path:
+      - "{{BaseURL}}/{{http_1_status_code}}"
+    matchers:
+      - type: dsl
+        dsl:
+          - contains(network_data, "network-step") && contains(network_1_data, "network-step")
+          - http_1_status_code == 202 && http_body == "http-step" && status_code == 202
+        condition: and
+`
+	var tmpl Template
+	require.NoError(t, yaml.Unmarshal([]byte(yamlContent), &tmpl))
+	require.NoError(t, tmpl.Compile(nil))
+
+	result, err := tmpl.Execute(server.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/banner", "/first", "/202"}, paths)
+	require.NotNil(t, result)
+	require.True(t, result.Matched)
+
+	invalid := `
+id: protocol-prefixed-values
+network:
+  - host:
+      - "{{Hostname}}"
+    inputs:
+      - data: "PING\r\n"
+    matchers:
+      - type: dsl
+        dsl:
+          - contains(network_data, "PONG") || contains(network_2_data, "PONG")
+`
+	tmpl = Template{}
+	require.NoError(t, yaml.Unmarshal([]byte(invalid), &tmpl))
+	require.NoError(t, tmpl.Compile(nil))
+	require.Equal(t, []string{"network[0].matchers[0].dsl[0]: undefined variable network_2_data"}, tmpl.Warnings)
+	strict := &protocols.ExecuterOptions{Options: &protocols.Options{Timeout: 5, StrictDSL: true}}
+	require.EqualError(t, tmpl.Compile(strict), "network[0].matchers[0].dsl[0]: undefined variable network_2_data")
+}
+
+func TestCompileChecksDSL(t *testing.T) {
+	compile := func(content string, options *protocols.ExecuterOptions) error {
+		var tmpl Template
+		require.NoError(t, yaml.Unmarshal([]byte(content), &tmpl))
+		return tmpl.Compile(options)
+	}
+
+	cases := map[string]string{
+		`
+id: dsl-typo
+http:
+  - path:
+      - "{{BaseURL}}"
+    matchers:
+      - type: status
+        status:
+          - 200
+      - type: dsl
+        dsl:
+          - status_code == 200
+          - contians(body, "admin")
+`: "http[0].matchers[1].dsl[1]: undefined function contians",
+		`
+id: dsl-arity
+variables:
+  token: '{{rand_base()}}'
+http:
+  - path:
+      - "{{BaseURL}}/{{token}}"
+`: "variables.token: function rand_base expects 1 to 2 arguments, got 0",
+		`
+id: dsl-path
+http:
+  - path:
+      - "{{BaseURL}}/{{to_lower(Filename)}}"
+`: "http[0].path[0]: undefined variable Filename",
+		`
+id: dsl-network
+tcp:
+  - host:
+      - "{{Hostname}}"
+    inputs:
+      - data: "PING\r\n"
+    matchers:
+      - type: dsl
+        dsl:
+          - contains(body, "PONG")
+`: "tcp[0].matchers[0].dsl[0]: undefined variable body",
+		`
+id: dsl-extractor
+ssl:
+  - address: "{{Host}}:{{Port}}"
+    extractors:
+      - type: dsl
+        dsl:
+          - trim_space()
+`: "ssl[0].extractors[0].dsl[0]: function trim_space expects 1 arguments, got 0",
+	}
+	strict := &protocols.ExecuterOptions{Options: &protocols.Options{Timeout: 5, StrictDSL: true}}
+	for content, expected := range cases {
+		require.EqualError(t, compile(content, strict), expected)
+	}
+
+	// undefined variables are only warnings without StrictDSL
+	var tmpl Template
+	require.NoError(t, yaml.Unmarshal([]byte(`
+id: dsl-path
+http:
+  - path:
+      - "{{BaseURL}}/{{to_lower(Filename)}}?x={{interactsh-url}}"
+    matchers:
+      - type: dsl
+        dsl:
+          - contains(Bodyy, "admin")
+          - contains(Bodyy, "root")
+`), &tmpl))
+	require.NoError(t, tmpl.Compile(nil))
+	require.Equal(t, []string{
+		"http[0].path[0]: undefined variable Filename",
+		"http[0].matchers[0].dsl[0]: undefined variable Bodyy",
+		"http[0].matchers[0].dsl[1]: undefined variable Bodyy",
+	}, tmpl.Warnings)
+	require.NoError(t, compile(`
+id: dsl-interactsh
+http:
+  - path:
+      - "{{BaseURL}}/?x={{interactsh-url}}"
+`, strict))
+
+	valid := `
+id: dsl-valid
+variables:
+  name: '{{rand_text_alpha(8)}}'
+http:
+  - path:
+      - "{{BaseURL}}/{{name}}?v={{version}}"
+    payloads:
+      version:
+        - "1"
+    extractors:
+      - type: regex
+        name: csrf
+        internal: true
+        regex:
+          - 'csrf=(\w+)'
+  - raw:
+      - |
+        POST /login HTTP/1.1
+        Host: {{Hostname}}
+
+        csrf={{csrf}}&user={{username}}&{{7*7}}
+    matchers:
+      - type: dsl
+        dsl:
+          - contains(x_powered_by, "PHP") && status_code_1 == 200 && missing ?? true
+`
+	require.EqualError(t, compile(valid, strict), "http[1].raw[0]: undefined variable username")
+	require.NoError(t, compile(valid, nil))
+	require.NoError(t, compile(valid, &protocols.ExecuterOptions{
+		Options: &protocols.Options{Timeout: 5, StrictDSL: true, ExternalVariables: []string{"username"}},
+	}))
+}
+
+func TestExecuteWithExplanation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		fmt.Fprint(w, "safe page")
+	}))
+	defer server.Close()
+
+	yamlContent := `
+id: explain-test
+info:
+  name: Explain Test
+  author: test
+  severity: info
+
+http:
+  - method: GET
+    path:
+      - "{{BaseURL}}"
+    matchers-condition: and
+    matchers:
+      - type: status
+        status:
+          - 200
+      - type: word
+        name: secret
+        words:
+          - "secret"
+`
+	var tmpl Template
+	require.NoError(t, yaml.Unmarshal([]byte(yamlContent), &tmpl))
+	require.NoError(t, tmpl.Compile(nil))
+
+	result, events, err := tmpl.ExecuteWithExplanation(server.URL, nil)
+	require.NoError(t, err)
+	require.Nil(t, result)
+	require.Len(t, events, 1, "misses are reported in explain mode")
+
+	explanation, ok := events[0].Metadata[protocols.ExplainKey].(*operators.Explanation)
+	require.True(t, ok)
+	require.False(t, explanation.Matched)
+	require.Equal(t, `matcher "secret" did not match`, explanation.Reason)
+	require.True(t, explanation.Matchers[0].Matched)
+	require.Equal(t, "body", explanation.Matchers[1].Part)
+
+	_, events, err = tmpl.ExecuteWithEvents(server.URL, nil)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func TestExecuteConstantsAndVarOverrides(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.URL.RawQuery)
+	}))
+	defer server.Close()
+
+	yamlContent := `
+id: constants-test
+info:
+  name: Constants Test
+  author: test
+  severity: info
+constants:
+  prefix: neutron
+  marker: '{{md5(prefix)}}'
+variables:
+  user: admin
+  greeting: '{{user}}-{{marker}}'
+http:
+  - method: GET
+    path:
+      - '{{BaseURL}}/?g={{greeting}}'
+`
+	execute := func(vars map[string]interface{}) string {
+		var tmpl Template
+		require.NoError(t, yaml.Unmarshal([]byte(yamlContent), &tmpl))
+		require.NoError(t, tmpl.Compile(&protocols.ExecuterOptions{Options: &protocols.Options{Timeout: 5, Vars: vars}}))
+		_, err := tmpl.Execute(server.URL, nil)
+		require.NoError(t, err)
+		require.NotEmpty(t, got)
+		return got[len(got)-1]
+	}
+
+	marker := fmt.Sprintf("%x", md5.Sum([]byte("neutron")))
+	require.Equal(t, "g=admin-"+marker, execute(nil))
+	require.Equal(t, "g=root-"+marker, execute(map[string]interface{}{"user": "root"}))
+	require.Equal(t, "g=admin-"+fmt.Sprintf("%x", md5.Sum([]byte("cyberhub"))), execute(map[string]interface{}{"prefix": "cyberhub"}))
+
+	// constants keep the placeholders resolved by the request
+	yamlContent = strings.Replace(yamlContent, "  marker: '{{md5(prefix)}}'\n", "  marker: '{{md5(prefix)}}'\n  echo: '{{Hostname}}'\n", 1)
+	yamlContent = strings.Replace(yamlContent, "?g={{greeting}}", "?g={{greeting}}&h={{echo}}", 1)
+	require.Equal(t, "g=admin-"+marker+"&h="+strings.TrimPrefix(server.URL, "http://"), execute(nil))
+	yamlContent = strings.Replace(yamlContent, "&h={{echo}}", "", 1)
+
+	// names the template does not define are still variables of the template
+	yamlContent = strings.Replace(yamlContent, "?g={{greeting}}", "?g={{greeting}}&t={{token}}", 1)
+	require.Equal(t, "g=admin-"+marker+"&t=abc", execute(map[string]interface{}{"token": "abc"}))
+}
+
+func TestEvaluateConstants(t *testing.T) {
+	evaluate := func(constants string, overrides map[string]interface{}) (map[string]interface{}, error) {
+		var tmpl Template
+		require.NoError(t, yaml.Unmarshal([]byte("id: constants-test\nconstants:\n"+constants), &tmpl))
+		return tmpl.evaluateConstants(overrides)
+	}
+
+	// marker sorts before prefix but is evaluated after it
+	constants, err := evaluate("  prefix: neutron\n  marker: '{{md5(prefix)}}'\n  token: '{{rand_base(8)}}'\n", nil)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("%x", md5.Sum([]byte("neutron"))), constants["marker"])
+	require.Len(t, constants["token"], 8)
+
+	constants, err = evaluate("  prefix: neutron\n  marker: '{{md5(prefix)}}'\n", map[string]interface{}{"prefix": "cyberhub"})
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("%x", md5.Sum([]byte("cyberhub"))), constants["marker"])
+
+	// placeholders naming no constant are resolved at runtime
+	constants, err = evaluate("  prefix: neutron\n  oob: '{{interactsh-url}}'\n  target: '{{BaseURL}}/{{prefix}}'\n  ssti: '{{7*7}}'\n", nil)
+	require.NoError(t, err)
+	require.Equal(t, "{{interactsh-url}}", constants["oob"])
+	require.Equal(t, "{{BaseURL}}/neutron", constants["target"])
+	require.Equal(t, "{{7*7}}", constants["ssti"])
+
+	_, err = evaluate("  a: '{{b}}'\n  b: '{{to_upper(a)}}'\n  c: plain\n", nil)
+	require.ErrorContains(t, err, "cyclic reference between a, b")
+}
@@ -0,0 +1,184 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/chainreactors/neutron/protocols"
+	"gopkg.in/yaml.v3"
+)
+
+// protocol is a request block registered with RegisterProtocol.
+type protocol struct {
+	key        string
+	typ        protocols.ProtocolType
+	newRequest func() protocols.Request
+}
+
+// registeredProtocols holds the registered protocols by template key. Like
+// the operators registrar, registration is expected from init() only.
+var registeredProtocols = map[string]*protocol{}
+
+// builtinProtocolKeys are the keys of the request blocks Template declares,
+// in their default compile order.
+var builtinProtocolKeys = []string{"http", "requests", "network", "tcp", "udp", "ssl", "tls"}
+
+// RegisterProtocol makes templates accept a list of requests under key, e.g.
+// a grpc probe:
+//
+//	var GRPCProtocol = protocols.RegisterProtocolType("grpc")
+//
+//	func init() {
+//		templates.RegisterProtocol("grpc", GRPCProtocol, func() protocols.Request { return &Request{} })
+//	}
+//
+// Each element of the list is decoded from yaml or json into a request
+// returned by newRequest, whose Type must be typ. The requests are found in
+// Template.Protocols and compiled with the builtin ones, in the order the
+// blocks are declared. It panics on the key of a builtin block.
+func RegisterProtocol(key string, typ protocols.ProtocolType, newRequest func() protocols.Request) {
+	if isBuiltinProtocolKey(key) {
+		panic(fmt.Sprintf("protocol %s is builtin", key))
+	}
+	registeredProtocols[key] = &protocol{key: key, typ: typ, newRequest: newRequest}
+}
+
+func isBuiltinProtocolKey(key string) bool {
+	for _, builtin := range builtinProtocolKeys {
+		if key == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+// templateFields is Template without its unmarshalers.
+type templateFields Template
+
+// UnmarshalYAML decodes the template, the request blocks of the registered
+// protocols included, and records the order of the request blocks.
+func (t *Template) UnmarshalYAML(node *yaml.Node) error {
+	if err := node.Decode((*templateFields)(t)); err != nil {
+		return err
+	}
+	t.protocolKeys = nil
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		if isBuiltinProtocolKey(key) {
+			t.protocolKeys = append(t.protocolKeys, key)
+			continue
+		}
+		protocol, ok := registeredProtocols[key]
+		if !ok {
+			continue
+		}
+		if value.Kind != yaml.SequenceNode {
+			return fmt.Errorf("%s: expected a list of requests", key)
+		}
+		requests := make([]protocols.Request, 0, len(value.Content))
+		for j, item := range value.Content {
+			if item.Tag == "!!null" {
+				requests = append(requests, nil)
+				continue
+			}
+			request := protocol.newRequest()
+			if err := item.Decode(request); err != nil {
+				return fmt.Errorf("%s[%d]: %v", key, j, err)
+			}
+			requests = append(requests, request)
+		}
+		t.setProtocolRequests(key, requests)
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes the template, the request blocks of the registered
+// protocols included, and records the order of the request blocks.
+func (t *Template) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*templateFields)(t)); err != nil {
+		return err
+	}
+	t.protocolKeys = nil
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		if isBuiltinProtocolKey(key) {
+			t.protocolKeys = append(t.protocolKeys, key)
+			continue
+		}
+		protocol, ok := registeredProtocols[key]
+		if !ok {
+			continue
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(value, &items); err != nil {
+			return fmt.Errorf("%s: expected a list of requests", key)
+		}
+		requests := make([]protocols.Request, 0, len(items))
+		for j, item := range items {
+			if string(item) == "null" {
+				requests = append(requests, nil)
+				continue
+			}
+			request := protocol.newRequest()
+			if err := json.Unmarshal(item, request); err != nil {
+				return fmt.Errorf("%s[%d]: %v", key, j, err)
+			}
+			requests = append(requests, request)
+		}
+		t.setProtocolRequests(key, requests)
+	}
+	return nil
+}
+
+func (t *Template) setProtocolRequests(key string, requests []protocols.Request) {
+	if t.Protocols == nil {
+		t.Protocols = make(map[string][]protocols.Request)
+	}
+	t.Protocols[key] = requests
+	t.protocolKeys = append(t.protocolKeys, key)
+}
+
+// protocolOrder returns the keys of the request blocks in declaration order,
+// followed by the blocks set after decoding, builtin ones first.
+func (t *Template) protocolOrder() []string {
+	seen := make(map[string]struct{}, len(t.protocolKeys))
+	order := make([]string, 0, len(builtinProtocolKeys)+len(t.Protocols))
+	add := func(key string) {
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			order = append(order, key)
+		}
+	}
+	for _, key := range t.protocolKeys {
+		add(key)
+	}
+	for _, key := range builtinProtocolKeys {
+		add(key)
+	}
+	keys := make([]string, 0, len(t.Protocols))
+	for key := range t.Protocols {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		add(key)
+	}
+	return order
+}
@@ -0,0 +1,169 @@
+package templates
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chainreactors/neutron/operators"
+	"github.com/chainreactors/neutron/protocols"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+var echoProtocol = protocols.RegisterProtocolType("echo")
+
+// executed records the requests sent by the test templates, in order.
+var executed struct {
+	sync.Mutex
+	names []string
+}
+
+func recordExecuted(name string) {
+	executed.Lock()
+	defer executed.Unlock()
+	executed.names = append(executed.names, name)
+}
+
+func takeExecuted() []string {
+	executed.Lock()
+	defer executed.Unlock()
+	names := executed.names
+	executed.names = nil
+	return names
+}
+
+type echoRequest struct {
+	Name string `json:"name" yaml:"name"`
+	typ  protocols.ProtocolType
+}
+
+func (r *echoRequest) Compile(options *protocols.ExecuterOptions) error { return nil }
+
+func (r *echoRequest) Requests() int { return 1 }
+
+func (r *echoRequest) Match(data map[string]interface{}, matcher *operators.Matcher) (bool, []operators.MatchHit) {
+	return false, nil
+}
+
+func (r *echoRequest) Extract(data map[string]interface{}, extractor *operators.Extractor) map[string]struct{} {
+	return nil
+}
+
+func (r *echoRequest) ExecuteWithResults(input *protocols.ScanContext, dynamicValues, previous map[string]interface{}, callback protocols.OutputEventCallback) error {
+	recordExecuted("echo:" + r.Name)
+	return nil
+}
+
+func (r *echoRequest) MakeResultEventItem(wrapped *protocols.InternalWrappedEvent) *protocols.ResultEvent {
+	return &protocols.ResultEvent{}
+}
+
+func (r *echoRequest) MakeResultEvent(wrapped *protocols.InternalWrappedEvent) []*protocols.ResultEvent {
+	return protocols.MakeDefaultResultEvent(r, wrapped)
+}
+
+func (r *echoRequest) Type() protocols.ProtocolType {
+	if r.typ != 0 {
+		return r.typ
+	}
+	return echoProtocol
+}
+
+func (r *echoRequest) GetCompiledOperators() []*operators.Operators { return nil }
+
+func init() {
+	RegisterProtocol("echo", echoProtocol, func() protocols.Request { return &echoRequest{} })
+}
+
+func TestRegisterProtocolType(t *testing.T) {
+	require.Equal(t, "echo", echoProtocol.String())
+	require.Equal(t, echoProtocol, protocols.RegisterProtocolType("echo"))
+	require.Equal(t, protocols.HTTPProtocol, protocols.RegisterProtocolType("http"))
+	require.True(t, echoProtocol > protocols.InvalidProtocol)
+	require.Panics(t, func() {
+		RegisterProtocol("network", echoProtocol, func() protocols.Request { return &echoRequest{} })
+	})
+}
+
+func TestRegisteredProtocolOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recordExecuted("http:" + r.URL.Path)
+	}))
+	defer server.Close()
+
+	content := `
+id: registered-protocol
+info:
+  name: registered protocol
+  severity: info
+echo:
+  - name: first
+http:
+  - method: GET
+    path:
+      - "{{BaseURL}}/second"
+echo2: ignored
+`
+	var tmpl Template
+	require.NoError(t, yaml.Unmarshal([]byte(content), &tmpl))
+	require.Len(t, tmpl.Protocols["echo"], 1)
+	require.Equal(t, "first", tmpl.Protocols["echo"][0].(*echoRequest).Name)
+	require.NoError(t, tmpl.Compile(nil))
+	require.Equal(t, 2, tmpl.TotalRequests)
+	_, err := tmpl.Execute(server.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"echo:first", "http:/second"}, takeExecuted())
+
+	content = `{
+  "id": "registered-protocol",
+  "info": {"name": "registered protocol", "severity": "info"},
+  "http": [{"method": "GET", "path": ["{{BaseURL}}/first"]}],
+  "echo": [{"name": "second"}, {"name": "third"}]
+}`
+	tmpl = Template{}
+	require.NoError(t, json.Unmarshal([]byte(content), &tmpl))
+	require.Len(t, tmpl.Protocols["echo"], 2)
+	require.NoError(t, tmpl.Compile(nil))
+	_, err = tmpl.Execute(server.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"http:/first", "echo:second", "echo:third"}, takeExecuted())
+
+	// requests set without decoding are compiled too
+	tmpl = Template{
+		Id:        "registered-protocol",
+		Protocols: map[string][]protocols.Request{"echo": {&echoRequest{Name: "last"}}},
+	}
+	require.NoError(t, tmpl.Compile(nil))
+	_, err = tmpl.Execute(server.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"echo:last"}, takeExecuted())
+}
+
+func TestRegisteredProtocolErrors(t *testing.T) {
+	var tmpl Template
+	err := yaml.Unmarshal([]byte("id: invalid\necho:\n  name: first\n"), &tmpl)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "echo: expected a list of requests"), err.Error())
+
+	tmpl = Template{}
+	require.NoError(t, yaml.Unmarshal([]byte("id: invalid\necho:\n  - name: first\n  -\n"), &tmpl))
+	err = tmpl.Compile(nil)
+	require.Error(t, err)
+	require.Equal(t, "echo request at index 1 is nil", err.Error())
+
+	tmpl = Template{}
+	require.NoError(t, json.Unmarshal([]byte(`{"id": "invalid", "echo": [null]}`), &tmpl))
+	require.Error(t, tmpl.Compile(nil))
+
+	tmpl = Template{
+		Id:        "invalid",
+		Protocols: map[string][]protocols.Request{"echo": {&echoRequest{typ: protocols.HTTPProtocol}}},
+	}
+	err = tmpl.Compile(nil)
+	require.Error(t, err)
+	require.Equal(t, "echo request at index 0 has protocol http, registered as echo", err.Error())
+}
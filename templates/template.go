@@ -72,6 +72,9 @@ type Template struct {
 	// Variables contains any variables for the current template
 	Variables protocols.Variable `yaml:"variables,omitempty" json:"variables,omitempty"`
 
+	// Constants contains the constants of the template, evaluated once at compile time
+	Constants map[string]interface{} `yaml:"constants,omitempty" json:"constants,omitempty"`
+
 	// HTTP contains the http request to make in the template
 	RequestsHTTP []*http.Request `json:"http,omitempty" yaml:"http,omitempty"`
 
@@ -94,10 +97,20 @@ type Template struct {
 	// UDP contains the UDP network request to make in the template (alias for network)
 	RequestsUDP []*network.Request `json:"udp,omitempty" yaml:"udp,omitempty"`
 
+	// Protocols contains the requests of the protocols registered with
+	// RegisterProtocol, by template key.
+	Protocols map[string][]protocols.Request `yaml:"-" json:"-"`
+
 	// TotalRequests is the total number of requests for the template.
 	TotalRequests int `yaml:"-" json:"-"`
 	// Executor is the actual template executor for running template requests
 	Executor *executer.Executer `yaml:"-" json:"-"`
+	// Warnings are the findings of the compile-time DSL checks that do not
+	// fail compilation, e.g. undefined variables without Options.StrictDSL.
+	Warnings []string `yaml:"-" json:"-"`
+
+	// protocolKeys are the keys of the request blocks in declaration order
+	protocolKeys []string
 }
 
 func (t *Template) GetRequests() []*http.Request {
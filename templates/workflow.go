@@ -0,0 +1,287 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/chainreactors/neutron/protocols"
+	"gopkg.in/yaml.v3"
+)
+
+// Workflow is a nuclei workflow file: a tree of templates where the
+// subtemplates of a template run when it matched, or when the named matchers
+// listed under its matchers fired.
+//
+//	id: wordpress-workflow
+//	workflows:
+//	  - template: technologies/tech-detect.yaml
+//	    matchers:
+//	      - name: wordpress
+//	        subtemplates:
+//	          - template: cves/wordpress-rce.yaml
+//
+// The templates are the nodes of a ChainExecutor, identified by their path,
+// and the tree its edges, see Chain.
+type Workflow struct {
+	Id        string              `json:"id" yaml:"id"`
+	Info      Info                `json:"info" yaml:"info"`
+	Workflows []*WorkflowTemplate `json:"workflows" yaml:"workflows"`
+}
+
+// WorkflowTemplate is a template of a workflow and the templates chained to it.
+type WorkflowTemplate struct {
+	// Template is the path of the template, relative to the template catalog.
+	Template string `json:"template,omitempty" yaml:"template,omitempty"`
+	// Tags selects templates by tag in nuclei, which neutron does not support.
+	Tags string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Matchers chain templates to the named matchers of the template.
+	Matchers []*WorkflowMatcher `json:"matchers,omitempty" yaml:"matchers,omitempty"`
+	// Subtemplates run when the template matched.
+	Subtemplates []*WorkflowTemplate `json:"subtemplates,omitempty" yaml:"subtemplates,omitempty"`
+}
+
+// WorkflowMatcher chains templates to matchers of the parent template.
+type WorkflowMatcher struct {
+	// Name is the name of the matcher, or a list of names.
+	Name WorkflowNames `json:"name,omitempty" yaml:"name,omitempty"`
+	// Condition is or (default), any of the names fired, or and, all of them.
+	Condition string `json:"condition,omitempty" yaml:"condition,omitempty"`
+	// Subtemplates run when the matchers fired.
+	Subtemplates []*WorkflowTemplate `json:"subtemplates,omitempty" yaml:"subtemplates,omitempty"`
+}
+
+// WorkflowNames is a matcher name or a list of matcher names.
+type WorkflowNames []string
+
+// UnmarshalYAML accepts a scalar or a sequence of scalars.
+func (n *WorkflowNames) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*n = list
+		return nil
+	}
+	var single string
+	if err := unmarshal(&single); err != nil {
+		return err
+	}
+	*n = WorkflowNames{single}
+	return nil
+}
+
+// UnmarshalJSON accepts a string or a list of strings.
+func (n *WorkflowNames) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*n = list
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(data, &single); err != nil {
+		return err
+	}
+	*n = WorkflowNames{single}
+	return nil
+}
+
+// LoadWorkflow parses a nuclei workflow file.
+func LoadWorkflow(data []byte) (*Workflow, error) {
+	w := &Workflow{}
+	if err := yaml.Unmarshal(data, w); err != nil {
+		return nil, fmt.Errorf("unmarshal workflow: %v", err)
+	}
+	if len(w.Workflows) == 0 {
+		return nil, errors.New("workflow has no templates")
+	}
+	if err := validateWorkflowTemplates("workflows", w.Workflows); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func validateWorkflowTemplates(field string, templates []*WorkflowTemplate) error {
+	for i, t := range templates {
+		field := fmt.Sprintf("%s[%d]", field, i)
+		switch {
+		case t == nil:
+			return fmt.Errorf("%s: empty template", field)
+		case t.Tags != "":
+			return fmt.Errorf("%s: tags are not supported", field)
+		case t.Template == "":
+			return fmt.Errorf("%s: template is required", field)
+		}
+		for j, matcher := range t.Matchers {
+			field := fmt.Sprintf("%s.matchers[%d]", field, j)
+			if matcher == nil || len(matcher.Name) == 0 {
+				return fmt.Errorf("%s: name is required", field)
+			}
+			if matcher.Condition != "" && matcher.Condition != "and" && matcher.Condition != "or" {
+				return fmt.Errorf("%s: invalid condition %s", field, matcher.Condition)
+			}
+			if err := validateWorkflowTemplates(field+".subtemplates", matcher.Subtemplates); err != nil {
+				return err
+			}
+		}
+		if err := validateWorkflowTemplates(field+".subtemplates", t.Subtemplates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Entrypoints returns the paths of the top level templates of the workflow.
+func (w *Workflow) Entrypoints() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, t := range w.Workflows {
+		if !seen[t.Template] {
+			seen[t.Template] = true
+			paths = append(paths, t.Template)
+		}
+	}
+	return paths
+}
+
+// Templates returns the paths of every template of the workflow, in
+// declaration order.
+func (w *Workflow) Templates() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	w.Walk(func(t *WorkflowTemplate) {
+		if !seen[t.Template] {
+			seen[t.Template] = true
+			paths = append(paths, t.Template)
+		}
+	})
+	return paths
+}
+
+// Walk calls fn for every template of the workflow, in declaration order,
+// a template listed several times once per occurrence.
+func (w *Workflow) Walk(fn func(t *WorkflowTemplate)) {
+	w.walk(w.Workflows, fn)
+}
+
+func (w *Workflow) walk(templates []*WorkflowTemplate, fn func(t *WorkflowTemplate)) {
+	for _, t := range templates {
+		fn(t)
+		for _, matcher := range t.Matchers {
+			w.walk(matcher.Subtemplates, fn)
+		}
+		w.walk(t.Subtemplates, fn)
+	}
+}
+
+// Chain registers the templates of the workflow in e, chaining each template
+// to its subtemplates and, gated on the matcher names, to the subtemplates of
+// its matchers. A template listed several times is a single node with the
+// chains of every occurrence, and runs once per walk. Like AddEdges, it
+// returns the first *ChainCycleError, the workflow being registered anyway.
+func (w *Workflow) Chain(e *ChainExecutor) error {
+	var err error
+	w.Walk(func(t *WorkflowTemplate) {
+		var edges []ChainEdge
+		for _, matcher := range t.Matchers {
+			for _, sub := range matcher.Subtemplates {
+				edges = append(edges, ChainEdge{
+					Target:    sub.Template,
+					Matchers:  matcher.Name,
+					Condition: matcher.Condition,
+				})
+			}
+		}
+		for _, sub := range t.Subtemplates {
+			edges = append(edges, ChainEdge{Target: sub.Template})
+		}
+		if cycleErr := e.AddEdges(t.Template, edges...); err == nil {
+			err = cycleErr
+		}
+	})
+	return err
+}
+
+// LoadTemplates loads and compiles the templates of the workflow, by path.
+// They are opened from options.Catalog, next to the workflow file when
+// options.TemplatePath is set, then from the root of the catalog. The named
+// extractors of every template are external variables of the others, which
+// receive them when the chain forwards them.
+func (w *Workflow) LoadTemplates(options *protocols.ExecuterOptions) (map[string]*Template, error) {
+	if options == nil || options.Catalog == nil {
+		return nil, errors.New("workflow templates need a catalog")
+	}
+	templates := make(map[string]*Template)
+	names := make(map[string]string)
+	var extracted []string
+	for _, path := range w.Templates() {
+		name, ok := options.ResolvePath(path)
+		if !ok {
+			return nil, fmt.Errorf("%s: template not found", path)
+		}
+		file, err := options.Catalog.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		content, err := ioutil.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		t, err := Load(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for _, block := range t.dslBlocks() {
+			extracted = append(extracted, block.extractors...)
+		}
+		templates[path], names[path] = t, name
+	}
+
+	compileOptions := *options
+	if options.Options != nil {
+		compiled := *options.Options
+		compileOptions.Options = &compiled
+	} else {
+		compileOptions.Options = &protocols.Options{Timeout: 5}
+	}
+	compileOptions.Options.ExternalVariables = append(append([]string{}, compileOptions.Options.ExternalVariables...), extracted...)
+	for _, path := range w.Templates() {
+		templateOptions := compileOptions
+		templateOptions.TemplatePath = names[path]
+		if err := templates[path].Compile(&templateOptions); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return templates, nil
+}
+
+// TemplateExecuteFunc returns an ExecuteFunc running the compiled templates
+// by ID against input, e.g. the templates of a workflow by path. The values
+// forwarded by the parent are the payloads of the template, and are forwarded
+// to its chains along with its own extracted values.
+func TemplateExecuteFunc(templates map[string]*Template, input string) ExecuteFunc {
+	return func(id string, vars map[string]interface{}) *ChainResult {
+		t := templates[id]
+		if t == nil || t.Executor == nil {
+			return nil
+		}
+		payloads := make(map[string]interface{}, len(vars))
+		for k, v := range vars {
+			payloads[k] = v
+		}
+		result, err := t.Execute(input, payloads)
+		if err != nil {
+			return nil
+		}
+		chainResult := NewChainResult(result)
+		if chainResult == nil {
+			return nil
+		}
+		for k, v := range vars {
+			if _, ok := chainResult.Vars[k]; !ok {
+				chainResult.Vars[k] = v
+			}
+		}
+		return chainResult
+	}
+}
@@ -0,0 +1,181 @@
+package templates
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/chainreactors/neutron/protocols"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadWorkflow(t *testing.T) {
+	w, err := LoadWorkflow([]byte(`
+id: wordpress-workflow
+info:
+  name: WordPress workflow
+workflows:
+  - template: technologies/tech-detect.yaml
+    matchers:
+      - name: wordpress
+        subtemplates:
+          - template: cves/wordpress-rce.yaml
+      - name: [php, mysql]
+        condition: and
+        subtemplates:
+          - template: cves/php-mysql.yaml
+    subtemplates:
+      - template: exposures/backup.yaml
+        subtemplates:
+          - template: cves/wordpress-rce.yaml
+  - template: exposures/backup.yaml
+`))
+	require.NoError(t, err)
+	require.Equal(t, "wordpress-workflow", w.Id)
+	require.Equal(t, WorkflowNames{"wordpress"}, w.Workflows[0].Matchers[0].Name)
+	require.Equal(t, WorkflowNames{"php", "mysql"}, w.Workflows[0].Matchers[1].Name)
+	require.Equal(t, []string{"technologies/tech-detect.yaml", "exposures/backup.yaml"}, w.Entrypoints())
+	require.Equal(t, []string{
+		"technologies/tech-detect.yaml",
+		"cves/wordpress-rce.yaml",
+		"cves/php-mysql.yaml",
+		"exposures/backup.yaml",
+	}, w.Templates())
+	var walked []string
+	w.Walk(func(t *WorkflowTemplate) { walked = append(walked, t.Template) })
+	require.Equal(t, []string{
+		"technologies/tech-detect.yaml",
+		"cves/wordpress-rce.yaml",
+		"cves/php-mysql.yaml",
+		"exposures/backup.yaml",
+		"cves/wordpress-rce.yaml",
+		"exposures/backup.yaml",
+	}, walked)
+
+	e := NewChainExecutor(ChainConfig{})
+	require.NoError(t, w.Chain(e))
+	require.Equal(t, []string{"technologies/tech-detect.yaml"}, e.Entrypoints())
+	require.Equal(t, []ChainEdge{
+		{Target: "cves/wordpress-rce.yaml", Matchers: []string{"wordpress"}},
+		{Target: "cves/php-mysql.yaml", Matchers: []string{"php", "mysql"}, Condition: "and"},
+		{Target: "exposures/backup.yaml"},
+	}, e.chains["technologies/tech-detect.yaml"])
+
+	for content, expected := range map[string]string{
+		"id: empty\n": "workflow has no templates",
+		"id: tags\nworkflows:\n  - tags: wordpress\n":                                                               "workflows[0]: tags are not supported",
+		"id: missing\nworkflows:\n  - template: a.yaml\n    subtemplates:\n      - matchers: []\n":                  "workflows[0].subtemplates[0]: template is required",
+		"id: unnamed\nworkflows:\n  - template: a.yaml\n    matchers:\n      - condition: and\n":                    "workflows[0].matchers[0]: name is required",
+		"id: condition\nworkflows:\n  - template: a.yaml\n    matchers:\n      - name: a\n        condition: xor\n": "workflows[0].matchers[0]: invalid condition xor",
+	} {
+		_, err := LoadWorkflow([]byte(content))
+		require.EqualError(t, err, expected)
+	}
+}
+
+func TestExecuteWorkflow(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprint(w, `<meta name="generator" content="WordPress 6.4"> vulnerable`)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "workflow")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"technologies/tech-detect.yaml": `
+id: tech-detect
+http:
+  - path:
+      - "{{BaseURL}}/"
+    matchers:
+      - type: word
+        name: wordpress
+        words:
+          - WordPress
+      - type: word
+        name: joomla
+        words:
+          - Joomla
+    extractors:
+      - type: regex
+        name: version
+        internal: true
+        group: 1
+        regex:
+          - 'WordPress ([\d.]+)'
+`,
+		"cves/wordpress-rce.yaml": `
+id: wordpress-rce
+http:
+  - path:
+      - "{{BaseURL}}/wp/{{version}}"
+    matchers:
+      - type: word
+        words:
+          - vulnerable
+`,
+		"cves/joomla-rce.yaml": `
+id: joomla-rce
+http:
+  - path:
+      - "{{BaseURL}}/joomla"
+    matchers:
+      - type: word
+        words:
+          - vulnerable
+`,
+		"workflows/wordpress.yaml": `
+id: wordpress-workflow
+workflows:
+  - template: technologies/tech-detect.yaml
+    matchers:
+      - name: wordpress
+        subtemplates:
+          - template: cves/wordpress-rce.yaml
+      - name: joomla
+        subtemplates:
+          - template: cves/joomla-rce.yaml
+`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	w, err := LoadWorkflow([]byte(files["workflows/wordpress.yaml"]))
+	require.NoError(t, err)
+	options := &protocols.ExecuterOptions{
+		Options:      &protocols.Options{Timeout: 5},
+		Catalog:      protocols.DirCatalog(dir),
+		TemplatePath: "workflows/wordpress.yaml",
+	}
+	templates, err := w.LoadTemplates(options)
+	require.NoError(t, err)
+	require.Len(t, templates, 3)
+
+	e := NewChainExecutor(ChainConfig{PassVariables: true})
+	require.NoError(t, w.Chain(e))
+	var executed []string
+	fn := TemplateExecuteFunc(templates, server.URL)
+	e.Execute(w.Entrypoints(), func(id string, vars map[string]interface{}) *ChainResult {
+		executed = append(executed, id)
+		return fn(id, vars)
+	})
+	require.Equal(t, []string{"technologies/tech-detect.yaml", "cves/wordpress-rce.yaml"}, executed)
+	require.Equal(t, []string{"/", "/wp/6.4"}, paths)
+
+	options.Catalog = protocols.DirCatalog(filepath.Join(dir, "cves"))
+	_, err = w.LoadTemplates(options)
+	require.EqualError(t, err, "technologies/tech-detect.yaml: template not found")
+}